@@ -3,6 +3,7 @@ package asm
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -30,6 +31,7 @@ type Arg struct {
 	Sym      *string `(@Sym Whitespace?)?`
 	Size     *uint32 `(@Size Whitespace?)?`
 	Flag     *uint8  `(@Size Whitespace?)?`
+	Offset   *uint32 `(@Size Whitespace?)?`
 	Selector *string `(@Sym Whitespace?)?`
 	Desc     *string `(@Sym Whitespace?)?`
 	//Desc *string `(Quote ((@Sym | @Size) @Whitespace?)+ Quote Whitespace?)?`
@@ -157,6 +159,27 @@ func parseFlagged(b *bytes.Buffer, arg Arg) (int, error) {
 
 }
 
+func parseJump(b *bytes.Buffer, arg Arg) (int, error) {
+	var rn int
+
+	n, err := parseFlagged(b, arg)
+	rn += n
+	if err != nil {
+		return rn, err
+	}
+
+	if arg.Offset == nil {
+		return rn, fmt.Errorf("missing jump offset")
+	}
+	n, err = writeSize(b, *arg.Offset)
+	rn += n
+	if err != nil {
+		return rn, err
+	}
+
+	return rn, nil
+}
+
 func parseOne(op vm.Opcode, instruction *Instruction, w io.Writer) (int, error) {
 	a := instruction.OpArg
 	var n_buf int
@@ -190,7 +213,13 @@ func parseOne(op vm.Opcode, instruction *Instruction, w io.Writer) (int, error)
 	// Catch CATCH, LOAD and twosyms with integer-as-string
 	if a.Size != nil {
 		log.Printf("have size %v (%v)", instruction, *a.Size)
-		if a.Sym == nil {
+		if op == vm.JMPF {
+			n, err := parseJump(b, a)
+			n_buf += n
+			if err != nil {
+				return n_out, err
+			}
+		} else if a.Sym == nil {
 			n, err := parseFlagged(b, a)
 			n_buf += n
 			if err != nil {
@@ -243,6 +272,9 @@ func (a Arg) String() string {
 	if a.Flag != nil {
 		s += fmt.Sprintf(" Flag: %v", *a.Flag)
 	}
+	if a.Offset != nil {
+		s += fmt.Sprintf(" Offset: %v", *a.Offset)
+	}
 	if a.Selector != nil {
 		s += " Selector: " + *a.Selector
 	}
@@ -257,6 +289,7 @@ func (a Arg) String() string {
 //
 // TODO: Conceal from outside use
 type Instruction struct {
+	Pos     lexer.Position
 	OpCode  string `@Ident`
 	OpArg   Arg    `(Whitespace @@)?`
 	Comment string `Comment? EOL`
@@ -374,9 +407,18 @@ func (bt *Batcher) Exit(w io.Writer) (int, error) {
 
 // Parse one or more lines of assembly code, and write assembled bytecode to the provided writer.
 func Parse(s string, w io.Writer) (int, error) {
+	return parse(s, w, nil, nil)
+}
+
+// parse assembly code. If origin is not nil, errors are resolved to the source line the code originates from.
+func parse(s string, w io.Writer, origin func(int) (Origin, bool), mp *sourceMapper) (int, error) {
 	rd := strings.NewReader(s)
 	ast, err := asmParser.Parse("file", rd)
 	if err != nil {
+		perr, ok := err.(participle.Error)
+		if ok {
+			err = sourceError(origin, perr.Position().Line, errors.New(perr.Message()), err)
+		}
 		return 0, err
 	}
 
@@ -390,23 +432,25 @@ func Parse(s string, w io.Writer) (int, error) {
 			n, err := batch.MenuAdd(w, v.OpCode, v.OpArg)
 			rn += n
 			if err != nil {
-				return rn, err
+				return rn, sourceError(origin, v.Pos.Line, err, err)
 			}
+			mp.addItem(v.Pos.Line)
 		} else {
-			n, err := batch.MenuExit(w)
+			n, err := mp.exit(&batch, w, rn)
 			if err != nil {
 				return rn, err
 			}
 			rn += n
+			mp.add(rn, v.Pos.Line)
 			n, err = parseOne(op, v, w)
 			rn += n
 			if err != nil {
-				return rn, err
+				return rn, sourceError(origin, v.Pos.Line, err, err)
 			}
 			log.Printf("wrote %v bytes for %v", n, v.OpArg)
 		}
 	}
-	n, err := batch.Exit(w)
+	n, err := mp.exit(&batch, w, rn)
 	rn += n
 	if err != nil {
 		return rn, err
@@ -415,3 +459,15 @@ func Parse(s string, w io.Writer) (int, error) {
 
 	return rn, err
 }
+
+// resolves the error to a SourceError if the source line is known, or else returns the fallback error.
+func sourceError(origin func(int) (Origin, bool), line int, err error, fallback error) error {
+	if origin == nil {
+		return fallback
+	}
+	o, ok := origin(line)
+	if !ok {
+		return fallback
+	}
+	return SourceError{o.File, o.Line, err}
+}
@@ -366,6 +366,26 @@ func TestParseCroak(t *testing.T) {
 	}
 }
 
+func TestParseJmpf(t *testing.T) {
+	b := bytes.NewBuffer(nil)
+	s := "JMPF 8 1 2\n"
+	_, err := Parse(s, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := vm.NewLine(nil, vm.JMPF, nil, []byte{0x08}, []uint8{0x01, 0x01, 0x02})
+	if !bytes.Equal(b.Bytes(), expect) {
+		t.Fatalf("expected %x, got %x", expect, b)
+	}
+
+	b = bytes.NewBuffer(nil)
+	s = "JMPF 8 1\n"
+	_, err = Parse(s, b)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
 func TestParseNoarg(t *testing.T) {
 	var b []byte
 	ph := vm.NewParseHandler().WithDefaultHandlers()
@@ -388,6 +408,20 @@ func TestParseNoarg(t *testing.T) {
 	}
 }
 
+func TestParseCall(t *testing.T) {
+	b := bytes.NewBuffer(nil)
+	s := "CALL pin\nRET\n"
+	_, err := Parse(s, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := vm.NewLine(nil, vm.CALL, []string{"pin"}, nil, nil)
+	expect = vm.NewLine(expect, vm.RET, nil, nil, nil)
+	if !bytes.Equal(b.Bytes(), expect) {
+		t.Fatalf("expected:\n\t%x\ngot:\n\t%x\n", expect, b)
+	}
+}
+
 func TestParserWriteMultiple(t *testing.T) {
 	var b []byte
 	b = vm.NewLine(b, vm.HALT, nil, nil, nil)
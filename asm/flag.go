@@ -74,6 +74,33 @@ func (pp *FlagParser) Last() uint32 {
 	return pp.hi
 }
 
+// Add registers a mapping between a flag string and a flag index.
+//
+// The description is optional, and is ignored if empty.
+//
+// Fails if the flag index is lower than state.FLAG_USERSTART.
+func (pp *FlagParser) Add(key string, idx uint32, description string) error {
+	if idx < state.FLAG_USERSTART {
+		return fmt.Errorf("Minimum flag value is FLAG_USERSTART (%d)", state.FLAG_USERSTART)
+	}
+	v := strconv.FormatUint(uint64(idx), 10)
+	pp.flag[key] = v
+	if idx > pp.hi {
+		pp.hi = idx
+	}
+
+	if len(description) > 0 {
+		pp.flagDescription[idx] = description
+		logg.Debugf("added flag translation", "from", key, "to", v, "description", description)
+	} else {
+		logg.Debugf("added flag translation", "from", key, "to", v)
+	}
+	if pp.debug {
+		state.FlagDebugger.Register(idx, key)
+	}
+	return nil
+}
+
 // Load parses a Comma Seperated Value file under the given filepath
 // to provide mappings between flag strings and flag indices.
 //
@@ -111,20 +138,13 @@ func (pp *FlagParser) Load(fp string) (int, error) {
 			if vv < state.FLAG_USERSTART {
 				return 0, fmt.Errorf("Minimum flag value is FLAG_USERSTART (%d)", state.FLAG_USERSTART)
 			}
-			fl := uint32(vv)
-			pp.flag[v[1]] = v[2]
-			if fl > pp.hi {
-				pp.hi = fl
-			}
-
+			var description string
 			if len(v) > 3 {
-				pp.flagDescription[uint32(fl)] = v[3]
-				logg.Debugf("added flag translation", "from", v[1], "to", v[2], "description", v[3])
-			} else {
-				logg.Debugf("added flag translation", "from", v[1], "to", v[2])
+				description = v[3]
 			}
-			if pp.debug {
-				state.FlagDebugger.Register(fl, v[2])
+			err = pp.Add(v[1], uint32(vv), description)
+			if err != nil {
+				return 0, err
 			}
 		}
 	}
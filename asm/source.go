@@ -0,0 +1,459 @@
+package asm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"git.defalsify.org/vise.git/vm"
+)
+
+var (
+	labelRegex = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*):$`)
+	constRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// SourceError is returned when processing or parsing fails on a specific line of assembly source.
+type SourceError struct {
+	// File is the name of the source file where the error occurred.
+	File string
+	// Line is the line number within File where the error occurred.
+	Line int
+	// Err is the error itself.
+	Err error
+}
+
+// Error implements the Error interface.
+func (e SourceError) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e SourceError) Unwrap() error {
+	return e.Err
+}
+
+// Origin refers to a line in an assembly source file.
+type Origin struct {
+	File string
+	Line int
+}
+
+// String implements the String interface.
+func (o Origin) String() string {
+	return fmt.Sprintf("%s:%d", o.File, o.Line)
+}
+
+// expanded source line, before resolution of labels.
+type sourceLine struct {
+	fields  []string
+	origin  Origin
+	labelAt int
+}
+
+// Preprocessor expands directives, constants, flag names and labels in assembly code.
+//
+// The following directives are recognized, each on a line of its own:
+//
+//	.include <file>             insert the code of file in place (relative to the including file)
+//	.const <name> <value>       replace all subsequent arguments matching name with value
+//	.flag <name> <index> [desc] register a flag name, as with a FlagParser CSV entry
+//	.flags <file>               load flag names from a FlagParser CSV file
+//
+// A line with a single word ending with a colon defines a label, e.g. "skip:".
+//
+// Labels may be used as the instruction count of a JMPF instruction, which will then skip
+// all instructions up to the label.
+//
+// Flag names may be used instead of numeric signal values in CATCH, CROAK and JMPF instructions.
+type Preprocessor struct {
+	flags  *FlagParser
+	consts map[string]string
+	labels map[string]int
+	lines  []sourceLine
+	stack  []string
+	count  int
+	batch  int
+	origin []Origin
+	srcmap *vm.SourceMap
+}
+
+// NewPreprocessor creates a new Preprocessor.
+func NewPreprocessor() *Preprocessor {
+	return &Preprocessor{
+		flags: NewFlagParser(),
+	}
+}
+
+// WithFlagParser is a chainable function that sets the FlagParser to resolve flag names with.
+//
+// Flags registered by the .flag and .flags directives will be added to it.
+func (pp *Preprocessor) WithFlagParser(flags *FlagParser) *Preprocessor {
+	pp.flags = flags
+	return pp
+}
+
+// FlagParser returns the FlagParser used to resolve flag names.
+func (pp *Preprocessor) FlagParser() *FlagParser {
+	return pp.flags
+}
+
+// Origin returns the source file and line of the given line of processed code.
+//
+// The line number is 1-indexed.
+func (pp *Preprocessor) Origin(line int) (Origin, bool) {
+	if line < 1 || line > len(pp.origin) {
+		return Origin{}, false
+	}
+	return pp.origin[line-1], true
+}
+
+// Process reads the assembly source file under the given path and returns the expanded assembly code.
+func (pp *Preprocessor) Process(fp string) (string, error) {
+	pp.reset()
+	err := pp.include(fp, Origin{})
+	if err != nil {
+		return "", err
+	}
+	return pp.resolve()
+}
+
+// ProcessString expands the given assembly code and returns the result.
+//
+// The name is used to identify the source in errors. Includes are resolved relative to the working directory.
+func (pp *Preprocessor) ProcessString(name string, s string) (string, error) {
+	pp.reset()
+	err := pp.processString(name, s, ".")
+	if err != nil {
+		return "", err
+	}
+	return pp.resolve()
+}
+
+// Parse expands the assembly source file under the given path, and writes the assembled bytecode to the provided writer.
+//
+// Errors refer to the file and line in the source where they occurred.
+func (pp *Preprocessor) Parse(fp string, w io.Writer) (int, error) {
+	s, err := pp.Process(fp)
+	if err != nil {
+		return 0, err
+	}
+	pp.srcmap = vm.NewSourceMap()
+	mp := &sourceMapper{
+		sm:     pp.srcmap,
+		origin: pp.Origin,
+		lines:  strings.Split(s, "\n"),
+	}
+	return parse(s, w, pp.Origin, mp)
+}
+
+// SourceMap returns the source map of the bytecode generated by the last call to Parse.
+func (pp *Preprocessor) SourceMap() *vm.SourceMap {
+	return pp.srcmap
+}
+
+// clear results of previous processing. Flags are kept.
+func (pp *Preprocessor) reset() {
+	pp.consts = make(map[string]string)
+	pp.labels = make(map[string]int)
+	pp.lines = []sourceLine{}
+	pp.stack = []string{}
+	pp.origin = []Origin{}
+	pp.count = 0
+	pp.batch = 0
+}
+
+// process the contents of a source file.
+func (pp *Preprocessor) include(fp string, from Origin) error {
+	afp, err := filepath.Abs(fp)
+	if err != nil {
+		return err
+	}
+	for _, v := range pp.stack {
+		if v == afp {
+			return SourceError{from.File, from.Line, fmt.Errorf("include loop: %s", fp)}
+		}
+	}
+	b, err := os.ReadFile(fp)
+	if err != nil {
+		if from.File == "" {
+			return err
+		}
+		return SourceError{from.File, from.Line, err}
+	}
+	pp.stack = append(pp.stack, afp)
+	err = pp.processString(fp, string(b), path.Dir(fp))
+	pp.stack = pp.stack[:len(pp.stack)-1]
+	return err
+}
+
+// process assembly code line by line.
+func (pp *Preprocessor) processString(name string, s string, dir string) error {
+	for i, l := range strings.Split(s, "\n") {
+		o := Origin{
+			File: name,
+			Line: i + 1,
+		}
+		err := pp.processLine(l, o, dir)
+		if err != nil {
+			_, ok := err.(SourceError)
+			if !ok {
+				err = SourceError{o.File, o.Line, err}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// process a single line of assembly code.
+func (pp *Preprocessor) processLine(l string, o Origin, dir string) error {
+	i := strings.Index(l, "#")
+	if i > -1 {
+		l = l[:i]
+	}
+	fields := strings.Fields(l)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	m := labelRegex.FindStringSubmatch(fields[0])
+	if m != nil {
+		if len(fields) > 1 {
+			return fmt.Errorf("label must be on a line of its own")
+		}
+		return pp.label(m[1])
+	}
+
+	if fields[0] != ".const" {
+		for i, v := range fields[1:] {
+			r, ok := pp.consts[v]
+			if ok {
+				fields[i+1] = r
+			}
+		}
+	}
+
+	if fields[0][0] == '.' && len(fields[0]) > 1 {
+		return pp.directive(fields, o, dir)
+	}
+
+	err := pp.flag(fields)
+	if err != nil {
+		return err
+	}
+
+	_, ok := vm.OpcodeIndex[fields[0]]
+	if ok {
+		pp.count += pp.batchSize()
+		pp.batch = 0
+		pp.count += 1
+	} else if batchCode[fields[0]] > 0 {
+		pp.batch += 1
+	}
+	pp.lines = append(pp.lines, sourceLine{
+		fields:  fields,
+		origin:  o,
+		labelAt: pp.count,
+	})
+	return nil
+}
+
+// handle assembler directives.
+func (pp *Preprocessor) directive(fields []string, o Origin, dir string) error {
+	switch fields[0] {
+	case ".include":
+		if len(fields) != 2 {
+			return fmt.Errorf("usage: .include <file>")
+		}
+		fp := fields[1]
+		if !path.IsAbs(fp) {
+			fp = path.Join(dir, fp)
+		}
+		return pp.include(fp, o)
+	case ".const":
+		if len(fields) != 3 {
+			return fmt.Errorf("usage: .const <name> <value>")
+		}
+		if !constRegex.MatchString(fields[1]) {
+			return fmt.Errorf("invalid constant name: %s", fields[1])
+		}
+		_, ok := pp.consts[fields[1]]
+		if ok {
+			return fmt.Errorf("constant already defined: %s", fields[1])
+		}
+		pp.consts[fields[1]] = fields[2]
+		logg.Debugf("added constant", "name", fields[1], "value", fields[2])
+	case ".flag":
+		if len(fields) < 3 {
+			return fmt.Errorf("usage: .flag <name> <index> [description]")
+		}
+		v, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return fmt.Errorf("flag index must be numeric: %s", fields[2])
+		}
+		return pp.flags.Add(fields[1], uint32(v), strings.Join(fields[3:], " "))
+	case ".flags":
+		if len(fields) != 2 {
+			return fmt.Errorf("usage: .flags <file>")
+		}
+		fp := fields[1]
+		if !path.IsAbs(fp) {
+			fp = path.Join(dir, fp)
+		}
+		_, err := pp.flags.Load(fp)
+		return err
+	default:
+		return fmt.Errorf("unknown directive: %s", fields[0])
+	}
+	return nil
+}
+
+// register a label at the current instruction count.
+func (pp *Preprocessor) label(name string) error {
+	if pp.batch > 0 {
+		return fmt.Errorf("label %s cannot be defined inside a menu batch", name)
+	}
+	_, ok := pp.labels[name]
+	if ok {
+		return fmt.Errorf("label already defined: %s", name)
+	}
+	pp.labels[name] = pp.count
+	logg.Tracef("added label", "name", name, "count", pp.count)
+	return nil
+}
+
+// replace flag names with flag index values in instructions taking a signal argument.
+func (pp *Preprocessor) flag(fields []string) error {
+	var i int
+	switch fields[0] {
+	case "CATCH":
+		i = 2
+	case "CROAK", "JMPF":
+		i = 1
+	default:
+		return nil
+	}
+	if len(fields) <= i {
+		return nil
+	}
+	_, err := strconv.Atoi(fields[i])
+	if err == nil {
+		return nil
+	}
+	r, err := pp.flags.GetAsString(fields[i])
+	if err != nil {
+		return err
+	}
+	logg.Tracef("translated flag", "from", fields[i], "to", r)
+	fields[i] = r
+	return nil
+}
+
+// number of instructions generated by the current menu batch.
+func (pp *Preprocessor) batchSize() int {
+	if pp.batch == 0 {
+		return 0
+	}
+	return (pp.batch * 2) + 1
+}
+
+// resolve labels and render processed code.
+func (pp *Preprocessor) resolve() (string, error) {
+	var s string
+	for _, l := range pp.lines {
+		if l.fields[0] == "JMPF" && len(l.fields) > 3 {
+			_, err := strconv.Atoi(l.fields[3])
+			if err != nil {
+				v, ok := pp.labels[l.fields[3]]
+				if !ok {
+					return "", SourceError{l.origin.File, l.origin.Line, fmt.Errorf("unknown label: %s", l.fields[3])}
+				}
+				c := v - l.labelAt
+				if c < 0 {
+					return "", SourceError{l.origin.File, l.origin.Line, fmt.Errorf("label %s is before jump", l.fields[3])}
+				}
+				l.fields[3] = strconv.Itoa(c)
+			}
+		}
+		s += strings.Join(l.fields, " ") + "\n"
+		pp.origin = append(pp.origin, l.origin)
+	}
+	return s, nil
+}
+
+// records the source lines of the instructions written by the assembler.
+//
+// All methods are noops on a nil sourceMapper.
+type sourceMapper struct {
+	sm     *vm.SourceMap
+	origin func(int) (Origin, bool)
+	lines  []string
+	items  []int
+}
+
+// add the source line of the instruction at the given bytecode offset.
+func (mp *sourceMapper) add(offset int, line int) {
+	if mp == nil {
+		return
+	}
+	o, ok := mp.origin(line)
+	if !ok {
+		return
+	}
+	var code string
+	if line <= len(mp.lines) {
+		code = strings.TrimSpace(mp.lines[line-1])
+	}
+	mp.sm.Add(offset, o.File, o.Line, code)
+}
+
+// add the source line of a menu batch item.
+//
+// Like in the MenuProcessor, items are accumulated across batches.
+func (mp *sourceMapper) addItem(line int) {
+	if mp == nil {
+		return
+	}
+	mp.items = append(mp.items, line)
+}
+
+// write the pending menu batch, and add the source lines of the generated instructions.
+//
+// Display instructions and input matches are mapped to the item they were generated from,
+// and the HALT between them to the last item.
+func (mp *sourceMapper) exit(batch *Batcher, w io.Writer, offset int) (int, error) {
+	if mp == nil {
+		return batch.MenuExit(w)
+	}
+	var b bytes.Buffer
+	_, err := batch.MenuExit(&b)
+	if err != nil {
+		return 0, err
+	}
+	ph := vm.NewParseHandler().WithDefaultHandlers()
+	c := len(mp.items)
+	v := b.Bytes()
+	for i := 0; len(v) > 0; i++ {
+		j := i
+		if i == c {
+			j = c - 1
+		} else if i > c {
+			j = i - c - 1
+		}
+		if j >= 0 && j < c {
+			mp.add(offset+b.Len()-len(v), mp.items[j])
+		}
+		v, err = ph.ParseOne(v)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return w.Write(b.Bytes())
+}
@@ -0,0 +1,263 @@
+package asm
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"git.defalsify.org/vise.git/vm"
+)
+
+func TestPreprocessConst(t *testing.T) {
+	pp := NewPreprocessor()
+	s := `.const FOO foo
+.const SEL 42
+MOUT FOO SEL # comment
+HALT
+INCMP FOO SEL
+`
+	r, err := pp.ProcessString("root.vis", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "MOUT foo 42\nHALT\nINCMP foo 42\n"
+	if r != expect {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s", expect, r)
+	}
+	o, ok := pp.Origin(3)
+	if !ok {
+		t.Fatalf("expected origin")
+	}
+	if o.File != "root.vis" || o.Line != 5 {
+		t.Fatalf("expected root.vis:5, got %s", o)
+	}
+
+	s = `.const FOO foo
+.const FOO bar
+`
+	_, err = pp.ProcessString("root.vis", s)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestPreprocessFlag(t *testing.T) {
+	pp := NewPreprocessor()
+	s := `.flag foo 8
+.flag bar 9 the bar flag
+CATCH baz foo 1
+CROAK bar 0
+JMPF bar 1 1
+HALT
+`
+	r, err := pp.ProcessString("root.vis", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "CATCH baz 8 1\nCROAK 9 0\nJMPF 9 1 1\nHALT\n"
+	if r != expect {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s", expect, r)
+	}
+	v, err := pp.FlagParser().GetDescription(9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "the bar flag" {
+		t.Fatalf("expected flag description, got '%s'", v)
+	}
+
+	s = `CATCH baz xyzzy 1
+`
+	_, err = pp.ProcessString("root.vis", s)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+
+	s = `.flag foo 7
+`
+	_, err = pp.ProcessString("root.vis", s)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestPreprocessLabel(t *testing.T) {
+	pp := NewPreprocessor()
+	s := `JMPF 8 1 skip
+LOAD foo 0
+DOWN bar 1 to_bar
+MAP foo
+skip:
+MOUT baz 2
+JMPF 8 0 end
+end:
+HALT
+`
+	r, err := pp.ProcessString("root.vis", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `JMPF 8 1 5
+LOAD foo 0
+DOWN bar 1 to_bar
+MAP foo
+MOUT baz 2
+JMPF 8 0 0
+HALT
+`
+	if r != expect {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s", expect, r)
+	}
+
+	s = `back:
+HALT
+JMPF 8 1 back
+`
+	_, err = pp.ProcessString("root.vis", s)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+
+	s = `JMPF 8 1 nowhere
+HALT
+`
+	_, err = pp.ProcessString("root.vis", s)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestPreprocessInclude(t *testing.T) {
+	dir := t.TempDir()
+	err := os.Mkdir(path.Join(dir, "lib"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path.Join(dir, "lib", "common.vis"), []byte(".const BACK 9\n.include flags.vis\nMOUT back BACK\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path.Join(dir, "lib", "flags.vis"), []byte(".flag foo 8\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path.Join(dir, "root.vis"), []byte("CATCH bar foo 1\n.include lib/common.vis\nHALT\nINCMP _ BACK\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pp := NewPreprocessor()
+	b := bytes.NewBuffer(nil)
+	_, err = pp.Parse(path.Join(dir, "root.vis"), b)
+	if err == nil {
+		t.Fatalf("expected error for flag used before definition")
+	}
+
+	err = os.WriteFile(path.Join(dir, "root.vis"), []byte(".include lib/common.vis\nCATCH bar foo 1\nHALT\nINCMP _ BACK\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = bytes.NewBuffer(nil)
+	_, err = pp.Parse(path.Join(dir, "root.vis"), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := vm.NewLine(nil, vm.MOUT, []string{"back", "9"}, nil, nil)
+	expect = vm.NewLine(expect, vm.CATCH, []string{"bar"}, []byte{0x08}, []uint8{1})
+	expect = vm.NewLine(expect, vm.HALT, nil, nil, nil)
+	expect = vm.NewLine(expect, vm.INCMP, []string{"_", "9"}, nil, nil)
+	if !bytes.Equal(b.Bytes(), expect) {
+		t.Fatalf("expected:\n\t%x\ngot:\n\t%x", expect, b.Bytes())
+	}
+
+	err = os.WriteFile(path.Join(dir, "lib", "flags.vis"), []byte(".include ../root.vis\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = pp.Parse(path.Join(dir, "root.vis"), b)
+	if err == nil {
+		t.Fatalf("expected error for include loop")
+	}
+}
+
+func TestPreprocessError(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(path.Join(dir, "inc.vis"), []byte("MOUT foo 0\n\nLOAD foo bar baz qux\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := path.Join(dir, "root.vis")
+	err = os.WriteFile(fp, []byte("# a comment\nMOVE foo\n.include inc.vis\nHALT\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pp := NewPreprocessor()
+	b := bytes.NewBuffer(nil)
+	_, err = pp.Parse(fp, b)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	var serr SourceError
+	if !errors.As(err, &serr) {
+		t.Fatalf("expected source error, got %v", err)
+	}
+	if serr.File != path.Join(dir, "inc.vis") || serr.Line != 3 {
+		t.Fatalf("expected error in inc.vis:3, got %v", err)
+	}
+
+	err = os.WriteFile(fp, []byte("MOVE foo\n.bogus\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = pp.Parse(fp, b)
+	if !errors.As(err, &serr) {
+		t.Fatalf("expected source error, got %v", err)
+	}
+	if serr.File != fp || serr.Line != 2 {
+		t.Fatalf("expected error in root.vis:2, got %v", err)
+	}
+}
+
+func TestPreprocessSourceMap(t *testing.T) {
+	dir := t.TempDir()
+	fp := path.Join(dir, "root.vis")
+	err := os.WriteFile(fp, []byte(".const SEL 1\nLOAD foo 0\n\nDOWN bar 0 to_bar\nUP SEL back\nMOVE baz\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pp := NewPreprocessor()
+	b := bytes.NewBuffer(nil)
+	_, err = pp.Parse(fp, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ph := vm.NewParseHandler().WithDefaultHandlers().WithSourceMap(pp.SourceMap())
+	r, err := ph.ToString(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `LOAD foo 0 # %s:2
+MOUT to_bar 0 # %s:4
+MOUT back 1 # %s:5
+HALT # %s:5
+INCMP bar 0 # %s:4
+INCMP _ 1 # %s:5
+MOVE baz # %s:6
+`
+	expect = strings.ReplaceAll(expect, "%s", fp)
+	if r != expect {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s", expect, r)
+	}
+
+	l, ok := pp.SourceMap().At(0)
+	if !ok {
+		t.Fatalf("expected source line")
+	}
+	if l.Code != "LOAD foo 0" {
+		t.Fatalf("expected code 'LOAD foo 0', got '%s'", l.Code)
+	}
+}
@@ -19,6 +19,7 @@ type Cache struct {
 	// Last inserted value (regardless of scope)
 	LastValue string
 	invalid   bool
+	sizeFunc  func(string) uint32
 }
 
 // NewCache creates a new ready-to-use Cache object
@@ -46,11 +47,19 @@ func (ca *Cache) WithCacheSize(cacheSize uint32) *Cache {
 	return ca
 }
 
+// WithSizeFunc is a chainable method that sets the function used to measure the size of values, for both the size limit of individual values and the cumulative cache size.
+//
+// The function should match the one used for measuring output in the renderer, e.g. render.Gsm7Size. If not set, the size is the number of bytes.
+func (ca *Cache) WithSizeFunc(fn func(string) uint32) *Cache {
+	ca.sizeFunc = fn
+	return ca
+}
+
 // Add implements the Memory interface.
 func (ca *Cache) Add(key string, value string, sizeLimit uint16) error {
 	if sizeLimit > 0 {
-		l := uint16(len(value))
-		if l > sizeLimit {
+		l := ca.size(value)
+		if l > uint32(sizeLimit) {
 			return fmt.Errorf("value length %v exceeds value size limit %v", l, sizeLimit)
 		}
 	}
@@ -91,8 +100,8 @@ func (ca *Cache) ReservedSize(key string) (uint16, error) {
 func (ca *Cache) Update(key string, value string) error {
 	sizeLimit := ca.Sizes[key]
 	if ca.Sizes[key] > 0 {
-		l := uint16(len(value))
-		if l > sizeLimit {
+		l := ca.size(value)
+		if l > uint32(sizeLimit) {
 			return fmt.Errorf("update value length %v exceeds value size limit %v", l, sizeLimit)
 		}
 	}
@@ -101,7 +110,7 @@ func (ca *Cache) Update(key string, value string) error {
 		return fmt.Errorf("key %v not defined", key)
 	}
 	r := ca.Cache[checkFrame][key]
-	l := uint32(len(r))
+	l := ca.size(r)
 	ca.Cache[checkFrame][key] = ""
 	ca.CacheUseSize -= l
 	sz := ca.checkCapacity(value)
@@ -112,7 +121,7 @@ func (ca *Cache) Update(key string, value string) error {
 		return fmt.Errorf("Cache capacity exceeded %v of %v", baseUseSize+sz, ca.CacheSize)
 	}
 	ca.Cache[checkFrame][key] = value
-	ca.CacheUseSize += uint32(len(value))
+	ca.CacheUseSize += sz
 	return nil
 }
 
@@ -138,7 +147,7 @@ func (ca *Cache) Reset() {
 	ca.Cache = ca.Cache[:1]
 	ca.CacheUseSize = 0
 	for _, v = range ca.Cache[0] {
-		ca.CacheUseSize += uint32(len(v))
+		ca.CacheUseSize += ca.size(v)
 	}
 	return
 }
@@ -159,8 +168,8 @@ func (ca *Cache) Pop() error {
 	l -= 1
 	m := ca.Cache[l]
 	for k, v := range m {
-		sz := len(v)
-		ca.CacheUseSize -= uint32(sz)
+		sz := ca.size(v)
+		ca.CacheUseSize -= sz
 		delete(ca.Sizes, k)
 		logg.Debugf("Cache free", "frame", l, "key", k, "size", sz)
 	}
@@ -188,7 +197,7 @@ func (ca *Cache) Last() string {
 // bytes that will be added to cache use size for string
 // returns 0 if capacity would be exceeded
 func (ca *Cache) checkCapacity(v string) uint32 {
-	sz := uint32(len(v))
+	sz := ca.size(v)
 	if ca.CacheSize == 0 {
 		return sz
 	}
@@ -198,6 +207,14 @@ func (ca *Cache) checkCapacity(v string) uint32 {
 	return sz
 }
 
+// size of the value, as measured by the size function if set.
+func (ca *Cache) size(v string) uint32 {
+	if ca.sizeFunc == nil {
+		return uint32(len(v))
+	}
+	return ca.sizeFunc(v)
+}
+
 // return 0-indexed frame number where key is defined. -1 if not defined
 func (ca *Cache) frameOf(key string) int {
 	for i, m := range ca.Cache {
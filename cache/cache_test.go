@@ -3,6 +3,7 @@ package cache
 import (
 	"slices"
 	"testing"
+	"unicode/utf8"
 )
 
 func TestNewCache(t *testing.T) {
@@ -102,6 +103,35 @@ func TestCacheLimits(t *testing.T) {
 	}
 }
 
+func TestCacheSizeFunc(t *testing.T) {
+	ca := NewCache().WithSizeFunc(func(s string) uint32 {
+		return uint32(utf8.RuneCountInString(s))
+	})
+	ca = ca.WithCacheSize(8)
+	err := ca.Add("foo", "blåbær", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca.CacheUseSize != 6 {
+		t.Fatalf("expected use size 6, got %d", ca.CacheUseSize)
+	}
+	err = ca.Add("bar", "æøå", 0)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	err = ca.Update("foo", "bær")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ca.Add("bar", "æøå", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca.CacheUseSize != 6 {
+		t.Fatalf("expected use size 6, got %d", ca.CacheUseSize)
+	}
+}
+
 func TestStateDownUp(t *testing.T) {
 	ca := NewCache()
 	err := ca.Push()
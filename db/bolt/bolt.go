@@ -0,0 +1,330 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"git.defalsify.org/vise.git/db"
+)
+
+var (
+	// bucket holding all records.
+	bucketName = []byte("vise")
+	// bucket holding the time of the last write of each record, under the same key as the record.
+	timeBucketName = []byte("vise_mtime")
+	// how long to wait for the file lock held by another process.
+	openTimeout = time.Second
+)
+
+// boltDb is a bbolt backend implementation of the Db interface.
+type boltDb struct {
+	*db.DbBase
+	conn     *bbolt.DB
+	tx       *bbolt.Tx
+	readOnly bool
+}
+
+// Creates a new bbolt backed Db implementation.
+func NewBoltDb() *boltDb {
+	db := &boltDb{
+		DbBase: db.NewDbBase(),
+	}
+	return db
+}
+
+// Base implements Db
+func (bdb *boltDb) Base() *db.DbBase {
+	return bdb.DbBase
+}
+
+// WithReadOnly sets database as read only.
+//
+// There may exist more than one instance of read-only
+// databases to the same file at the same time.
+// However, only one single write database.
+//
+// Readonly cannot be set when creating a new database.
+func (bdb *boltDb) WithReadOnly() *boltDb {
+	bdb.readOnly = true
+	return bdb
+}
+
+// String implements the string interface.
+func (bdb *boltDb) String() string {
+	fn := "??"
+	if bdb.conn != nil {
+		fn = bdb.conn.Path()
+	}
+	return "boltdb: " + fn
+}
+
+// Connect implements Db
+//
+// The connection string is the path to the database file.
+func (bdb *boltDb) Connect(ctx context.Context, connStr string) error {
+	if bdb.conn != nil {
+		logg.WarnCtxf(ctx, "already connected", "conn", bdb.conn)
+		return nil
+	}
+	_, err := os.Stat(connStr)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("db path lookup err: %v", err)
+		}
+		if bdb.readOnly {
+			return fmt.Errorf("cannot open new database readonly")
+		}
+	}
+	opts := &bbolt.Options{
+		Timeout:  openTimeout,
+		ReadOnly: bdb.readOnly,
+	}
+	conn, err := bbolt.Open(connStr, 0600, opts)
+	if err != nil {
+		return fmt.Errorf("db open err: %v", err)
+	}
+	if bdb.readOnly {
+		err = conn.View(func(tx *bbolt.Tx) error {
+			if tx.Bucket(bucketName) == nil {
+				return fmt.Errorf("bucket %s not found", bucketName)
+			}
+			return nil
+		})
+	} else {
+		err = conn.Update(func(tx *bbolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(bucketName)
+			if err != nil {
+				return err
+			}
+			_, err = tx.CreateBucketIfNotExists(timeBucketName)
+			return err
+		})
+	}
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("db bucket err: %v", err)
+	}
+	logg.DebugCtxf(ctx, "bolt connected", "connstr", connStr)
+	bdb.conn = conn
+	bdb.DbBase.Connect(ctx, connStr)
+	return nil
+}
+
+// Start implements Db.
+//
+// All subsequent operations are performed in the same transaction until Stop or Abort is called.
+func (bdb *boltDb) Start(ctx context.Context) error {
+	if bdb.tx != nil {
+		return db.ErrTxExist
+	}
+	tx, err := bdb.conn.Begin(!bdb.readOnly)
+	logg.TraceCtxf(ctx, "begin multi tx", "err", err)
+	if err != nil {
+		return err
+	}
+	bdb.tx = tx
+	return nil
+}
+
+// Stop implements Db.
+func (bdb *boltDb) Stop(ctx context.Context) error {
+	var err error
+	if bdb.tx == nil {
+		return db.ErrNoTx
+	}
+	if bdb.tx.Writable() {
+		err = bdb.tx.Commit()
+	} else {
+		err = bdb.tx.Rollback()
+	}
+	logg.TraceCtxf(ctx, "stop multi tx", "err", err)
+	bdb.tx = nil
+	return err
+}
+
+// Abort implements Db.
+func (bdb *boltDb) Abort(ctx context.Context) {
+	if bdb.tx == nil {
+		return
+	}
+	logg.InfoCtxf(ctx, "aborting tx", "tx", bdb.tx.ID())
+	bdb.tx.Rollback()
+	bdb.tx = nil
+}
+
+// Put implements Db
+func (bdb *boltDb) Put(ctx context.Context, key []byte, val []byte) error {
+	if !bdb.CheckPut() {
+		return errors.New("unsafe put and safety set")
+	}
+	lk, err := bdb.ToKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	logg.TraceCtxf(ctx, "bolt put", "key", key, "lk", lk, "val", val)
+	k := lk.Default
+	if lk.Translation != nil {
+		k = lk.Translation
+	}
+	return bdb.update(func(b *bbolt.Bucket) error {
+		err := b.Put(k, val)
+		if err != nil {
+			return err
+		}
+		t := make([]byte, 8)
+		binary.BigEndian.PutUint64(t, uint64(time.Now().UnixNano()))
+		return b.Tx().Bucket(timeBucketName).Put(k, t)
+	})
+}
+
+// Get implements Db
+func (bdb *boltDb) Get(ctx context.Context, key []byte) ([]byte, error) {
+	var v []byte
+	lk, err := bdb.ToKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	err = bdb.view(func(b *bbolt.Bucket) error {
+		var ok bool
+		if lk.Translation != nil {
+			v, ok = get(b, lk.Translation)
+			if ok {
+				return nil
+			}
+		}
+		v, ok = get(b, lk.Default)
+		if !ok {
+			return db.NewErrNotFound(key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	logg.TraceCtxf(ctx, "bolt get", "key", key, "lk", lk, "val", v)
+	return v, nil
+}
+
+// Delete implements Db
+func (bdb *boltDb) Delete(ctx context.Context, key []byte) error {
+	if !bdb.CheckPut() {
+		return errors.New("unsafe delete and safety set")
+	}
+	lk, err := bdb.ToKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	k := lk.Default
+	if lk.Translation != nil {
+		k = lk.Translation
+	}
+	logg.TraceCtxf(ctx, "bolt delete", "key", key, "lk", k)
+	return bdb.update(func(b *bbolt.Bucket) error {
+		_, ok := get(b, k)
+		if !ok {
+			return db.NewErrNotFound(key)
+		}
+		err := b.Delete(k)
+		if err != nil {
+			return err
+		}
+		return b.Tx().Bucket(timeBucketName).Delete(k)
+	})
+}
+
+// Sweep implements db.Sweeper.
+//
+// bbolt does not store modification times. The time of every write is therefore recorded by Put in a separate bucket. Records written before write times were recorded are not swept.
+func (bdb *boltDb) Sweep(ctx context.Context, maxAge time.Duration) (int, error) {
+	var keys [][]byte
+	if !bdb.CheckPut() {
+		return 0, errors.New("unsafe sweep and safety set")
+	}
+	pfx := bdb.Prefix()
+	err := bdb.update(func(b *bbolt.Bucket) error {
+		tb := b.Tx().Bucket(timeBucketName)
+		c := b.Cursor()
+		for k, _ := c.Seek([]byte{pfx}); k != nil && k[0] == pfx; k, _ = c.Next() {
+			v := tb.Get(k)
+			if len(v) != 8 {
+				continue
+			}
+			t := time.Unix(0, int64(binary.BigEndian.Uint64(v)))
+			if time.Since(t) < maxAge {
+				continue
+			}
+			keys = append(keys, append([]byte{}, k...))
+		}
+		// keys are deleted after iteration, as deleting moves the cursor
+		for _, k := range keys {
+			err := b.Delete(k)
+			if err != nil {
+				return err
+			}
+			err = tb.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	logg.TraceCtxf(ctx, "bolt sweep", "pfx", pfx, "deleted", len(keys))
+	return len(keys), nil
+}
+
+// Close implements Db
+//
+// A pending transaction is committed before closing.
+func (bdb *boltDb) Close(ctx context.Context) error {
+	logg.TraceCtxf(ctx, "closing bolt", "path", bdb.conn.Path())
+	err := bdb.Stop(ctx)
+	if err == db.ErrNoTx {
+		err = nil
+	}
+	cerr := bdb.conn.Close()
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// view executes fn within the current transaction, or a new read-only transaction if none is active.
+func (bdb *boltDb) view(fn func(*bbolt.Bucket) error) error {
+	if bdb.tx != nil {
+		return fn(bdb.tx.Bucket(bucketName))
+	}
+	return bdb.conn.View(func(tx *bbolt.Tx) error {
+		return fn(tx.Bucket(bucketName))
+	})
+}
+
+// update executes fn within the current transaction, or a new writable transaction if none is active.
+func (bdb *boltDb) update(fn func(*bbolt.Bucket) error) error {
+	if bdb.tx != nil {
+		return fn(bdb.tx.Bucket(bucketName))
+	}
+	return bdb.conn.Update(func(tx *bbolt.Tx) error {
+		return fn(tx.Bucket(bucketName))
+	})
+}
+
+// get returns a copy of the value stored under the key, since values are only valid for the life of the transaction.
+//
+// A cursor is used so that empty values can be told apart from missing keys.
+func get(b *bbolt.Bucket, k []byte) ([]byte, bool) {
+	kk, v := b.Cursor().Seek(k)
+	if !bytes.Equal(k, kk) {
+		return nil, false
+	}
+	return append([]byte{}, v...), true
+}
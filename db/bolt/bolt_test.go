@@ -0,0 +1,224 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"git.defalsify.org/vise.git/db"
+	"git.defalsify.org/vise.git/db/crypt"
+	"git.defalsify.org/vise.git/db/dbtest"
+)
+
+func TestCasesBolt(t *testing.T) {
+	ctx := context.Background()
+
+	store := NewBoltDb()
+	f, err := ioutil.TempFile("", "vise-db-bolt-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Connect(ctx, f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dbtest.RunTests(t, ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPutGetBolt(t *testing.T) {
+	var dbi db.Db
+	ctx := context.Background()
+	sid := "ses"
+	f, err := ioutil.TempFile("", "vise-db-bolt-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewBoltDb()
+	store.SetPrefix(db.DATATYPE_USERDATA)
+	store.SetSession(sid)
+
+	dbi = store
+	_ = dbi
+
+	err = store.Connect(ctx, f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Put(ctx, []byte("foo"), []byte("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := store.Get(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v, []byte("bar")) {
+		t.Fatalf("expected value 'bar', found '%s'", v)
+	}
+	_, err = store.Get(ctx, []byte("bar"))
+	if err == nil {
+		t.Fatal("expected get error for key 'bar'")
+	}
+	err = store.Put(ctx, []byte("empty"), []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err = store.Get(ctx, []byte("empty"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != 0 {
+		t.Fatalf("expected empty value, found '%s'", v)
+	}
+}
+
+func TestTxBolt(t *testing.T) {
+	ctx := context.Background()
+	f, err := ioutil.TempFile("", "vise-db-bolt-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewBoltDb()
+	err = store.Connect(ctx, f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetPrefix(db.DATATYPE_USERDATA)
+
+	err = store.Stop(ctx)
+	if err != db.ErrNoTx {
+		t.Fatalf("expected ErrNoTx, got %v", err)
+	}
+	err = store.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Start(ctx)
+	if err != db.ErrTxExist {
+		t.Fatalf("expected ErrTxExist, got %v", err)
+	}
+	err = store.Put(ctx, []byte("foo"), []byte("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := store.Get(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v, []byte("bar")) {
+		t.Fatalf("expected value 'bar', found '%s'", v)
+	}
+	store.Abort(ctx)
+	_, err = store.Get(ctx, []byte("foo"))
+	if err == nil {
+		t.Fatal("expected get error after abort")
+	}
+
+	err = store.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Put(ctx, []byte("foo"), []byte("baz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Stop(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err = store.Get(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v, []byte("baz")) {
+		t.Fatalf("expected value 'baz', found '%s'", v)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	ctx := context.Background()
+	store := NewBoltDb()
+	f, err := ioutil.TempFile("", "vise-db-bolt-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Connect(ctx, f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Connect(ctx, f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetPrefix(db.DATATYPE_USERDATA)
+	err = store.Put(ctx, []byte("foo"), []byte("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store = NewBoltDb().WithReadOnly()
+	err = store.Connect(ctx, f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetPrefix(db.DATATYPE_USERDATA)
+	v, err := store.Get(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v, []byte("bar")) {
+		t.Fatalf("expected 'bar', got: '%s'", v)
+	}
+	err = store.Put(ctx, []byte("foo"), []byte("baz"))
+	if err == nil {
+		t.Fatal("expected error on readonly put")
+	}
+}
+
+func TestSweepBolt(t *testing.T) {
+	ctx := context.Background()
+	store := NewBoltDb()
+	f, err := ioutil.TempFile("", "vise-db-bolt-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Connect(ctx, f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbtest.RunSweepTests(t, ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSweepBoltCrypt(t *testing.T) {
+	ctx := context.Background()
+	f, err := ioutil.TempFile("", "vise-db-bolt-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kr := crypt.NewKeyRing()
+	err = kr.Add(1, bytes.Repeat([]byte{0x2a}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := crypt.NewCryptDb(NewBoltDb(), kr)
+	err = store.Connect(ctx, f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbtest.RunSweepTests(t, ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,2 @@
+// Package bolt is a bbolt embedded database backed implementation of the db.Db interface.
+package bolt
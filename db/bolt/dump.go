@@ -0,0 +1,74 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+
+	"go.etcd.io/bbolt"
+
+	"git.defalsify.org/vise.git/db"
+)
+
+// Dump implements Db.
+//
+// The matching records are read in a single transaction, in key order.
+func (bdb *boltDb) Dump(ctx context.Context, key []byte) (*db.Dumper, error) {
+	var keys [][]byte
+	var vals [][]byte
+	bdb.SetLanguage(nil)
+	lk, err := bdb.ToKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	pfx := lk.Default
+	err = bdb.view(func(b *bbolt.Bucket) error {
+		c := b.Cursor()
+		for k, v := c.Seek(pfx); k != nil && bytes.HasPrefix(k, pfx); k, v = c.Next() {
+			kk, err := bdb.DecodeKey(ctx, k)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, kk)
+			vals = append(vals, append([]byte{}, v...))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, db.NewErrNotFound(pfx)
+	}
+	logg.TraceCtxf(ctx, "bolt dump", "key", key, "count", len(keys))
+	return db.NewSliceDumper(keys, vals), nil
+}
+
+// Range implements Db.
+func (bdb *boltDb) Range(ctx context.Context, start []byte, end []byte, limit int) (*db.Dumper, error) {
+	var keys [][]byte
+	var vals [][]byte
+	lo, hi := bdb.RangeKeys(start, end)
+	err := bdb.view(func(b *bbolt.Bucket) error {
+		c := b.Cursor()
+		for k, v := c.Seek(lo); k != nil; k, v = c.Next() {
+			if hi != nil && bytes.Compare(k, hi) >= 0 {
+				break
+			}
+			kk, err := bdb.DecodeKey(ctx, k)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, kk)
+			vals = append(vals, append([]byte{}, v...))
+			if limit > 0 && len(keys) == limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	logg.TraceCtxf(ctx, "bolt range", "start", start, "end", end, "count", len(keys))
+	return db.NewSliceDumper(keys, vals), nil
+}
@@ -0,0 +1,9 @@
+package bolt
+
+import (
+	"git.defalsify.org/vise.git/logging"
+)
+
+var (
+	logg logging.Logger = logging.NewVanilla().WithDomain("boltdb")
+)
@@ -0,0 +1,228 @@
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"git.defalsify.org/vise.git/db"
+	"git.defalsify.org/vise.git/logging"
+)
+
+const (
+	// DefaultThreshold is the default minimum size of values to compress.
+	DefaultThreshold = 256
+)
+
+var (
+	logg logging.Logger = logging.NewVanilla().WithDomain("compressdb")
+)
+
+var (
+	// marks a compressed value.
+	compressMagic = []byte{0xff, 'v', 'z', 0x01}
+	// marks an uncompressed value that would otherwise be mistaken for a marked one.
+	//
+	// Bytecode, cbor and UTF-8 text never start with 0xff, but userdata may hold arbitrary bytes.
+	storedMagic = []byte{0xff, 'v', 'z', 0x00}
+)
+
+// compressDb is a Db wrapper that compresses values of selected datatypes.
+type compressDb struct {
+	db.Db
+	types     uint8
+	threshold int
+	level     int
+}
+
+// NewCompressDb creates a wrapper for the Db in the first argument, which compresses values of the datatypes in the typ bitmask on Put.
+//
+// Only values of at least DefaultThreshold bytes are compressed, and only if the result is smaller than the original value.
+//
+// Compressed values are stored with a marker prefix, followed by the DEFLATE compressed value. Values without the marker are returned as is, so existing uncompressed data remains readable. Uncompressed values that start with a marker are stored with another marker prefix, which is removed again on read.
+//
+// Values are only decompressed by Get, Dump and Range for the datatypes in the typ bitmask. Values of all other datatypes are returned as stored, even if they start with the marker. The bitmask should therefore not be narrowed for a backend with existing compressed data.
+//
+// If used together with the db/crypt wrapper, the compressing wrapper must be the inner one, since encrypted values do not compress.
+func NewCompressDb(store db.Db, typ uint8) *compressDb {
+	return &compressDb{
+		Db:        store,
+		types:     typ,
+		threshold: DefaultThreshold,
+		level:     flate.DefaultCompression,
+	}
+}
+
+// WithThreshold sets the minimum size of values to compress.
+func (cdb *compressDb) WithThreshold(threshold int) *compressDb {
+	cdb.threshold = threshold
+	return cdb
+}
+
+// WithLevel sets the compression level, as defined in the compress/flate package.
+func (cdb *compressDb) WithLevel(level int) *compressDb {
+	cdb.level = level
+	return cdb
+}
+
+// Put implements Db.
+func (cdb *compressDb) Put(ctx context.Context, key []byte, val []byte) error {
+	if cdb.active() && len(val) >= cdb.threshold {
+		v, err := cdb.compress(val)
+		if err != nil {
+			return err
+		}
+		if len(v) < len(val) {
+			logg.TraceCtxf(ctx, "compressed", "key", key, "len", len(val), "compressed", len(v))
+			return cdb.Db.Put(ctx, key, v)
+		}
+	}
+	if cdb.active() && marked(val) {
+		val = append(append([]byte{}, storedMagic...), val...)
+	}
+	return cdb.Db.Put(ctx, key, val)
+}
+
+// Get implements Db.
+func (cdb *compressDb) Get(ctx context.Context, key []byte) ([]byte, error) {
+	v, err := cdb.Db.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !cdb.active() {
+		return v, nil
+	}
+	v, err = decompress(v)
+	if err != nil {
+		return nil, fmt.Errorf("value for key %x: %w", key, err)
+	}
+	return v, nil
+}
+
+// Dump implements Db.
+func (cdb *compressDb) Dump(ctx context.Context, key []byte) (*db.Dumper, error) {
+	d, err := cdb.Db.Dump(ctx, key)
+	if err != nil || !cdb.active() {
+		return d, err
+	}
+	d = db.NewTransformDumper(ctx, d, decompressEntry)
+	if d.Err() != nil {
+		return nil, d.Err()
+	}
+	return d, nil
+}
+
+// Range implements Db.
+func (cdb *compressDb) Range(ctx context.Context, start []byte, end []byte, limit int) (*db.Dumper, error) {
+	d, err := cdb.Db.Range(ctx, start, end, limit)
+	if err != nil || !cdb.active() {
+		return d, err
+	}
+	d = db.NewTransformDumper(ctx, d, decompressEntry)
+	if d.Err() != nil {
+		return nil, d.Err()
+	}
+	return d, nil
+}
+
+// Base implements Db.
+func (cdb *compressDb) Base() *db.DbBase {
+	return cdb.Db.Base()
+}
+
+// Lock implements db.Locker.
+//
+// It is a noop if the wrapped Db does not implement db.Locker.
+func (cdb *compressDb) Lock(ctx context.Context, key []byte) error {
+	locker, ok := cdb.Db.(db.Locker)
+	if !ok {
+		return nil
+	}
+	return locker.Lock(ctx, key)
+}
+
+// Unlock implements db.Locker.
+//
+// It is a noop if the wrapped Db does not implement db.Locker.
+func (cdb *compressDb) Unlock(ctx context.Context, key []byte) error {
+	locker, ok := cdb.Db.(db.Locker)
+	if !ok {
+		return nil
+	}
+	return locker.Unlock(ctx, key)
+}
+
+// Sweep implements db.Sweeper.
+//
+// Fails if the wrapped Db does not implement db.Sweeper.
+func (cdb *compressDb) Sweep(ctx context.Context, maxAge time.Duration) (int, error) {
+	sw, ok := cdb.Db.(db.Sweeper)
+	if !ok {
+		return 0, fmt.Errorf("%T does not implement db.Sweeper", cdb.Db)
+	}
+	return sw.Sweep(ctx, maxAge)
+}
+
+// SetSnapshot implements db.Snapshotter.
+//
+// Fails if the wrapped Db does not implement db.Snapshotter.
+func (cdb *compressDb) SetSnapshot(name string) error {
+	sn, ok := cdb.Db.(db.Snapshotter)
+	if !ok {
+		return fmt.Errorf("%T does not implement db.Snapshotter", cdb.Db)
+	}
+	return sn.SetSnapshot(name)
+}
+
+// true if values in the current prefix should be compressed.
+func (cdb *compressDb) active() bool {
+	return cdb.Prefix()&cdb.types > 0
+}
+
+// compress the value, prepending the marker.
+func (cdb *compressDb) compress(val []byte) ([]byte, error) {
+	b := bytes.NewBuffer(append([]byte{}, compressMagic...))
+	w, err := flate.NewWriter(b, cdb.level)
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.Write(val)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// true if the value starts with one of the markers.
+func marked(val []byte) bool {
+	return bytes.HasPrefix(val, compressMagic) || bytes.HasPrefix(val, storedMagic)
+}
+
+// decompress the value if it has the compressed marker, strip the stored marker, or return it unchanged.
+func decompress(val []byte) ([]byte, error) {
+	if bytes.HasPrefix(val, storedMagic) {
+		return val[len(storedMagic):], nil
+	}
+	if !bytes.HasPrefix(val, compressMagic) {
+		return val, nil
+	}
+	r := flate.NewReader(bytes.NewReader(val[len(compressMagic):]))
+	defer r.Close()
+	v, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("decompress: %v", err)
+	}
+	return v, nil
+}
+
+// decompress dumped values.
+func decompressEntry(ctx context.Context, key []byte, val []byte) ([]byte, error) {
+	return decompress(val)
+}
@@ -0,0 +1,213 @@
+package compress
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"git.defalsify.org/vise.git/db"
+	"git.defalsify.org/vise.git/db/dbtest"
+	"git.defalsify.org/vise.git/db/mem"
+)
+
+func TestCasesCompress(t *testing.T) {
+	ctx := context.Background()
+	var typ uint8 = db.DATATYPE_BIN | db.DATATYPE_MENU | db.DATATYPE_TEMPLATE | db.DATATYPE_STATE | db.DATATYPE_USERDATA
+	store := NewCompressDb(mem.NewMemDb(), typ).WithThreshold(0)
+	err := store.Connect(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbtest.RunTests(t, ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompressDb(t *testing.T) {
+	ctx := context.Background()
+	main := mem.NewMemDb()
+	store := NewCompressDb(main, db.DATATYPE_TEMPLATE|db.DATATYPE_STATE)
+	err := store.Connect(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	main.SetLock(db.DATATYPE_TEMPLATE, false)
+
+	big := bytes.Repeat([]byte("inky pinky blinky clyde "), 100)
+	small := []byte("xyzzy")
+	store.SetPrefix(db.DATATYPE_TEMPLATE)
+	err = store.Put(ctx, []byte("big"), big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Put(ctx, []byte("small"), small)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := main.Get(ctx, []byte("big"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(r, compressMagic) || len(r) >= len(big) {
+		t.Fatalf("expected compressed value, got %d bytes: %x", len(r), r)
+	}
+	r, err = main.Get(ctx, []byte("small"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r, small) {
+		t.Fatalf("expected uncompressed value %x, got %x", small, r)
+	}
+
+	r, err = store.Get(ctx, []byte("big"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r, big) {
+		t.Fatalf("expected %x, got %x", big, r)
+	}
+
+	d, err := store.Range(ctx, []byte("big"), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, r := d.Next(ctx)
+	if !bytes.Equal(k, []byte("big")) || !bytes.Equal(r, big) {
+		t.Fatalf("expected 'big' uncompressed, got %s: %x", k, r)
+	}
+	k, r = d.Next(ctx)
+	if !bytes.Equal(k, []byte("small")) || !bytes.Equal(r, small) {
+		t.Fatalf("expected 'small' uncompressed, got %s: %x", k, r)
+	}
+
+	store.SetPrefix(db.DATATYPE_USERDATA)
+	err = store.Put(ctx, []byte("big"), big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = main.Get(ctx, []byte("big"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r, big) {
+		t.Fatal("expected uncompressed value for datatype not selected")
+	}
+}
+
+func TestCompressDbLegacy(t *testing.T) {
+	ctx := context.Background()
+	main := mem.NewMemDb()
+	err := main.Connect(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := bytes.Repeat([]byte{0x00, 0x01, 0x02}, 200)
+	main.SetPrefix(db.DATATYPE_STATE)
+	err = main.Put(ctx, []byte("foo"), legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewCompressDb(main, db.DATATYPE_STATE)
+	r, err := store.Get(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r, legacy) {
+		t.Fatalf("expected legacy value %x, got %x", legacy, r)
+	}
+
+	err = main.Put(ctx, []byte("foo"), append(append([]byte{}, compressMagic...), 0x42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Get(ctx, []byte("foo"))
+	if err == nil {
+		t.Fatal("expected error on corrupt compressed value")
+	}
+}
+
+func TestCompressDbUnmasked(t *testing.T) {
+	ctx := context.Background()
+	main := mem.NewMemDb()
+	err := main.Connect(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := append(append([]byte{}, compressMagic...), []byte("binary data")...)
+	main.SetPrefix(db.DATATYPE_USERDATA)
+	err = main.Put(ctx, []byte("foo"), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewCompressDb(main, db.DATATYPE_STATE)
+	r, err := store.Get(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r, v) {
+		t.Fatalf("expected unchanged value %x, got %x", v, r)
+	}
+	d, err := store.Range(ctx, nil, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, r = d.Next(ctx)
+	if !bytes.Equal(r, v) {
+		t.Fatalf("expected unchanged value %x, got %x", v, r)
+	}
+
+	c, err := store.Sweep(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != 1 {
+		t.Fatalf("expected 1 swept entry, got %d", c)
+	}
+	err = store.SetSnapshot("v1")
+	if err == nil {
+		t.Fatal("expected error setting snapshot on db without snapshots")
+	}
+}
+
+func TestCompressDbMagic(t *testing.T) {
+	ctx := context.Background()
+	store := NewCompressDb(mem.NewMemDb(), db.DATATYPE_USERDATA)
+	err := store.Connect(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetPrefix(db.DATATYPE_USERDATA)
+	vals := [][]byte{
+		append(append([]byte{}, compressMagic...), []byte("binary data")...),
+		append(append([]byte{}, storedMagic...), []byte("binary data")...),
+		compressMagic,
+	}
+	for i, v := range vals {
+		k := []byte{byte(i)}
+		err = store.Put(ctx, k, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := store.Get(ctx, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(r, v) {
+			t.Fatalf("expected %x, got %x", v, r)
+		}
+	}
+	d, err := store.Range(ctx, nil, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vals {
+		_, r := d.Next(ctx)
+		if !bytes.Equal(r, v) {
+			t.Fatalf("expected %x, got %x", v, r)
+		}
+	}
+}
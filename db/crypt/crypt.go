@@ -0,0 +1,236 @@
+package crypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"git.defalsify.org/vise.git/db"
+	"git.defalsify.org/vise.git/logging"
+)
+
+const (
+	// version of the encrypted value format.
+	cryptVersion = 1
+	// length of version and key id header.
+	headerLen = 5
+)
+
+var (
+	logg logging.Logger = logging.NewVanilla().WithDomain("cryptdb")
+)
+
+var (
+	// ErrInvalid is returned when a stored value is not in the encrypted value format.
+	ErrInvalid = errors.New("invalid encrypted value")
+)
+
+// cryptDb is a Db wrapper that encrypts values of selected datatypes.
+type cryptDb struct {
+	db.Db
+	keys  KeyProvider
+	types uint8
+}
+
+// NewCryptDb creates a wrapper for the Db in the first argument, which encrypts values on Put and decrypts them on Get.
+//
+// By default only values of db.DATATYPE_STATE and db.DATATYPE_USERDATA are encrypted. All other datatypes are passed through unchanged.
+//
+// Values are encrypted with AES-GCM, using the current key of the key provider. The value is stored as:
+//
+// `version (1 byte) | Big-endian uint32 key id | nonce | ciphertext`
+//
+// The key id is used to look up the key on decryption, so keys can be rotated without re-encrypting existing values.
+//
+// The header and the storage key of the value, i.e. the datatype prefix, session id and key, are authenticated as additional data. An encrypted value copied to another key will therefore fail to decrypt.
+func NewCryptDb(store db.Db, keys KeyProvider) *cryptDb {
+	return &cryptDb{
+		Db:    store,
+		keys:  keys,
+		types: db.DATATYPE_STATE | db.DATATYPE_USERDATA,
+	}
+}
+
+// WithTypes sets the datatypes to encrypt, as a bitmask of db.DATATYPE_* values.
+func (cdb *cryptDb) WithTypes(typ uint8) *cryptDb {
+	cdb.types = typ
+	return cdb
+}
+
+// Put implements Db.
+func (cdb *cryptDb) Put(ctx context.Context, key []byte, val []byte) error {
+	var err error
+	if cdb.active() {
+		val, err = cdb.encrypt(ctx, key, val)
+		if err != nil {
+			return err
+		}
+	}
+	return cdb.Db.Put(ctx, key, val)
+}
+
+// Get implements Db.
+func (cdb *cryptDb) Get(ctx context.Context, key []byte) ([]byte, error) {
+	v, err := cdb.Db.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !cdb.active() {
+		return v, nil
+	}
+	v, err = cdb.decrypt(ctx, key, v)
+	if err != nil {
+		return nil, fmt.Errorf("value for key %x: %w", key, err)
+	}
+	return v, nil
+}
+
+// Dump implements Db.
+func (cdb *cryptDb) Dump(ctx context.Context, key []byte) (*db.Dumper, error) {
+	d, err := cdb.Db.Dump(ctx, key)
+	if err != nil || !cdb.active() {
+		return d, err
+	}
+	d = db.NewTransformDumper(ctx, d, cdb.decryptEntry)
+	if d.Err() != nil {
+		return nil, d.Err()
+	}
+	return d, nil
+}
+
+// Range implements Db.
+func (cdb *cryptDb) Range(ctx context.Context, start []byte, end []byte, limit int) (*db.Dumper, error) {
+	d, err := cdb.Db.Range(ctx, start, end, limit)
+	if err != nil || !cdb.active() {
+		return d, err
+	}
+	d = db.NewTransformDumper(ctx, d, cdb.decryptEntry)
+	if d.Err() != nil {
+		return nil, d.Err()
+	}
+	return d, nil
+}
+
+// Base implements Db.
+func (cdb *cryptDb) Base() *db.DbBase {
+	return cdb.Db.Base()
+}
+
+// Lock implements db.Locker.
+//
+// It is a noop if the wrapped Db does not implement db.Locker.
+func (cdb *cryptDb) Lock(ctx context.Context, key []byte) error {
+	locker, ok := cdb.Db.(db.Locker)
+	if !ok {
+		return nil
+	}
+	return locker.Lock(ctx, key)
+}
+
+// Unlock implements db.Locker.
+//
+// It is a noop if the wrapped Db does not implement db.Locker.
+func (cdb *cryptDb) Unlock(ctx context.Context, key []byte) error {
+	locker, ok := cdb.Db.(db.Locker)
+	if !ok {
+		return nil
+	}
+	return locker.Unlock(ctx, key)
+}
+
+// Sweep implements db.Sweeper.
+//
+// Fails if the wrapped Db does not implement db.Sweeper. Wrapped Db implementations that read the age of persisted state from the state itself cannot sweep encrypted state.
+func (cdb *cryptDb) Sweep(ctx context.Context, maxAge time.Duration) (int, error) {
+	sw, ok := cdb.Db.(db.Sweeper)
+	if !ok {
+		return 0, fmt.Errorf("%T does not implement db.Sweeper", cdb.Db)
+	}
+	return sw.Sweep(ctx, maxAge)
+}
+
+// SetSnapshot implements db.Snapshotter.
+//
+// Fails if the wrapped Db does not implement db.Snapshotter.
+func (cdb *cryptDb) SetSnapshot(name string) error {
+	sn, ok := cdb.Db.(db.Snapshotter)
+	if !ok {
+		return fmt.Errorf("%T does not implement db.Snapshotter", cdb.Db)
+	}
+	return sn.SetSnapshot(name)
+}
+
+// true if values in the current prefix should be encrypted.
+func (cdb *cryptDb) active() bool {
+	return cdb.Prefix()&cdb.types > 0
+}
+
+// create the cipher for the given key.
+func newAead(key []byte) (cipher.AEAD, error) {
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(c)
+}
+
+// additional data authenticated with the value stored under the key: the header, followed by the storage key without language.
+func (cdb *cryptDb) additional(header []byte, key []byte) []byte {
+	pfx := cdb.Prefix()
+	k := db.ToDbKey(pfx, cdb.Base().ToSessionKey(pfx, key), nil)
+	return append(append([]byte{}, header...), k...)
+}
+
+// encrypt the value to be stored under the key with the current key of the key provider.
+func (cdb *cryptDb) encrypt(ctx context.Context, key []byte, val []byte) ([]byte, error) {
+	id, k, err := cdb.keys.Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAead(k)
+	if err != nil {
+		return nil, err
+	}
+	r := make([]byte, headerLen+aead.NonceSize(), headerLen+aead.NonceSize()+len(val)+aead.Overhead())
+	r[0] = cryptVersion
+	binary.BigEndian.PutUint32(r[1:headerLen], id)
+	nonce := r[headerLen:]
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	logg.TraceCtxf(ctx, "encrypt", "keyid", id, "len", len(val))
+	return aead.Seal(r, nonce, val, cdb.additional(r[:headerLen], key)), nil
+}
+
+// decrypt the value stored under the key with the key identified in its header.
+func (cdb *cryptDb) decrypt(ctx context.Context, key []byte, val []byte) ([]byte, error) {
+	if len(val) < headerLen || val[0] != cryptVersion {
+		return nil, ErrInvalid
+	}
+	id := binary.BigEndian.Uint32(val[1:headerLen])
+	k, err := cdb.keys.Key(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAead(k)
+	if err != nil {
+		return nil, err
+	}
+	if len(val) < headerLen+aead.NonceSize() {
+		return nil, ErrInvalid
+	}
+	nonce := val[headerLen : headerLen+aead.NonceSize()]
+	logg.TraceCtxf(ctx, "decrypt", "keyid", id, "len", len(val))
+	return aead.Open(nil, nonce, val[headerLen+aead.NonceSize():], cdb.additional(val[:headerLen], key))
+}
+
+// decrypt dumped values.
+func (cdb *cryptDb) decryptEntry(ctx context.Context, key []byte, val []byte) ([]byte, error) {
+	return cdb.decrypt(ctx, key, val)
+}
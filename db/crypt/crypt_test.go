@@ -0,0 +1,265 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"git.defalsify.org/vise.git/db"
+	"git.defalsify.org/vise.git/db/mem"
+)
+
+func TestCryptDb(t *testing.T) {
+	ctx := context.Background()
+	main := mem.NewMemDb()
+	kr := NewKeyRing()
+	err := kr.Add(1, bytes.Repeat([]byte{0x2a}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewCryptDb(main, kr)
+	err = store.Connect(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := []byte("foo")
+	v := []byte("bar")
+	store.SetPrefix(db.DATATYPE_USERDATA)
+	store.SetSession("xyzzy")
+	err = store.Put(ctx, k, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := store.Get(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r, v) {
+		t.Fatalf("expected %x, got %x", v, r)
+	}
+	r, err = main.Get(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(r, v) {
+		t.Fatalf("expected encrypted value, got %x", r)
+	}
+
+	main.SetLock(db.DATATYPE_TEMPLATE, false)
+	store.SetPrefix(db.DATATYPE_TEMPLATE)
+	err = store.Put(ctx, k, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = main.Get(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r, v) {
+		t.Fatalf("expected plain %x, got %x", v, r)
+	}
+}
+
+func TestCryptDbRotate(t *testing.T) {
+	ctx := context.Background()
+	main := mem.NewMemDb()
+	kr := NewKeyRing()
+	err := kr.Add(1, bytes.Repeat([]byte{0x2a}, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewCryptDb(main, kr)
+	err = store.Connect(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetPrefix(db.DATATYPE_STATE)
+	err = store.Put(ctx, []byte("foo"), []byte("inky"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = kr.Add(1, bytes.Repeat([]byte{0x0d}, 32))
+	if err == nil {
+		t.Fatal("expected error adding existing key id")
+	}
+	err = kr.Add(2, bytes.Repeat([]byte{0x0d}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Put(ctx, []byte("bar"), []byte("pinky"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := main.Get(ctx, []byte("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := binary.BigEndian.Uint32(r[1:headerLen])
+	if id != 2 {
+		t.Fatalf("expected key id 2, got %d", id)
+	}
+	r, err = store.Get(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r, []byte("inky")) {
+		t.Fatalf("expected 'inky', got %s", r)
+	}
+
+	d, err := store.Range(ctx, []byte("bar"), []byte("foo"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, r = d.Next(ctx)
+	if !bytes.Equal(r, []byte("pinky")) {
+		t.Fatalf("expected 'pinky', got %s", r)
+	}
+
+	store = NewCryptDb(main, NewKeyRing())
+	_, err = store.Get(ctx, []byte("foo"))
+	if !errors.Is(err, ErrNoKey) {
+		t.Fatalf("expected ErrNoKey, got %v", err)
+	}
+}
+
+func TestCryptDbInvalid(t *testing.T) {
+	ctx := context.Background()
+	main := mem.NewMemDb()
+	kr := NewKeyRing()
+	err := kr.Add(1, []byte("tooshort"))
+	if err == nil {
+		t.Fatal("expected error on invalid key length")
+	}
+	err = kr.Add(1, bytes.Repeat([]byte{0x2a}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewCryptDb(main, kr)
+	err = store.Connect(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	main.SetPrefix(db.DATATYPE_USERDATA)
+	err = main.Put(ctx, []byte("foo"), []byte("plain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Get(ctx, []byte("foo"))
+	if !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected ErrInvalid, got %v", err)
+	}
+
+	r, err := store.encrypt(ctx, []byte("foo"), []byte("plain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r[len(r)-1] ^= 0xff
+	err = main.Put(ctx, []byte("foo"), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Get(ctx, []byte("foo"))
+	if err == nil {
+		t.Fatal("expected error on tampered value")
+	}
+}
+
+func TestCryptDbKeyBound(t *testing.T) {
+	ctx := context.Background()
+	main := mem.NewMemDb()
+	kr := NewKeyRing()
+	err := kr.Add(1, bytes.Repeat([]byte{0x2a}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewCryptDb(main, kr)
+	err = store.Connect(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetPrefix(db.DATATYPE_USERDATA)
+	store.SetSession("xyzzy")
+	err = store.Put(ctx, []byte("foo"), []byte("inky"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := main.Get(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = main.Put(ctx, []byte("bar"), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Get(ctx, []byte("bar"))
+	if err == nil {
+		t.Fatal("expected error on value copied to other key")
+	}
+	_, err = store.Range(ctx, nil, nil, 0)
+	if err == nil {
+		t.Fatal("expected error on range with value copied to other key")
+	}
+
+	store.SetSession("plugh")
+	err = main.Put(ctx, []byte("foo"), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Get(ctx, []byte("foo"))
+	if err == nil {
+		t.Fatal("expected error on value copied to other session")
+	}
+
+	store.SetPrefix(db.DATATYPE_STATE)
+	err = main.Put(ctx, []byte("foo"), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Get(ctx, []byte("foo"))
+	if err == nil {
+		t.Fatal("expected error on value copied to other datatype")
+	}
+}
+
+func TestCryptDbForward(t *testing.T) {
+	ctx := context.Background()
+	kr := NewKeyRing()
+	err := kr.Add(1, bytes.Repeat([]byte{0x2a}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewCryptDb(mem.NewMemDb(), kr)
+	err = store.Connect(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetPrefix(db.DATATYPE_USERDATA)
+	err = store.Put(ctx, []byte("foo"), []byte("inky"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := store.Sweep(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != 1 {
+		t.Fatalf("expected 1 swept entry, got %d", c)
+	}
+	err = store.SetSnapshot("v1")
+	if err == nil {
+		t.Fatal("expected error setting snapshot on db without snapshots")
+	}
+	err = store.Lock(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Unlock(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,82 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrNoKey is returned when no key exists for a key id.
+	ErrNoKey = errors.New("no such key")
+)
+
+// KeyProvider supplies the encryption keys for cryptDb.
+//
+// Keys must be 16, 24 or 32 bytes long, to select AES-128, AES-192 or AES-256.
+type KeyProvider interface {
+	// Current returns the key id and key to use for encrypting new values.
+	Current(ctx context.Context) (uint32, []byte, error)
+	// Key returns the key for the given key id, used for decrypting values.
+	//
+	// Must return all keys that may have been used by Current, for as long as values encrypted with them are stored.
+	Key(ctx context.Context, id uint32) ([]byte, error)
+}
+
+// KeyRing is an in-memory KeyProvider.
+//
+// The key added last is used for encryption.
+type KeyRing struct {
+	mu      sync.RWMutex
+	keys    map[uint32][]byte
+	current uint32
+}
+
+// NewKeyRing creates a new KeyRing with no keys.
+func NewKeyRing() *KeyRing {
+	return &KeyRing{
+		keys: make(map[uint32][]byte),
+	}
+}
+
+// Add adds a key under the given key id, and makes it the current key.
+//
+// Errors if the key length is invalid, or if the key id is already in use.
+func (kr *KeyRing) Add(id uint32, key []byte) error {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return fmt.Errorf("invalid key length: %d", len(key))
+	}
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if _, ok := kr.keys[id]; ok {
+		return fmt.Errorf("key id %d already exists", id)
+	}
+	kr.keys[id] = append([]byte{}, key...)
+	kr.current = id
+	return nil
+}
+
+// Current implements KeyProvider.
+func (kr *KeyRing) Current(ctx context.Context) (uint32, []byte, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	k, ok := kr.keys[kr.current]
+	if !ok {
+		return 0, nil, ErrNoKey
+	}
+	return kr.current, k, nil
+}
+
+// Key implements KeyProvider.
+func (kr *KeyRing) Key(ctx context.Context, id uint32) ([]byte, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	k, ok := kr.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrNoKey, id)
+	}
+	return k, nil
+}
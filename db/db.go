@@ -5,12 +5,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"git.defalsify.org/vise.git/lang"
 )
 
 const (
-	safeLock = DATATYPE_BIN | DATATYPE_MENU | DATATYPE_TEMPLATE | DATATYPE_STATICLOAD
+	safeLock = DATATYPE_BIN | DATATYPE_MENU | DATATYPE_TEMPLATE | DATATYPE_STATICLOAD | DATATYPE_SRCMAP
 )
 
 const (
@@ -28,10 +29,13 @@ const (
 	DATATYPE_STATE = 16
 	// Application data
 	DATATYPE_USERDATA = 32
+	// Source map for bytecode
+	DATATYPE_SRCMAP = 64
 )
 
 const (
-	datatype_sessioned_threshold = DATATYPE_STATICLOAD
+	// datatypes shared by all sessions. Keys of all other datatypes are prefixed with the session id.
+	datatype_sessionless = DATATYPE_BIN | DATATYPE_MENU | DATATYPE_TEMPLATE | DATATYPE_STATICLOAD | DATATYPE_SRCMAP
 )
 
 // Db abstracts all data storage and retrieval as a key-value store
@@ -52,6 +56,10 @@ type Db interface {
 	//
 	// Errors if the value could not be stored.
 	Put(ctx context.Context, key []byte, val []byte) error
+	// Delete removes the value stored under a key.
+	//
+	// Errors if the key does not exist, or if the value could not be removed.
+	Delete(ctx context.Context, key []byte) error
 	// SetPrefix sets the storage context prefix to use for consecutive Get and Put operations.
 	SetPrefix(pfx uint8)
 	// SetSession sets the session context to use for consecutive Get and Put operations.
@@ -77,6 +85,14 @@ type Db interface {
 	Prefix() uint8
 	// Dump generates an iterable dump of all keys matching the given byte prefix.
 	Dump(context.Context, []byte) (*Dumper, error)
+	// Range generates an iterable of the keys and values in the current prefix and session context, ordered by key.
+	//
+	// Iteration starts at the key start, and stops before the key end. If end is nil, iteration continues to the last key.
+	//
+	// If limit is greater than 0, at most limit entries are returned.
+	//
+	// Keys are returned as given to Put. An empty range is not an error.
+	Range(ctx context.Context, start []byte, end []byte, limit int) (*Dumper, error)
 	// DecodeKey decodes the database specific key used for internal storage to the original key given by the caller.
 	DecodeKey(ctx context.Context, key []byte) ([]byte, error)
 	// Start creates a new database transaction. Only relevant for transactional databases.
@@ -91,6 +107,76 @@ type Db interface {
 	Base() *DbBase
 }
 
+// Locker is an optional interface for Db implementations that can hold an exclusive lock on a key.
+//
+// The key is resolved in the current prefix and session context, like for Get and Put.
+//
+// Lock blocks until the lock is acquired, or the context is done. Every successful Lock must be followed by Unlock.
+//
+// The lock is advisory; it does not prevent Get or Put by callers that do not use it.
+type Locker interface {
+	// Lock acquires an exclusive lock on the key.
+	Lock(ctx context.Context, key []byte) error
+	// Unlock releases the lock on the key.
+	Unlock(ctx context.Context, key []byte) error
+}
+
+// Sweeper is an optional interface for Db implementations that can delete entries by age.
+type Sweeper interface {
+	// Sweep deletes all entries of the current prefix, in all sessions, that have not been written to for the duration of maxAge.
+	//
+	// It returns the number of entries deleted.
+	//
+	// Errors if the current prefix is locked.
+	Sweep(ctx context.Context, maxAge time.Duration) (int, error)
+}
+
+// Snapshotter is an optional interface for Db implementations that can keep multiple named snapshots of data side by side in the same backend.
+//
+// It is typically used for resource data, so that a new version can be written while the previous one is still in use.
+type Snapshotter interface {
+	// SetSnapshot selects the named snapshot for all operations. It must be called before Connect.
+	//
+	// Errors if the name is not valid according to CheckSnapshotName.
+	SetSnapshot(name string) error
+}
+
+// CheckSnapshotName returns an error if the name cannot be used as a snapshot name.
+//
+// Valid names are 1 to 32 characters long, and consist only of the characters a-z, 0-9 and _.
+func CheckSnapshotName(name string) error {
+	if len(name) == 0 || len(name) > 32 {
+		return fmt.Errorf("invalid snapshot name length: %d", len(name))
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' {
+			return fmt.Errorf("invalid character in snapshot name: %q", c)
+		}
+	}
+	return nil
+}
+
+// storage context set by WithKeyContext.
+type keyContext struct {
+	pfx uint8
+	sid []byte
+	ln  *lang.Language
+}
+
+type keyContextKey struct{}
+
+// WithKeyContext returns a copy of the context, in which keys are resolved in the given prefix, session and language context instead of that set on the Db.
+//
+// It allows a Db shared by concurrent callers to resolve keys without the caller setting the storage context on the Db first.
+func WithKeyContext(ctx context.Context, pfx uint8, sessionId string, ln *lang.Language) context.Context {
+	kc := &keyContext{
+		pfx: pfx,
+		sid: toSid(sessionId),
+		ln:  ln,
+	}
+	return context.WithValue(ctx, keyContextKey{}, kc)
+}
+
 // LookupKey encapsulates two keys for a database entry; one for the default language, the other for the language in the context at which the LookupKey was generated.
 type LookupKey struct {
 	Default     []byte
@@ -195,11 +281,15 @@ func (bd *DbBase) SetLanguage(ln *lang.Language) {
 
 // SetSession implements the Db interface.
 func (bd *DbBase) SetSession(sessionId string) {
+	bd.baseDb.sid = toSid(sessionId)
+}
+
+// session part of the storage key.
+func toSid(sessionId string) []byte {
 	if sessionId == "" {
-		bd.baseDb.sid = []byte{}
-	} else {
-		bd.baseDb.sid = append([]byte(sessionId), 0x2E)
+		return []byte{}
 	}
+	return append([]byte(sessionId), 0x2E)
 }
 
 // SetLock implements the Db interface.
@@ -229,15 +319,44 @@ func (bd *DbBase) CheckPut() bool {
 //
 // If the key in pfx does not use session, the key is returned unchanged.
 func (bd *DbBase) ToSessionKey(pfx uint8, key []byte) []byte {
+	return toSessionKey(pfx, bd.sid, key)
+}
+
+func toSessionKey(pfx uint8, sid []byte, key []byte) []byte {
 	var b []byte
-	if pfx > datatype_sessioned_threshold || pfx == DATATYPE_UNKNOWN {
-		b = append([]byte(bd.sid), key...)
+	if pfx&^datatype_sessionless > 0 || pfx == DATATYPE_UNKNOWN {
+		b = append([]byte(sid), key...)
 	} else {
 		b = key
 	}
 	return b
 }
 
+// KeyPrefix returns the part of the storage key shared by all keys in the current prefix and session context.
+func (bd *DbBase) KeyPrefix() []byte {
+	pfx := bd.baseDb.pfx
+	return ToDbKey(pfx, bd.ToSessionKey(pfx, []byte{}), nil)
+}
+
+// RangeKeys returns the storage keys bounding a Range in the current prefix and session context.
+//
+// The lower bound is inclusive, and the upper bound is exclusive.
+func (bd *DbBase) RangeKeys(start []byte, end []byte) ([]byte, []byte) {
+	base := bd.KeyPrefix()
+	lo := append(append([]byte{}, base...), start...)
+	if end != nil {
+		return lo, append(append([]byte{}, base...), end...)
+	}
+	hi := append([]byte{}, base...)
+	for i := len(hi) - 1; i >= 0; i-- {
+		hi[i] += 1
+		if hi[i] != 0 {
+			return lo, hi[:i+1]
+		}
+	}
+	return lo, nil
+}
+
 // FromSessionKey reverses the effect of ToSessionKey.
 func (bd *DbBase) FromSessionKey(key []byte) ([]byte, error) {
 	if len(bd.baseDb.sid) == 0 {
@@ -251,21 +370,32 @@ func (bd *DbBase) FromSessionKey(key []byte) ([]byte, error) {
 
 // ToKey creates a DbKey within the current session context.
 //
+// If the context has been created with WithKeyContext, the storage context given there is used instead.
+//
 // TODO: hard to read, clean up
 func (bd *DbBase) ToKey(ctx context.Context, key []byte) (LookupKey, error) {
 	var ln *lang.Language
 	var lk LookupKey
 	//var b []byte
 	db := bd.baseDb
-	if db.known && db.pfx == DATATYPE_UNKNOWN {
+	kc, ok := ctx.Value(keyContextKey{}).(*keyContext)
+	if !ok {
+		kc = &keyContext{
+			pfx: db.pfx,
+			sid: db.sid,
+			ln:  db.lang,
+		}
+	}
+	pfx, sid, dln := kc.pfx, kc.sid, kc.ln
+	if db.known && pfx == DATATYPE_UNKNOWN {
 		return lk, errors.New("datatype prefix cannot be UNKNOWN")
 	}
 	//b := ToSessionKey(db.pfx, db.sid, key)
-	b := bd.ToSessionKey(db.pfx, key)
-	lk.Default = ToDbKey(db.pfx, b, nil)
-	if db.pfx&(DATATYPE_MENU|DATATYPE_TEMPLATE|DATATYPE_STATICLOAD) > 0 {
-		if db.lang != nil {
-			ln = db.lang
+	b := toSessionKey(pfx, sid, key)
+	lk.Default = ToDbKey(pfx, b, nil)
+	if pfx&(DATATYPE_MENU|DATATYPE_TEMPLATE|DATATYPE_STATICLOAD) > 0 {
+		if dln != nil {
+			ln = dln
 		} else {
 			lo, ok := ctx.Value("Language").(lang.Language)
 			if ok {
@@ -274,10 +404,10 @@ func (bd *DbBase) ToKey(ctx context.Context, key []byte) (LookupKey, error) {
 		}
 		logg.TraceCtxf(ctx, "language using", "ln", ln)
 		if ln != nil {
-			lk.Translation = ToDbKey(db.pfx, b, ln)
+			lk.Translation = ToDbKey(pfx, b, ln)
 		}
 	}
-	logg.TraceCtxf(ctx, "made db lookup key", "lk", lk.Default, "pfx", db.pfx)
+	logg.TraceCtxf(ctx, "made db lookup key", "lk", lk.Default, "pfx", pfx)
 	return lk, nil
 }
 
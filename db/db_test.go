@@ -31,6 +31,23 @@ func TestDbBase(t *testing.T) {
 	}
 }
 
+func TestDbSessionKey(t *testing.T) {
+	store := NewDbBase()
+	store.SetSession("xyzzy")
+	for _, pfx := range []uint8{DATATYPE_UNKNOWN, DATATYPE_STATE, DATATYPE_USERDATA, DATATYPE_USERDATA + 1} {
+		k := store.ToSessionKey(pfx, []byte("foo"))
+		if !bytes.Equal(k, []byte("xyzzy.foo")) {
+			t.Fatalf("expected session key for prefix %d, got %s", pfx, k)
+		}
+	}
+	for _, pfx := range []uint8{DATATYPE_BIN, DATATYPE_MENU, DATATYPE_TEMPLATE, DATATYPE_STATICLOAD, DATATYPE_SRCMAP} {
+		k := store.ToSessionKey(pfx, []byte("foo"))
+		if !bytes.Equal(k, []byte("foo")) {
+			t.Fatalf("expected no session key for prefix %d, got %s", pfx, k)
+		}
+	}
+}
+
 func TestDbKeyLanguage(t *testing.T) {
 	ctx := context.Background()
 	store := NewDbBase()
@@ -94,3 +111,43 @@ func TestDbKeyNoLanguage(t *testing.T) {
 	}
 
 }
+
+func TestDbKeyContext(t *testing.T) {
+	ctx := context.Background()
+	store := NewDbBase()
+	store.SetPrefix(DATATYPE_USERDATA)
+	store.SetSession("xyzzy")
+
+	ln, err := lang.LanguageFromCode("nor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kctx := WithKeyContext(ctx, DATATYPE_TEMPLATE, "plugh", &ln)
+	lk, err := store.ToKey(kctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(lk.Default, append([]byte{DATATYPE_TEMPLATE}, []byte("foo")...)) {
+		t.Fatalf("unexpected default key: %x", lk.Default)
+	}
+	if !bytes.Equal(lk.Translation, append([]byte{DATATYPE_TEMPLATE}, []byte("foo_nor")...)) {
+		t.Fatalf("unexpected translation key: %x", lk.Translation)
+	}
+
+	kctx = WithKeyContext(ctx, DATATYPE_STATE, "plugh", nil)
+	lk, err = store.ToKey(kctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(lk.Default, append([]byte{DATATYPE_STATE}, []byte("plugh.foo")...)) {
+		t.Fatalf("unexpected session key: %x", lk.Default)
+	}
+
+	lk, err = store.ToKey(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(lk.Default, append([]byte{DATATYPE_USERDATA}, []byte("xyzzy.foo")...)) {
+		t.Fatalf("expected db storage context without key context, got: %x", lk.Default)
+	}
+}
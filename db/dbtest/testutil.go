@@ -7,7 +7,9 @@ import (
 	"errors"
 	"fmt"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"git.defalsify.org/vise.git/db"
 	"git.defalsify.org/vise.git/lang"
@@ -47,6 +49,7 @@ var (
 		db.DATATYPE_STATICLOAD: "staticload",
 		db.DATATYPE_STATE:      "state",
 		db.DATATYPE_USERDATA:   "udata",
+		db.DATATYPE_SRCMAP:     "srcmap",
 	}
 )
 
@@ -191,6 +194,8 @@ func generateSessionTestVectors() testVector {
 	tv.add(db.DATATYPE_STATE, "foo", "plugh", "sue", "plugh", "")
 	tv.add(db.DATATYPE_USERDATA, "foo", "itchy", "", "itchy", "")
 	tv.add(db.DATATYPE_USERDATA, "foo", "scratchy", "poochie", "scratchy", "")
+	tv.add(db.DATATYPE_SRCMAP, "foo", "0\troot.vis:1\tHALT", "", "0\troot.vis:2\tHALT", "")
+	tv.add(db.DATATYPE_SRCMAP, "foo", "0\troot.vis:2\tHALT", "sue", "0\troot.vis:2\tHALT", "")
 	return tv
 }
 
@@ -299,9 +304,274 @@ func runTests(t *testing.T, ctx context.Context, db db.Db) error {
 		}
 	}
 
+	r := t.Run("TestDeleteRange", func(t *testing.T) {
+		err := runDeleteRangeTest(ctx, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if !r {
+		return errors.New("subtest fail")
+	}
+	return nil
+}
+
+// collect the keys and values of a range.
+func rangeOf(ctx context.Context, store db.Db, start []byte, end []byte, limit int) (string, error) {
+	var r []string
+	o, err := store.Range(ctx, start, end, limit)
+	if err != nil {
+		return "", err
+	}
+	defer o.Close()
+	for k, v := o.Next(ctx); k != nil; k, v = o.Next(ctx) {
+		r = append(r, string(k)+"="+string(v))
+	}
+	return strings.Join(r, ","), nil
+}
+
+func runDeleteRangeTest(ctx context.Context, store db.Db) error {
+	store.SetLock(db.DATATYPE_STATE, false)
+	store.SetLock(db.DATATYPE_USERDATA, false)
+	defer store.SetLock(db.DATATYPE_STATE, true)
+	defer store.SetLock(db.DATATYPE_USERDATA, true)
+	store.SetLanguage(nil)
+	store.SetPrefix(db.DATATYPE_STATE)
+	store.SetSession("rangetest")
+	err := store.Put(ctx, []byte("b"), []byte("state"))
+	if err != nil {
+		return err
+	}
+	store.SetPrefix(db.DATATYPE_USERDATA)
+	store.SetSession("rangetestother")
+	err = store.Put(ctx, []byte("b"), []byte("other"))
+	if err != nil {
+		return err
+	}
+	store.SetSession("rangetest")
+	for _, k := range []string{"c", "a", "e", "b", "d"} {
+		err = store.Put(ctx, []byte(k), []byte(strings.ToUpper(k)))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, v := range []struct {
+		start  string
+		end    string
+		limit  int
+		expect string
+	}{
+		{"", "", 0, "a=A,b=B,c=C,d=D,e=E"},
+		{"b", "d", 0, "b=B,c=C"},
+		{"b", "", 2, "b=B,c=C"},
+		{"bb", "", 0, "c=C,d=D,e=E"},
+		{"x", "", 0, ""},
+	} {
+		var end []byte
+		if v.end != "" {
+			end = []byte(v.end)
+		}
+		r, err := rangeOf(ctx, store, []byte(v.start), end, v.limit)
+		if err != nil {
+			return err
+		}
+		if r != v.expect {
+			return fmt.Errorf("range %s-%s limit %d: expected '%s', got '%s'", v.start, v.end, v.limit, v.expect, r)
+		}
+	}
+
+	err = store.Delete(ctx, []byte("c"))
+	if err != nil {
+		return err
+	}
+	_, err = store.Get(ctx, []byte("c"))
+	if !db.IsNotFound(err) {
+		return fmt.Errorf("expected deleted key not found, got %v", err)
+	}
+	err = store.Delete(ctx, []byte("c"))
+	if !db.IsNotFound(err) {
+		return fmt.Errorf("expected not found deleting missing key, got %v", err)
+	}
+	r, err := rangeOf(ctx, store, []byte{}, nil, 0)
+	if err != nil {
+		return err
+	}
+	if r != "a=A,b=B,d=D,e=E" {
+		return fmt.Errorf("expected range without deleted key, got '%s'", r)
+	}
+
+	o, err := store.Range(ctx, []byte{}, nil, 0)
+	if err != nil {
+		return err
+	}
+	var keys [][]byte
+	for k, _ := o.Next(ctx); k != nil; k, _ = o.Next(ctx) {
+		keys = append(keys, k)
+	}
+	o.Close()
+	for _, k := range keys {
+		err = store.Delete(ctx, k)
+		if err != nil {
+			return err
+		}
+	}
+	r, err = rangeOf(ctx, store, []byte{}, nil, 0)
+	if err != nil {
+		return err
+	}
+	if r != "" {
+		return fmt.Errorf("expected empty range after delete, got '%s'", r)
+	}
+
+	store.SetSession("rangetestother")
+	_, err = store.Get(ctx, []byte("b"))
+	if err != nil {
+		return fmt.Errorf("expected key in other session to remain: %v", err)
+	}
+	store.SetPrefix(db.DATATYPE_STATE)
+	store.SetSession("rangetest")
+	_, err = store.Get(ctx, []byte("b"))
+	if err != nil {
+		return fmt.Errorf("expected key in other prefix to remain: %v", err)
+	}
+
+	store.SetPrefix(db.DATATYPE_BIN)
+	err = store.Delete(ctx, []byte("b"))
+	if err == nil {
+		return errors.New("expected error deleting from locked prefix")
+	}
 	return nil
 }
 
 func RunTests(t *testing.T, ctx context.Context, db db.Db) error {
 	return runTests(t, ctx, db)
 }
+
+// RunLockTests verifies the db.Locker implementation of a Db.
+func RunLockTests(t *testing.T, ctx context.Context, store db.Db) error {
+	locker, ok := store.(db.Locker)
+	if !ok {
+		return fmt.Errorf("%T does not implement db.Locker", store)
+	}
+	store.SetPrefix(db.DATATYPE_USERDATA)
+	store.SetSession("xyzzy")
+	k := []byte("foo")
+	err := locker.Lock(ctx, k)
+	if err != nil {
+		return err
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, time.Millisecond*50)
+	defer cancel()
+	err = locker.Lock(ctxTimeout, k)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("expected lock timeout, got %v", err)
+	}
+
+	err = locker.Lock(ctx, []byte("bar"))
+	if err != nil {
+		return err
+	}
+	err = locker.Unlock(ctx, []byte("bar"))
+	if err != nil {
+		return err
+	}
+
+	store.SetSession("plugh")
+	err = locker.Lock(ctx, k)
+	if err != nil {
+		return err
+	}
+	err = locker.Unlock(ctx, k)
+	if err != nil {
+		return err
+	}
+
+	store.SetSession("xyzzy")
+	c := make(chan error)
+	go func() {
+		c <- locker.Lock(ctx, k)
+	}()
+	time.Sleep(time.Millisecond * 10)
+	err = locker.Unlock(ctx, k)
+	if err != nil {
+		return err
+	}
+	err = <-c
+	if err != nil {
+		return err
+	}
+	err = locker.Unlock(ctx, k)
+	if err != nil {
+		return err
+	}
+	err = locker.Unlock(ctx, k)
+	if err == nil {
+		return errors.New("expected error unlocking key that is not locked")
+	}
+	return nil
+}
+
+// RunSweepTests verifies the db.Sweeper implementation of a Db.
+func RunSweepTests(t *testing.T, ctx context.Context, store db.Db) error {
+	sweeper, ok := store.(db.Sweeper)
+	if !ok {
+		return fmt.Errorf("%T does not implement db.Sweeper", store)
+	}
+	for _, v := range []struct {
+		pfx     uint8
+		session string
+		k       string
+	}{
+		{db.DATATYPE_USERDATA, "foo", "old"},
+		{db.DATATYPE_USERDATA, "bar", "old"},
+		{db.DATATYPE_STATE, "foo", "old"},
+	} {
+		store.SetPrefix(v.pfx)
+		store.SetSession(v.session)
+		err := store.Put(ctx, []byte(v.k), []byte("xyzzy"))
+		if err != nil {
+			return err
+		}
+	}
+	time.Sleep(time.Millisecond * 50)
+	store.SetPrefix(db.DATATYPE_USERDATA)
+	store.SetSession("foo")
+	err := store.Put(ctx, []byte("new"), []byte("plugh"))
+	if err != nil {
+		return err
+	}
+
+	c, err := sweeper.Sweep(ctx, time.Millisecond*25)
+	if err != nil {
+		return err
+	}
+	if c != 2 {
+		return fmt.Errorf("expected 2 swept entries, got %d", c)
+	}
+	_, err = store.Get(ctx, []byte("new"))
+	if err != nil {
+		return err
+	}
+	for _, v := range []string{"foo", "bar"} {
+		store.SetSession(v)
+		_, err = store.Get(ctx, []byte("old"))
+		if !db.IsNotFound(err) {
+			return fmt.Errorf("expected swept entry in session %s, got %v", v, err)
+		}
+	}
+	store.SetPrefix(db.DATATYPE_STATE)
+	store.SetSession("foo")
+	_, err = store.Get(ctx, []byte("old"))
+	if err != nil {
+		return err
+	}
+
+	store.SetPrefix(db.DATATYPE_BIN)
+	_, err = sweeper.Sweep(ctx, 0)
+	if err == nil {
+		return errors.New("expected error sweeping locked prefix")
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"fmt"
 )
 
 type DumperFunc func(ctx context.Context) ([]byte, []byte)
@@ -12,6 +13,7 @@ type Dumper struct {
 	cfn    CloseFunc
 	k      []byte
 	v      []byte
+	err    error
 	nexted bool
 }
 
@@ -48,9 +50,40 @@ func (d *Dumper) Next(ctx context.Context) ([]byte, []byte) {
 	return k, v
 }
 
+// Err returns the error that stopped the iteration, if any.
+//
+// It should be checked after Next has returned a nil key.
+func (d *Dumper) Err() error {
+	return d.err
+}
+
 func (d *Dumper) Close() error {
 	if d.cfn != nil {
 		return d.cfn()
 	}
 	return nil
 }
+
+// NewTransformDumper creates a Dumper that passes the values of another Dumper through fn.
+//
+// Iteration stops if fn returns an error, which is then returned by Err of the new Dumper. The Close of the wrapped Dumper is preserved.
+//
+// It is used by Db wrappers that change the stored representation of values.
+func NewTransformDumper(ctx context.Context, d *Dumper, fn func(context.Context, []byte, []byte) ([]byte, error)) *Dumper {
+	r := &Dumper{}
+	r.fn = func(ctx context.Context) ([]byte, []byte) {
+		k, v := d.Next(ctx)
+		if k == nil {
+			r.err = d.Err()
+			return nil, nil
+		}
+		v, err := fn(ctx, k, v)
+		if err != nil {
+			r.err = fmt.Errorf("value for key %x: %w", k, err)
+			return nil, nil
+		}
+		return k, v
+	}
+	k, v := r.fn(ctx)
+	return r.WithClose(d.Close).WithFirst(k, v)
+}
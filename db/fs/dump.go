@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"os"
+	"strings"
 
 	"git.defalsify.org/vise.git/db"
 )
@@ -22,10 +23,11 @@ func (fdb *fsDb) Dump(ctx context.Context, key []byte) (*db.Dumper, error) {
 	var err error
 	key = append([]byte{fdb.Prefix()}, key...)
 	fdb.matchPrefix = key
-	fdb.elements, err = os.ReadDir(fdb.dir)
+	fdb.elements, err = fdb.readDir()
 	if err != nil {
 		return nil, err
 	}
+	fdb.elements = skipLocks(fdb.elements)
 
 	logg.TraceCtxf(ctx, "have elements in dir", "n", len(fdb.elements))
 
@@ -85,3 +87,15 @@ func (fdb *fsDb) dumpFunc(ctx context.Context) ([]byte, []byte) {
 	}
 	return nil, nil
 }
+
+// remove lock files from the directory listing.
+func skipLocks(elements []os.DirEntry) []os.DirEntry {
+	var r []os.DirEntry
+	for _, v := range elements {
+		if strings.HasSuffix(v.Name(), lockSuffix) {
+			continue
+		}
+		r = append(r, v)
+	}
+	return r
+}
@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"errors"
@@ -9,10 +10,26 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"time"
 
 	"git.defalsify.org/vise.git/db"
 )
 
+const (
+	lockSuffix = ".lock"
+)
+
+var (
+	// LockInterval is the time to wait between attempts to acquire a lock held by someone else.
+	LockInterval = time.Millisecond * 10
+	// LockMaxAge is the age after which a lock file is considered left behind by a crashed process. It is then removed by the next attempt to acquire the lock.
+	//
+	// It must be longer than any lock is held. If set to 0, lock files are never removed.
+	LockMaxAge = time.Minute
+	// ErrReadOnly is returned when modifying a Db backed by an fs.FS.
+	ErrReadOnly = errors.New("fs.FS backed db is read-only")
+)
+
 // holds string (filepath) versions of LookupKey
 type fsLookupKey struct {
 	Default     string
@@ -26,6 +43,8 @@ type fsDb struct {
 	elements    []os.DirEntry
 	matchPrefix []byte
 	binary      bool
+	snapshot    string
+	fsys        fs.FS
 }
 
 // NewFsDb creates a filesystem backed Db implementation.
@@ -46,6 +65,31 @@ func (fdb *fsDb) WithBinary() *fsDb {
 	return fdb
 }
 
+// WithFS makes the Db read from the given fs.FS instead of the local filesystem, for example one created with the go:embed directive. When embedding, use the "all:" prefix, since files starting with "_", such as those of the "_catch" node, are otherwise left out.
+//
+// The connection string given to Connect is then the directory within the fs.FS. An empty connection string is the same as ".".
+//
+// The Db is read-only; Put, Delete, Lock and Sweep will fail with ErrReadOnly.
+func (fdb *fsDb) WithFS(fsys fs.FS) *fsDb {
+	fdb.fsys = fsys
+	return fdb
+}
+
+// SetSnapshot implements db.Snapshotter.
+//
+// The snapshot is stored in a subdirectory with the snapshot name, below the directory given to Connect.
+func (fdb *fsDb) SetSnapshot(name string) error {
+	if fdb.dir != "" {
+		return errors.New("snapshot must be set before connect")
+	}
+	err := db.CheckSnapshotName(name)
+	if err != nil {
+		return err
+	}
+	fdb.snapshot = name
+	return nil
+}
+
 // String implements the string interface.
 func (fdb *fsDb) String() string {
 	return "fsdb: " + fdb.dir
@@ -57,6 +101,12 @@ func (fdb *fsDb) Connect(ctx context.Context, connStr string) error {
 		logg.WarnCtxf(ctx, "already connected", "conn", fdb.dir)
 		return nil
 	}
+	if fdb.snapshot != "" {
+		connStr = path.Join(connStr, fdb.snapshot)
+	}
+	if fdb.fsys != nil {
+		return fdb.connectFS(ctx, connStr)
+	}
 	err := os.MkdirAll(connStr, 0700)
 	if err != nil {
 		return err
@@ -95,7 +145,7 @@ func (fdb *fsDb) DecodeKey(ctx context.Context, key []byte) ([]byte, error) {
 
 // Get implements the Db interface.
 func (fdb *fsDb) Get(ctx context.Context, key []byte) ([]byte, error) {
-	var f *os.File
+	var f fs.File
 	lk, err := fdb.ToKey(ctx, key)
 	if err != nil {
 		return nil, err
@@ -114,7 +164,7 @@ func (fdb *fsDb) Get(ctx context.Context, key []byte) ([]byte, error) {
 			continue
 		}
 		logg.TraceCtxf(ctx, "trying fs get", "i", i, "key", key, "path", fp)
-		f, err = os.Open(fp)
+		f, err = fdb.open(fp)
 		if err == nil {
 			break
 		}
@@ -135,6 +185,9 @@ func (fdb *fsDb) Get(ctx context.Context, key []byte) ([]byte, error) {
 
 // Put implements the Db interface.
 func (fdb *fsDb) Put(ctx context.Context, key []byte, val []byte) error {
+	if fdb.fsys != nil {
+		return ErrReadOnly
+	}
 	if !fdb.CheckPut() {
 		return errors.New("unsafe put and safety set")
 	}
@@ -157,11 +210,243 @@ func (fdb *fsDb) Put(ctx context.Context, key []byte, val []byte) error {
 	return ioutil.WriteFile(flk.Default, val, 0600)
 }
 
+// Delete implements the Db interface.
+func (fdb *fsDb) Delete(ctx context.Context, key []byte) error {
+	if fdb.fsys != nil {
+		return ErrReadOnly
+	}
+	if !fdb.CheckPut() {
+		return errors.New("unsafe delete and safety set")
+	}
+	lk, err := fdb.ToKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	flk, err := fdb.pathFor(ctx, &lk)
+	if err != nil {
+		return err
+	}
+	fp := flk.Default
+	if flk.Translation != "" {
+		fp = flk.Translation
+	}
+	logg.TraceCtxf(ctx, "fs delete", "key", key, "path", fp)
+	err = os.Remove(fp)
+	if errors.Is(err, fs.ErrNotExist) {
+		return db.NewErrNotFound(key)
+	}
+	return err
+}
+
+// Range implements the Db interface.
+func (fdb *fsDb) Range(ctx context.Context, start []byte, end []byte, limit int) (*db.Dumper, error) {
+	var keys [][]byte
+	var vals [][]byte
+	elements, err := fdb.readDir()
+	if err != nil {
+		return nil, err
+	}
+	base := fdb.KeyPrefix()
+	for _, v := range skipLocks(elements) {
+		if v.IsDir() {
+			continue
+		}
+		k := []byte(v.Name())
+		k[0] -= 0x30
+		if !bytes.HasPrefix(k, base) {
+			continue
+		}
+		k, err = fdb.DecodeKey(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	keys = db.FilterRange(keys, start, end, limit)
+	for _, k := range keys {
+		v, err := fdb.Get(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	logg.TraceCtxf(ctx, "fs range", "start", start, "end", end, "count", len(keys))
+	return db.NewSliceDumper(keys, vals), nil
+}
+
 // Close implements the Db interface.
 func (fdb *fsDb) Close(ctx context.Context) error {
 	return nil
 }
 
+// Lock implements the db.Locker interface.
+//
+// The lock is held by the existence of a lock file next to the file of the key. The lock file contains the process id of the owner, and the time the lock was acquired.
+//
+// Lock files older than LockMaxAge are assumed to be left behind by a crashed process, and are removed.
+func (fdb *fsDb) Lock(ctx context.Context, key []byte) error {
+	if fdb.fsys != nil {
+		return ErrReadOnly
+	}
+	fp, err := fdb.lockPathFor(ctx, key)
+	if err != nil {
+		return err
+	}
+	for {
+		f, err := os.OpenFile(fp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			logg.TraceCtxf(ctx, "fs lock", "key", key, "path", fp)
+			_, err = fmt.Fprintf(f, "%d %d\n", os.Getpid(), time.Now().Unix())
+			if err != nil {
+				f.Close()
+				os.Remove(fp)
+				return err
+			}
+			return f.Close()
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+		err = removeStaleLock(ctx, fp)
+		if err != nil {
+			return err
+		}
+		select {
+		case <-time.After(LockInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Unlock implements the db.Locker interface.
+func (fdb *fsDb) Unlock(ctx context.Context, key []byte) error {
+	if fdb.fsys != nil {
+		return ErrReadOnly
+	}
+	fp, err := fdb.lockPathFor(ctx, key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(fp)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("key not locked: %x", key)
+	}
+	logg.TraceCtxf(ctx, "fs unlock", "key", key, "path", fp)
+	return err
+}
+
+// remove the lock file if it is older than LockMaxAge.
+//
+// The lock file is first moved to a name unique to the caller, so that only one of several waiters finding the same stale lock can remove it. If the moved file turns out to be a fresh lock that replaced the stale one in the meantime, it is put back.
+func removeStaleLock(ctx context.Context, fp string) error {
+	if LockMaxAge == 0 {
+		return nil
+	}
+	fi, err := os.Stat(fp)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if time.Since(fi.ModTime()) < LockMaxAge {
+		return nil
+	}
+	owner, err := os.ReadFile(fp)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	f, err := os.CreateTemp(path.Dir(fp), path.Base(fp)+".*"+lockSuffix)
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	f.Close()
+	err = os.Rename(fp, tmp)
+	if err != nil {
+		os.Remove(tmp)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer os.Remove(tmp)
+
+	fi, err = os.Stat(tmp)
+	if err != nil {
+		return err
+	}
+	v, err := os.ReadFile(tmp)
+	if err != nil {
+		return err
+	}
+	if time.Since(fi.ModTime()) < LockMaxAge || !bytes.Equal(v, owner) {
+		err = os.Link(tmp, fp)
+		if err != nil {
+			return fmt.Errorf("restore fs lock %s: %w", fp, err)
+		}
+		return nil
+	}
+	logg.WarnCtxf(ctx, "removed stale fs lock", "path", fp, "age", time.Since(fi.ModTime()), "owner", string(bytes.TrimSpace(owner)))
+	return nil
+}
+
+// path of the lock file for the key.
+func (fdb *fsDb) lockPathFor(ctx context.Context, key []byte) (string, error) {
+	lk, err := fdb.ToKey(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	flk, err := fdb.pathFor(ctx, &lk)
+	if err != nil {
+		return "", err
+	}
+	return flk.Default + lockSuffix, nil
+}
+
+// Sweep implements the db.Sweeper interface.
+//
+// The age of an entry is determined by the modification time of its file. Files using the legacy names are not swept.
+func (fdb *fsDb) Sweep(ctx context.Context, maxAge time.Duration) (int, error) {
+	if fdb.fsys != nil {
+		return 0, ErrReadOnly
+	}
+	var c int
+	if !fdb.CheckPut() {
+		return 0, errors.New("unsafe sweep and safety set")
+	}
+	elements, err := fdb.readDir()
+	if err != nil {
+		return 0, err
+	}
+	pfx := fdb.Prefix() + 0x30
+	for _, v := range skipLocks(elements) {
+		s := v.Name()
+		if v.IsDir() || s[0] != pfx {
+			continue
+		}
+		fi, err := v.Info()
+		if err != nil {
+			return c, err
+		}
+		if time.Since(fi.ModTime()) < maxAge {
+			continue
+		}
+		err = os.Remove(path.Join(fdb.dir, s))
+		if err != nil {
+			return c, err
+		}
+		c += 1
+	}
+	logg.TraceCtxf(ctx, "fs sweep", "pfx", fdb.Prefix(), "deleted", c)
+	return c, nil
+}
+
 // create a key safe for the filesystem.
 func (fdb *fsDb) pathFor(ctx context.Context, lk *db.LookupKey) (fsLookupKey, error) {
 	var flk fsLookupKey
@@ -177,19 +462,62 @@ func (fdb *fsDb) pathFor(ctx context.Context, lk *db.LookupKey) (fsLookupKey, er
 // create a key safe for the filesystem, matching legacy resource.FsResource name.
 func (fdb *fsDb) altPathFor(ctx context.Context, lk *db.LookupKey) (fsLookupKey, error) {
 	var flk fsLookupKey
-	fb := string(lk.Default[1:])
-	if fdb.Prefix() == db.DATATYPE_BIN {
-		fb += ".bin"
-	}
+	sfx := altSuffix(fdb.Prefix())
+	fb := string(lk.Default[1:]) + sfx
 	flk.Default = path.Join(fdb.dir, fb)
 
 	if lk.Translation != nil {
-		fb = string(lk.Translation[1:])
-		if fdb.Prefix() == db.DATATYPE_BIN {
-			fb += ".bin"
-		}
+		fb = string(lk.Translation[1:]) + sfx
 		flk.Translation = path.Join(fdb.dir, fb)
 	}
 
 	return flk, nil
 }
+
+// connect to a directory in the fs.FS.
+func (fdb *fsDb) connectFS(ctx context.Context, connStr string) error {
+	if connStr == "" {
+		connStr = "."
+	}
+	fi, err := fs.Stat(fdb.fsys, connStr)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("not a directory: %s", connStr)
+	}
+	fdb.DbBase.Connect(ctx, connStr)
+	fdb.dir = connStr
+	return nil
+}
+
+// open the file at the path, in the fs.FS if set.
+func (fdb *fsDb) open(fp string) (fs.File, error) {
+	if fdb.fsys != nil {
+		return fdb.fsys.Open(fp)
+	}
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// list the entries in the directory, in the fs.FS if set.
+func (fdb *fsDb) readDir() ([]fs.DirEntry, error) {
+	if fdb.fsys != nil {
+		return fs.ReadDir(fdb.fsys, fdb.dir)
+	}
+	return os.ReadDir(fdb.dir)
+}
+
+// file extension used by the legacy name for the given datatype.
+func altSuffix(pfx uint8) string {
+	switch pfx {
+	case db.DATATYPE_BIN:
+		return ".bin"
+	case db.DATATYPE_SRCMAP:
+		return ".map"
+	}
+	return ""
+}
@@ -3,10 +3,14 @@ package fs
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"git.defalsify.org/vise.git/db"
 	"git.defalsify.org/vise.git/db/dbtest"
@@ -188,3 +192,184 @@ func TestNoKey(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestLockFs(t *testing.T) {
+	ctx := context.Background()
+	d, err := ioutil.TempDir("", "vise-db-fs-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewFsDb()
+	err = store.Connect(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbtest.RunLockTests(t, ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.SetPrefix(db.DATATYPE_USERDATA)
+	store.SetSession("xyzzy")
+	err = store.Put(ctx, []byte("foo"), []byte("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Lock(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Unlock(ctx, []byte("foo"))
+	o, err := store.Dump(ctx, []byte(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := 0
+	for k, _ := o.Next(ctx); k != nil; k, _ = o.Next(ctx) {
+		c += 1
+	}
+	if c != 1 {
+		t.Fatalf("expected 1 dumped key, got %d", c)
+	}
+}
+
+func TestLockFsStale(t *testing.T) {
+	ctx := context.Background()
+	d, err := ioutil.TempDir("", "vise-db-fs-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewFsDb()
+	err = store.Connect(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetPrefix(db.DATATYPE_STATE)
+	store.SetSession("xyzzy")
+	err = store.Lock(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp, err := store.lockPathFor(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), fmt.Sprintf("%d ", os.Getpid())) {
+		t.Fatalf("expected pid in lock file, got '%s'", b)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, time.Millisecond*50)
+	defer cancel()
+	err = store.Lock(tctx, []byte("foo"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// lock left behind by crashed process
+	then := time.Now().Add(-LockMaxAge * 2)
+	err = os.Chtimes(fp, then, then)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tctx, cancel = context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	err = store.Lock(tctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(fi.ModTime()) > LockMaxAge {
+		t.Fatalf("expected fresh lock, got mtime %v", fi.ModTime())
+	}
+	entries, err := os.ReadDir(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected only lock file left, got %v", entries)
+	}
+
+	// fresh lock is not taken over
+	err = removeStaleLock(ctx, fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Unlock(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSweepFs(t *testing.T) {
+	ctx := context.Background()
+	d, err := ioutil.TempDir("", "vise-db-fs-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewFsDb()
+	err = store.Connect(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbtest.RunSweepTests(t, ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSnapshotFs(t *testing.T) {
+	ctx := context.Background()
+	d, err := ioutil.TempDir("", "vise-db-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"v1", "v2"} {
+		store := NewFsDb()
+		err = store.SetSnapshot(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.Connect(ctx, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.SetPrefix(db.DATATYPE_USERDATA)
+		err = store.Put(ctx, []byte("foo"), []byte(v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.SetSnapshot("v3")
+		if err == nil {
+			t.Fatal("expected error setting snapshot after connect")
+		}
+	}
+
+	store := NewFsDb()
+	err = store.SetSnapshot("v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Connect(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetPrefix(db.DATATYPE_USERDATA)
+	v, err := store.Get(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v, []byte("v1")) {
+		t.Fatalf("expected value 'v1', found '%s'", v)
+	}
+}
@@ -1,16 +1,29 @@
 package gdbm
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	gdbm "github.com/graygnuorg/go-gdbm"
 
 	"git.defalsify.org/vise.git/db"
 )
 
+var (
+	// marks a value stored with a header holding the time it was written.
+	timeMagic = []byte{0xff, 'v', 't', 0x01}
+)
+
+const (
+	// length of the header of stored values, the marker followed by the write time.
+	headerLen = 12
+)
+
 // gdbmDb is a gdbm backend implementation of the Db interface.
 type gdbmDb struct {
 	*db.DbBase
@@ -103,6 +116,7 @@ func (gdb *gdbmDb) Put(ctx context.Context, key []byte, val []byte) error {
 		return err
 	}
 	logg.TraceCtxf(ctx, "gdbm put", "key", key, "lk", lk, "val", val)
+	val = stamp(val, time.Now())
 	if lk.Translation != nil {
 		return gdb.conn.Store(lk.Translation, val, true)
 	}
@@ -123,6 +137,7 @@ func (gdb *gdbmDb) Get(ctx context.Context, key []byte) ([]byte, error) {
 				return nil, err
 			}
 		}
+		v, _ = unstamp(v)
 		return v, nil
 	}
 	v, err = gdb.conn.Fetch(lk.Default)
@@ -133,12 +148,133 @@ func (gdb *gdbmDb) Get(ctx context.Context, key []byte) ([]byte, error) {
 		}
 		return nil, err
 	}
+	v, _ = unstamp(v)
 	logg.TraceCtxf(ctx, "gdbm get", "key", key, "lk", lk, "val", v)
 	return v, nil
 }
 
+// Delete implements Db
+func (gdb *gdbmDb) Delete(ctx context.Context, key []byte) error {
+	if !gdb.CheckPut() {
+		return errors.New("unsafe delete and safety set")
+	}
+	lk, err := gdb.ToKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	k := lk.Default
+	if lk.Translation != nil {
+		k = lk.Translation
+	}
+	logg.TraceCtxf(ctx, "gdbm delete", "key", key, "lk", k)
+	err = gdb.conn.Delete(k)
+	if err != nil {
+		if errors.Is(gdbm.ErrItemNotFound, err) {
+			return db.NewErrNotFound(key)
+		}
+		return err
+	}
+	return nil
+}
+
+// Range implements Db
+func (gdb *gdbmDb) Range(ctx context.Context, start []byte, end []byte, limit int) (*db.Dumper, error) {
+	var keys [][]byte
+	var vals [][]byte
+	base := gdb.KeyPrefix()
+	it := gdb.conn.Iterator()
+	for true {
+		k, err := it()
+		if err != nil {
+			if errors.Is(err, gdbm.ErrItemNotFound) {
+				break
+			}
+			return nil, err
+		}
+		if !bytes.HasPrefix(k, base) {
+			continue
+		}
+		k, err = gdb.DecodeKey(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	keys = db.FilterRange(keys, start, end, limit)
+	for _, k := range keys {
+		v, err := gdb.Get(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	logg.TraceCtxf(ctx, "gdbm range", "start", start, "end", end, "count", len(keys))
+	return db.NewSliceDumper(keys, vals), nil
+}
+
+// Sweep implements db.Sweeper.
+//
+// gdbm does not store modification times. The time of every write is therefore stored by Put in a header of the value, which is removed again on read. Values written before write times were recorded are not swept.
+func (gdb *gdbmDb) Sweep(ctx context.Context, maxAge time.Duration) (int, error) {
+	var keys [][]byte
+	if !gdb.CheckPut() {
+		return 0, errors.New("unsafe sweep and safety set")
+	}
+	pfx := gdb.Prefix()
+	it := gdb.conn.Iterator()
+	for true {
+		k, err := it()
+		if err != nil {
+			if errors.Is(err, gdbm.ErrItemNotFound) {
+				break
+			}
+			return 0, err
+		}
+		if len(k) == 0 || k[0] != pfx {
+			continue
+		}
+		v, err := gdb.conn.Fetch(k)
+		if err != nil {
+			return 0, err
+		}
+		_, t := unstamp(v)
+		if t.IsZero() || time.Since(t) < maxAge {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	// keys are deleted after iteration, as gdbm does not guarantee the iteration order across modifications
+	for i, k := range keys {
+		err := gdb.conn.Delete(k)
+		if err != nil {
+			return i, err
+		}
+	}
+	logg.TraceCtxf(ctx, "gdbm sweep", "pfx", pfx, "deleted", len(keys))
+	return len(keys), nil
+}
+
 // Close implements Db
 func (gdb *gdbmDb) Close(ctx context.Context) error {
 	logg.TraceCtxf(ctx, "closing gdbm", "path", gdb.conn)
 	return gdb.conn.Close()
 }
+
+// prepend the header with the write time to the value.
+func stamp(val []byte, t time.Time) []byte {
+	r := make([]byte, headerLen, headerLen+len(val))
+	copy(r, timeMagic)
+	binary.BigEndian.PutUint64(r[len(timeMagic):], uint64(t.UnixNano()))
+	return append(r, val...)
+}
+
+// remove the header from the value, and return the value and the write time in it.
+//
+// Values without the header are returned unchanged, with the zero time.
+func unstamp(v []byte) ([]byte, time.Time) {
+	if len(v) < headerLen || !bytes.HasPrefix(v, timeMagic) {
+		return v, time.Time{}
+	}
+	t := time.Unix(0, int64(binary.BigEndian.Uint64(v[len(timeMagic):headerLen])))
+	return v[headerLen:], t
+}
@@ -169,3 +169,20 @@ func TestNoKey(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestSweepGdbm(t *testing.T) {
+	ctx := context.Background()
+	store := NewGdbmDb()
+	f, err := ioutil.TempFile("", "vise-db-gdbm-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Connect(ctx, f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbtest.RunSweepTests(t, ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
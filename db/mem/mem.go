@@ -1,9 +1,13 @@
 package mem
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"sync"
+	"time"
 
 	"git.defalsify.org/vise.git/db"
 )
@@ -18,8 +22,11 @@ type memLookupKey struct {
 type memDb struct {
 	*db.DbBase
 	store map[string][]byte
+	updated map[string]time.Time
 	dumpIdx int
 	dumpKeys []string
+	lockMu sync.Mutex
+	locks map[string]chan struct{}
 }
 
 // NewmemDb returns an in-process volatile Db implementation.
@@ -27,6 +34,7 @@ func NewMemDb() *memDb {
 	db := &memDb{
 		DbBase: db.NewDbBase(),
 		dumpIdx: -1,
+		locks: make(map[string]chan struct{}),
 	}
 	return db
 }
@@ -48,6 +56,7 @@ func (mdb *memDb) Connect(ctx context.Context, connStr string) error {
 		return nil
 	}
 	mdb.store = make(map[string][]byte)
+	mdb.updated = make(map[string]time.Time)
 	return nil
 }
 
@@ -102,11 +111,129 @@ func (mdb *memDb) Put(ctx context.Context, key []byte, val []byte) error {
 		k = mk.Default
 	}
 	mdb.store[k] = val
+	mdb.updated[k] = time.Now()
 	logg.TraceCtxf(ctx, "mem put", "k", k, "mk", mk, "v", val)
 	return nil
 }
 
+// Delete implements Db
+func (mdb *memDb) Delete(ctx context.Context, key []byte) error {
+	var k string
+	if !mdb.CheckPut() {
+		return errors.New("unsafe delete and safety set")
+	}
+	mk, err := mdb.toHexKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	if mk.Translation != "" {
+		k = mk.Translation
+	} else {
+		k = mk.Default
+	}
+	_, ok := mdb.store[k]
+	if !ok {
+		return db.NewErrNotFound(key)
+	}
+	delete(mdb.store, k)
+	delete(mdb.updated, k)
+	logg.TraceCtxf(ctx, "mem delete", "k", k)
+	return nil
+}
+
+// Range implements Db
+func (mdb *memDb) Range(ctx context.Context, start []byte, end []byte, limit int) (*db.Dumper, error) {
+	var keys [][]byte
+	var vals [][]byte
+	base := mdb.KeyPrefix()
+	for s := range mdb.store {
+		k, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.HasPrefix(k, base) {
+			continue
+		}
+		k, err = mdb.DecodeKey(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	keys = db.FilterRange(keys, start, end, limit)
+	for _, k := range keys {
+		v, err := mdb.Get(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	logg.TraceCtxf(ctx, "mem range", "start", start, "end", end, "count", len(keys))
+	return db.NewSliceDumper(keys, vals), nil
+}
+
 // Close implements Db
 func (mdb *memDb) Close(ctx context.Context) error {
 	return nil
 }
+
+// Lock implements db.Locker
+func (mdb *memDb) Lock(ctx context.Context, key []byte) error {
+	mk, err := mdb.toHexKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	for {
+		mdb.lockMu.Lock()
+		ch, ok := mdb.locks[mk.Default]
+		if !ok {
+			mdb.locks[mk.Default] = make(chan struct{})
+			mdb.lockMu.Unlock()
+			logg.TraceCtxf(ctx, "mem lock", "k", mk.Default)
+			return nil
+		}
+		mdb.lockMu.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Unlock implements db.Locker
+func (mdb *memDb) Unlock(ctx context.Context, key []byte) error {
+	mk, err := mdb.toHexKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	mdb.lockMu.Lock()
+	defer mdb.lockMu.Unlock()
+	ch, ok := mdb.locks[mk.Default]
+	if !ok {
+		return fmt.Errorf("key not locked: %x", key)
+	}
+	delete(mdb.locks, mk.Default)
+	close(ch)
+	logg.TraceCtxf(ctx, "mem unlock", "k", mk.Default)
+	return nil
+}
+
+// Sweep implements db.Sweeper
+func (mdb *memDb) Sweep(ctx context.Context, maxAge time.Duration) (int, error) {
+	var c int
+	if !mdb.CheckPut() {
+		return 0, errors.New("unsafe sweep and safety set")
+	}
+	pfx := hex.EncodeToString([]byte{mdb.Prefix()})
+	for k, v := range mdb.updated {
+		if k[:2] != pfx || time.Since(v) < maxAge {
+			continue
+		}
+		delete(mdb.store, k)
+		delete(mdb.updated, k)
+		c += 1
+	}
+	logg.TraceCtxf(ctx, "mem sweep", "pfx", mdb.Prefix(), "deleted", c)
+	return c, nil
+}
@@ -55,3 +55,29 @@ func TestPutGetMem(t *testing.T) {
 		t.Fatal("expected get error for key 'bar'")
 	}
 }
+
+func TestLockMem(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemDb()
+	err := store.Connect(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbtest.RunLockTests(t, ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSweepMem(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemDb()
+	err := store.Connect(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbtest.RunSweepTests(t, ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -21,7 +21,7 @@ func (pdb *pgDb) Dump(ctx context.Context, key []byte) (*db.Dumper, error) {
 	}
 	k := lk.Default
 
-	query := fmt.Sprintf("SELECT key, value FROM %s.kv_vise WHERE key >= $1", pdb.schema)
+	query := fmt.Sprintf("SELECT key, value FROM %s.%s WHERE key >= $1", pdb.schema, pdb.table)
 	rs, err := tx.Query(ctx, query, k)
 	if err != nil {
 		logg.Debugf("query fail", "err", err)
@@ -76,3 +76,48 @@ func (pdb *pgDb) closeFunc() error {
 	}
 	return nil
 }
+
+// Range implements Db.
+func (pdb *pgDb) Range(ctx context.Context, start []byte, end []byte, limit int) (*db.Dumper, error) {
+	var keys [][]byte
+	var vals [][]byte
+	lo, hi := pdb.RangeKeys(start, end)
+	err := pdb.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("SELECT key, value FROM %s.%s WHERE key >= $1 AND key < $2 ORDER BY key", pdb.schema, pdb.table)
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rs, err := pdb.tx.Query(ctx, query, lo, hi)
+	if err != nil {
+		pdb.Abort(ctx)
+		return nil, err
+	}
+	for rs.Next() {
+		var kk []byte
+		var vv []byte
+		err = rs.Scan(&kk, &vv)
+		if err != nil {
+			rs.Close()
+			pdb.Abort(ctx)
+			return nil, err
+		}
+		kk, err = pdb.DecodeKey(ctx, kk)
+		if err != nil {
+			rs.Close()
+			pdb.Abort(ctx)
+			return nil, err
+		}
+		keys = append(keys, kk)
+		vals = append(vals, vv)
+	}
+	rs.Close()
+	err = pdb.stopSingle(ctx)
+	if err != nil {
+		return nil, err
+	}
+	logg.TraceCtxf(ctx, "range", "start", start, "end", end, "count", len(keys))
+	return db.NewSliceDumper(keys, vals), nil
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	pgx "github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -25,12 +27,15 @@ type pgDb struct {
 	*db.DbBase
 	conn   PgInterface
 	schema string
+	table  string
 	prefix uint8
 	prepd  bool
 	it     pgx.Rows
 	itBase []byte
 	tx     pgx.Tx
 	multi  bool
+	lockMu sync.Mutex
+	locks  map[string]pgx.Tx
 }
 
 // NewpgDb creates a new Postgres backed Db implementation.
@@ -38,6 +43,8 @@ func NewPgDb() *pgDb {
 	db := &pgDb{
 		DbBase: db.NewDbBase(),
 		schema: "public",
+		table:  "kv_vise",
+		locks:  make(map[string]pgx.Tx),
 	}
 	return db
 }
@@ -53,6 +60,21 @@ func (pdb *pgDb) WithSchema(schema string) *pgDb {
 	return pdb
 }
 
+// SetSnapshot implements db.Snapshotter.
+//
+// The snapshot is stored in a separate table named kv_vise_<name>, in the same schema.
+func (pdb *pgDb) SetSnapshot(name string) error {
+	if pdb.prepd {
+		return errors.New("snapshot must be set before connect")
+	}
+	err := db.CheckSnapshotName(name)
+	if err != nil {
+		return err
+	}
+	pdb.table = "kv_vise_" + name
+	return nil
+}
+
 func (pdb *pgDb) WithConnection(pi PgInterface) *pgDb {
 	pdb.conn = pi
 	return pdb
@@ -147,85 +169,236 @@ func (pdb *pgDb) Put(ctx context.Context, key []byte, val []byte) error {
 		return err
 	}
 
-	err = pdb.start(ctx)
-	if err != nil {
-		return err
+	tx, locked := pdb.lockTx(lk)
+	if !locked {
+		err = pdb.start(ctx)
+		if err != nil {
+			return err
+		}
+		tx = pdb.tx
 	}
-	logg.TraceCtxf(ctx, "put", "key", key, "val", val)
-	query := fmt.Sprintf("INSERT INTO %s.kv_vise (key, value, updated) VALUES ($1, $2, 'now') ON CONFLICT(key) DO UPDATE SET value = $2, updated = 'now';", pdb.schema)
+	logg.TraceCtxf(ctx, "put", "key", key, "val", val, "locked", locked)
+	query := fmt.Sprintf("INSERT INTO %s.%s (key, value, updated) VALUES ($1, $2, 'now') ON CONFLICT(key) DO UPDATE SET value = $2, updated = 'now';", pdb.schema, pdb.table)
 	actualKey := lk.Default
 	if lk.Translation != nil {
 		actualKey = lk.Translation
 	}
 
-	_, err = pdb.tx.Exec(ctx, query, actualKey, val)
+	_, err = tx.Exec(ctx, query, actualKey, val)
 	if err != nil {
 		return err
 	}
+	if locked {
+		return nil
+	}
 
 	return pdb.stopSingle(ctx)
 }
 
 // Get implements Db.
 func (pdb *pgDb) Get(ctx context.Context, key []byte) ([]byte, error) {
-	var rr []byte
 	lk, err := pdb.ToKey(ctx, key)
 	if err != nil {
 		return nil, err
 	}
 
+	tx, locked := pdb.lockTx(lk)
+	if locked {
+		logg.TraceCtxf(ctx, "get", "key", key, "locked", locked)
+		return pdb.get(ctx, tx, key, lk)
+	}
 	err = pdb.start(ctx)
 	if err != nil {
 		return nil, err
 	}
 	logg.TraceCtxf(ctx, "get", "key", key)
 
+	rr, err := pdb.get(ctx, pdb.tx, key, lk)
+	if err != nil {
+		if !db.IsNotFound(err) {
+			pdb.Abort(ctx)
+		}
+		return nil, err
+	}
+	err = pdb.stopSingle(ctx)
+	return rr, err
+}
+
+// retrieve the value of the key within the given transaction.
+func (pdb *pgDb) get(ctx context.Context, tx pgx.Tx, key []byte, lk db.LookupKey) ([]byte, error) {
+	var rr []byte
+	query := fmt.Sprintf("SELECT value FROM %s.%s WHERE key = $1", pdb.schema, pdb.table)
 	if lk.Translation != nil {
-		query := fmt.Sprintf("SELECT value FROM %s.kv_vise WHERE key = $1", pdb.schema)
-		rs, err := pdb.tx.Query(ctx, query, lk.Translation)
+		rs, err := tx.Query(ctx, query, lk.Translation)
 		if err != nil {
-			pdb.Abort(ctx)
 			return nil, err
 		}
 
 		if rs.Next() {
 			err = rs.Scan(&rr)
+			rs.Close()
 			if err != nil {
-				pdb.Abort(ctx)
 				return nil, err
 			}
-
-			rs.Close()
-			err = pdb.stopSingle(ctx)
-			return rr, err
+			return rr, nil
 		}
+		rs.Close()
 	}
 
-	query := fmt.Sprintf("SELECT value FROM %s.kv_vise WHERE key = $1", pdb.schema)
-	rs, err := pdb.tx.Query(ctx, query, lk.Default)
+	rs, err := tx.Query(ctx, query, lk.Default)
 	if err != nil {
-		pdb.Abort(ctx)
 		return nil, err
 	}
+	defer rs.Close()
 
 	if !rs.Next() {
-		rs.Close()
 		return nil, db.NewErrNotFound(key)
 	}
 
 	err = rs.Scan(&rr)
 	if err != nil {
-		rs.Close()
-		pdb.Abort(ctx)
 		return nil, err
 	}
+	return rr, nil
+}
+
+// Delete implements Db.
+func (pdb *pgDb) Delete(ctx context.Context, key []byte) error {
+	if !pdb.CheckPut() {
+		return errors.New("unsafe delete and safety set")
+	}
+	lk, err := pdb.ToKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	tx, locked := pdb.lockTx(lk)
+	if !locked {
+		err = pdb.start(ctx)
+		if err != nil {
+			return err
+		}
+		tx = pdb.tx
+	}
+	actualKey := lk.Default
+	if lk.Translation != nil {
+		actualKey = lk.Translation
+	}
+	logg.TraceCtxf(ctx, "delete", "key", key, "locked", locked)
+	query := fmt.Sprintf("DELETE FROM %s.%s WHERE key = $1", pdb.schema, pdb.table)
+	r, err := tx.Exec(ctx, query, actualKey)
+	if err != nil {
+		if !locked {
+			pdb.Abort(ctx)
+		}
+		return err
+	}
+	if !locked {
+		err = pdb.stopSingle(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	if r.RowsAffected() == 0 {
+		return db.NewErrNotFound(key)
+	}
+	return nil
+}
+
+// Lock implements db.Locker.
+//
+// It starts a transaction of its own, in which the row of the key is locked with SELECT ... FOR UPDATE. If the key does not exist yet, a transaction level advisory lock on the key is taken instead.
+//
+// All Get, Put and Delete calls for the key until Unlock are part of that transaction. Other keys, and transactions started with Start, are not affected.
+func (pdb *pgDb) Lock(ctx context.Context, key []byte) error {
+	lk, err := pdb.ToKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	tx, err := pdb.conn.BeginTx(ctx, defaultTxOptions)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf("SELECT key FROM %s.%s WHERE key = $1 FOR UPDATE", pdb.schema, pdb.table)
+	rs, err := tx.Query(ctx, query, lk.Default)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+	found := rs.Next()
 	rs.Close()
-	err = pdb.stopSingle(ctx)
-	return rr, err
+	if !found {
+		query = "SELECT pg_advisory_xact_lock(hashtextextended(encode($1, 'hex'), 0))"
+		_, err = tx.Exec(ctx, query, lk.Default)
+		if err != nil {
+			tx.Rollback(ctx)
+			return err
+		}
+	}
+	pdb.lockMu.Lock()
+	pdb.locks[string(lk.Default)] = tx
+	pdb.lockMu.Unlock()
+	logg.TraceCtxf(ctx, "lock", "key", key, "row", found)
+	return nil
+}
+
+// Unlock implements db.Locker.
+//
+// It commits the transaction started by Lock.
+func (pdb *pgDb) Unlock(ctx context.Context, key []byte) error {
+	lk, err := pdb.ToKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	pdb.lockMu.Lock()
+	tx, ok := pdb.locks[string(lk.Default)]
+	delete(pdb.locks, string(lk.Default))
+	pdb.lockMu.Unlock()
+	if !ok {
+		return fmt.Errorf("key not locked: %x", key)
+	}
+	err = tx.Commit(ctx)
+	logg.TraceCtxf(ctx, "unlock", "key", key, "err", err)
+	return err
+}
+
+// lockTx returns the transaction of the lock held on the key, if any.
+func (pdb *pgDb) lockTx(lk db.LookupKey) (pgx.Tx, bool) {
+	pdb.lockMu.Lock()
+	defer pdb.lockMu.Unlock()
+	tx, ok := pdb.locks[string(lk.Default)]
+	return tx, ok
+}
+
+// Sweep implements db.Sweeper.
+//
+// The age of an entry is determined by its updated column.
+func (pdb *pgDb) Sweep(ctx context.Context, maxAge time.Duration) (int, error) {
+	if !pdb.CheckPut() {
+		return 0, errors.New("unsafe sweep and safety set")
+	}
+	err := pdb.start(ctx)
+	if err != nil {
+		return 0, err
+	}
+	query := fmt.Sprintf("DELETE FROM %s.%s WHERE get_byte(key, 0) = $1 AND updated < LOCALTIMESTAMP - $2::interval", pdb.schema, pdb.table)
+	r, err := pdb.tx.Exec(ctx, query, int(pdb.Prefix()), maxAge)
+	if err != nil {
+		pdb.Abort(ctx)
+		return 0, err
+	}
+	logg.TraceCtxf(ctx, "sweep", "pfx", pdb.Prefix(), "deleted", r.RowsAffected())
+	return int(r.RowsAffected()), pdb.stopSingle(ctx)
 }
 
 // Close implements Db.
 func (pdb *pgDb) Close(ctx context.Context) error {
+	pdb.lockMu.Lock()
+	for k, tx := range pdb.locks {
+		logg.WarnCtxf(ctx, "rollback of lock held on close", "key", []byte(k))
+		tx.Rollback(ctx)
+		delete(pdb.locks, k)
+	}
+	pdb.lockMu.Unlock()
 	err := pdb.Stop(ctx)
 	if err == db.ErrNoTx {
 		err = nil
@@ -245,13 +418,13 @@ func (pdb *pgDb) ensureTable(ctx context.Context) error {
 		tx.Rollback(ctx)
 		return err
 	}
-	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.kv_vise (
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.%s (
 		id SERIAL NOT NULL,
 		key BYTEA NOT NULL UNIQUE,
 		value BYTEA NOT NULL,
 		updated TIMESTAMP NOT NULL
 	);
-`, pdb.schema)
+`, pdb.schema, pdb.table)
 	_, err = tx.Exec(ctx, query)
 	if err != nil {
 		tx.Rollback(ctx)
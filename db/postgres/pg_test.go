@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"testing"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
@@ -316,3 +317,248 @@ func TestPostgresTxStartStop(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestPostgresLock(t *testing.T) {
+	var locker db.Locker
+	ses := "xyzzy"
+
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	store := NewPgDb().WithConnection(mock).WithSchema("vvise")
+	store.SetPrefix(db.DATATYPE_STATE)
+	store.SetSession(ses)
+	ctx := context.Background()
+
+	locker = store
+	k := []byte("foo")
+	ks := append([]byte{db.DATATYPE_STATE}, []byte(ses)...)
+	ks = append(ks, []byte(".")...)
+	ks = append(ks, k...)
+	v := []byte("bar")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT key FROM vvise.kv_vise").WithArgs(ks).WillReturnRows(pgxmock.NewRows([]string{"key"}))
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs(ks).WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.ExpectExec("INSERT INTO vvise.kv_vise").WithArgs(ks, v).WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+	err = locker.Lock(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Put(ctx, k, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = locker.Unlock(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT key FROM vvise.kv_vise").WithArgs(ks).WillReturnRows(pgxmock.NewRows([]string{"key"}).AddRow(ks))
+	mock.ExpectCommit()
+	err = locker.Lock(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = locker.Unlock(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = locker.Unlock(ctx, k)
+	if err == nil {
+		t.Fatal("expected error on unlock of key not locked")
+	}
+
+	ktwo := []byte("baz")
+	kstwo := append([]byte{db.DATATYPE_STATE}, []byte(ses)...)
+	kstwo = append(kstwo, []byte(".")...)
+	kstwo = append(kstwo, ktwo...)
+	row := pgxmock.NewRowsWithColumnDefinition(mockVfd)
+	row = row.AddRow(v)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT key FROM vvise.kv_vise").WithArgs(ks).WillReturnRows(pgxmock.NewRows([]string{"key"}).AddRow(ks))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO vvise.kv_vise").WithArgs(kstwo, v).WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT value FROM vvise.kv_vise").WithArgs(ks).WillReturnRows(row)
+	mock.ExpectExec("INSERT INTO vvise.kv_vise").WithArgs(ks, v).WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+	err = locker.Lock(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Start(ctx)
+	if err != nil {
+		t.Fatalf("expected transaction to start while key is locked: %v", err)
+	}
+	err = store.Put(ctx, ktwo, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Stop(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := store.Get(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r, v) {
+		t.Fatalf("expected %x, got %x", v, r)
+	}
+	err = store.Put(ctx, k, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = locker.Unlock(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostgresSweep(t *testing.T) {
+	var sweeper db.Sweeper
+
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	store := NewPgDb().WithConnection(mock).WithSchema("vvise")
+	store.SetPrefix(db.DATATYPE_STATE)
+	ctx := context.Background()
+
+	sweeper = store
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM vvise.kv_vise").WithArgs(int(db.DATATYPE_STATE), time.Minute).WillReturnResult(pgxmock.NewResult("DELETE", 3))
+	mock.ExpectCommit()
+	c, err := sweeper.Sweep(ctx, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != 3 {
+		t.Fatalf("expected 3 swept entries, got %d", c)
+	}
+
+	store.SetPrefix(db.DATATYPE_BIN)
+	_, err = sweeper.Sweep(ctx, time.Minute)
+	if err == nil {
+		t.Fatalf("expected error sweeping locked prefix")
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostgresDeleteRange(t *testing.T) {
+	ses := "xyzzy"
+
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	store := NewPgDb().WithConnection(mock).WithSchema("vvise")
+	store.SetPrefix(db.DATATYPE_USERDATA)
+	store.SetSession(ses)
+	ctx := context.Background()
+
+	base := append([]byte{db.DATATYPE_USERDATA}, []byte(ses+".")...)
+	kb := append(append([]byte{}, base...), []byte("b")...)
+	kc := append(append([]byte{}, base...), []byte("c")...)
+	hi := append([]byte{db.DATATYPE_USERDATA}, []byte(ses+"/")...)
+
+	mockKfd := mockVfd
+	mockKfd.Name = "key"
+	row := pgxmock.NewRowsWithColumnDefinition(mockKfd, mockVfd)
+	row = row.AddRow(kb, []byte("B")).AddRow(kc, []byte("C"))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT key, value FROM vvise.kv_vise").WithArgs(kb, hi).WillReturnRows(row)
+	mock.ExpectCommit()
+	o, err := store.Range(ctx, []byte("b"), nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, v := o.Next(ctx)
+	if !bytes.Equal(k, []byte("b")) || !bytes.Equal(v, []byte("B")) {
+		t.Fatalf("expected b=B, got %s=%s", k, v)
+	}
+	k, v = o.Next(ctx)
+	if !bytes.Equal(k, []byte("c")) || !bytes.Equal(v, []byte("C")) {
+		t.Fatalf("expected c=C, got %s=%s", k, v)
+	}
+	k, _ = o.Next(ctx)
+	if k != nil {
+		t.Fatalf("expected end of range, got %s", k)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM vvise.kv_vise").WithArgs(kb).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectCommit()
+	err = store.Delete(ctx, []byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM vvise.kv_vise").WithArgs(kb).WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectCommit()
+	err = store.Delete(ctx, []byte("b"))
+	if !db.IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostgresSnapshot(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	store := NewPgDb().WithConnection(mock).WithSchema("vvise")
+	err = store.SetSnapshot("v1-2")
+	if err == nil {
+		t.Fatal("expected error on invalid snapshot name")
+	}
+	err = store.SetSnapshot("v1_2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetPrefix(db.DATATYPE_USERDATA)
+
+	k := []byte("foo")
+	v := []byte("bar")
+	ks := append([]byte{db.DATATYPE_USERDATA}, k...)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO vvise.kv_vise_v1_2 ").WithArgs(ks, v).WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+	err = store.Put(ctx, k, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"sort"
+)
+
+// FilterRange sorts the keys, and returns the ones from start up to but not including end.
+//
+// If end is nil, all keys from start are returned. If limit is greater than 0, at most limit keys are returned.
+//
+// It is used by Db implementations that cannot query ordered ranges natively.
+func FilterRange(keys [][]byte, start []byte, end []byte, limit int) [][]byte {
+	var r [][]byte
+	sort.Slice(keys, func(i int, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+	for _, k := range keys {
+		if bytes.Compare(k, start) < 0 {
+			continue
+		}
+		if end != nil && bytes.Compare(k, end) >= 0 {
+			break
+		}
+		r = append(r, k)
+		if limit > 0 && len(r) == limit {
+			break
+		}
+	}
+	return r
+}
+
+// NewSliceDumper creates a Dumper iterating the given keys and values in order.
+//
+// The keys and values must be of equal length.
+func NewSliceDumper(keys [][]byte, vals [][]byte) *Dumper {
+	i := 0
+	d := NewDumper(func(ctx context.Context) ([]byte, []byte) {
+		i += 1
+		if i >= len(keys) {
+			return nil, nil
+		}
+		return keys[i], vals[i]
+	})
+	if len(keys) > 0 {
+		d = d.WithFirst(keys[0], vals[0])
+	}
+	return d
+}
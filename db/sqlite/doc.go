@@ -0,0 +1,4 @@
+// Package sqlite is a SQLite database backed implementation of the db.Db interface.
+//
+// The sqlite implementation uses the same table layout as the postgres implementation, with two data columns of type `BLOB` for each key and value, aswell as an `updated` field of type `TIMESTAMP` that is set to the current time (UTC, millisecond precision) when an update is made.
+package sqlite
@@ -0,0 +1,90 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"git.defalsify.org/vise.git/db"
+)
+
+// Dump implements Db.
+//
+// The matching records are read in a single query, in key order.
+func (sdb *sqliteDb) Dump(ctx context.Context, key []byte) (*db.Dumper, error) {
+	sdb.SetLanguage(nil)
+	lk, err := sdb.ToKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	k := lk.Default
+
+	query := "SELECT key, value FROM kv_vise WHERE substr(key, 1, length($1)) = $1 ORDER BY key"
+	keys, vals, err := sdb.query(ctx, query, k)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, db.NewErrNotFound(k)
+	}
+	return db.NewSliceDumper(keys, vals), nil
+}
+
+// Range implements Db.
+func (sdb *sqliteDb) Range(ctx context.Context, start []byte, end []byte, limit int) (*db.Dumper, error) {
+	lo, hi := sdb.RangeKeys(start, end)
+	query := "SELECT key, value FROM kv_vise WHERE key >= $1 AND key < $2 ORDER BY key"
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	keys, vals, err := sdb.query(ctx, query, lo, hi)
+	if err != nil {
+		return nil, err
+	}
+	logg.TraceCtxf(ctx, "range", "start", start, "end", end, "count", len(keys))
+	return db.NewSliceDumper(keys, vals), nil
+}
+
+// query returns the decoded keys and values of the key/value rows matched by the query.
+func (sdb *sqliteDb) query(ctx context.Context, query string, args ...any) ([][]byte, [][]byte, error) {
+	var keys [][]byte
+	var vals [][]byte
+	err := sdb.start(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	rs, err := sdb.tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		logg.DebugCtxf(ctx, "query fail", "err", err)
+		sdb.abortSingle(ctx)
+		return nil, nil, err
+	}
+	for rs.Next() {
+		var kk []byte
+		var vv []byte
+		err = rs.Scan(&kk, &vv)
+		if err == nil {
+			kk, err = sdb.DecodeKey(ctx, kk)
+		}
+		if err != nil {
+			rs.Close()
+			sdb.abortSingle(ctx)
+			return nil, nil, err
+		}
+		if vv == nil {
+			vv = []byte{}
+		}
+		keys = append(keys, kk)
+		vals = append(vals, vv)
+	}
+	err = rs.Err()
+	rs.Close()
+	if err != nil {
+		sdb.abortSingle(ctx)
+		return nil, nil, err
+	}
+	err = sdb.stopSingle(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return keys, vals, nil
+}
@@ -0,0 +1,321 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"git.defalsify.org/vise.git/db"
+)
+
+const (
+	// sqlite expression for the current time with millisecond precision.
+	nowExpr = "strftime('%Y-%m-%d %H:%M:%f', 'now')"
+	// go layout matching nowExpr.
+	timeLayout = "2006-01-02 15:04:05.000"
+)
+
+// sqliteDb is a SQLite backend implementation of the Db interface.
+type sqliteDb struct {
+	*db.DbBase
+	conn  *sql.DB
+	prepd bool
+	tx    *sql.Tx
+	multi bool
+}
+
+// NewSqliteDb creates a new SQLite backed Db implementation.
+func NewSqliteDb() *sqliteDb {
+	db := &sqliteDb{
+		DbBase: db.NewDbBase(),
+	}
+	return db
+}
+
+// Base implements Db
+func (sdb *sqliteDb) Base() *db.DbBase {
+	return sdb.DbBase
+}
+
+// Connect implements Db.
+//
+// The connection string is the path to the database file, or any data source name accepted by the github.com/mattn/go-sqlite3 driver.
+//
+// A single connection is used, so that all operations on the same Db are serialized.
+func (sdb *sqliteDb) Connect(ctx context.Context, connStr string) error {
+	if sdb.conn != nil {
+		logg.WarnCtxf(ctx, "Sqlite already connected")
+		return nil
+	}
+	conn, err := sql.Open("sqlite3", connStr)
+	if err != nil {
+		return err
+	}
+	conn.SetMaxOpenConns(1)
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return fmt.Errorf("connection to sqlite could not be established: %w", err)
+	}
+
+	sdb.conn = conn
+	sdb.DbBase.Connect(ctx, connStr)
+	return sdb.ensureTable(ctx)
+}
+
+// Start implements Db.
+func (sdb *sqliteDb) Start(ctx context.Context) error {
+	if sdb.tx != nil {
+		return db.ErrTxExist
+	}
+	err := sdb.start(ctx)
+	if err != nil {
+		return err
+	}
+	sdb.multi = true
+	return nil
+}
+
+func (sdb *sqliteDb) start(ctx context.Context) error {
+	if sdb.tx != nil {
+		return nil
+	}
+	tx, err := sdb.conn.BeginTx(ctx, nil)
+	logg.TraceCtxf(ctx, "begin single tx", "err", err)
+	if err != nil {
+		return err
+	}
+	sdb.tx = tx
+	return nil
+}
+
+// Stop implements Db.
+func (sdb *sqliteDb) Stop(ctx context.Context) error {
+	if !sdb.multi {
+		return db.ErrSingleTx
+	}
+	return sdb.stop(ctx)
+}
+
+func (sdb *sqliteDb) stopSingle(ctx context.Context) error {
+	if sdb.multi {
+		return nil
+	}
+	err := sdb.tx.Commit()
+	logg.TraceCtxf(ctx, "stop single tx", "err", err)
+	sdb.tx = nil
+	return err
+}
+
+func (sdb *sqliteDb) stop(ctx context.Context) error {
+	if sdb.tx == nil {
+		return db.ErrNoTx
+	}
+	err := sdb.tx.Commit()
+	logg.TraceCtxf(ctx, "stop multi tx", "err", err)
+	sdb.tx = nil
+	sdb.multi = false
+	return err
+}
+
+// Abort implements Db.
+func (sdb *sqliteDb) Abort(ctx context.Context) {
+	if sdb.tx == nil {
+		return
+	}
+	logg.InfoCtxf(ctx, "aborting tx", "tx", sdb.tx)
+	sdb.tx.Rollback()
+	sdb.tx = nil
+	sdb.multi = false
+}
+
+// Put implements Db.
+func (sdb *sqliteDb) Put(ctx context.Context, key []byte, val []byte) error {
+	if !sdb.CheckPut() {
+		return errors.New("unsafe put and safety set")
+	}
+
+	lk, err := sdb.ToKey(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	err = sdb.start(ctx)
+	if err != nil {
+		return err
+	}
+	logg.TraceCtxf(ctx, "put", "key", key, "val", val)
+	query := fmt.Sprintf("INSERT INTO kv_vise (key, value, updated) VALUES ($1, $2, %s) ON CONFLICT(key) DO UPDATE SET value = $2, updated = %s;", nowExpr, nowExpr)
+	actualKey := lk.Default
+	if lk.Translation != nil {
+		actualKey = lk.Translation
+	}
+	if val == nil {
+		val = []byte{}
+	}
+
+	_, err = sdb.tx.ExecContext(ctx, query, actualKey, val)
+	if err != nil {
+		sdb.abortSingle(ctx)
+		return err
+	}
+
+	return sdb.stopSingle(ctx)
+}
+
+// Get implements Db.
+func (sdb *sqliteDb) Get(ctx context.Context, key []byte) ([]byte, error) {
+	var rr []byte
+	lk, err := sdb.ToKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sdb.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	logg.TraceCtxf(ctx, "get", "key", key)
+
+	query := "SELECT value FROM kv_vise WHERE key = $1"
+	if lk.Translation != nil {
+		err = sdb.tx.QueryRowContext(ctx, query, lk.Translation).Scan(&rr)
+		if err == nil {
+			if rr == nil {
+				rr = []byte{}
+			}
+			err = sdb.stopSingle(ctx)
+			return rr, err
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			sdb.abortSingle(ctx)
+			return nil, err
+		}
+	}
+
+	err = sdb.tx.QueryRowContext(ctx, query, lk.Default).Scan(&rr)
+	if err != nil {
+		sdb.abortSingle(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, db.NewErrNotFound(key)
+		}
+		return nil, err
+	}
+	if rr == nil {
+		rr = []byte{}
+	}
+	err = sdb.stopSingle(ctx)
+	return rr, err
+}
+
+// Delete implements Db.
+func (sdb *sqliteDb) Delete(ctx context.Context, key []byte) error {
+	if !sdb.CheckPut() {
+		return errors.New("unsafe delete and safety set")
+	}
+	lk, err := sdb.ToKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	err = sdb.start(ctx)
+	if err != nil {
+		return err
+	}
+	actualKey := lk.Default
+	if lk.Translation != nil {
+		actualKey = lk.Translation
+	}
+	logg.TraceCtxf(ctx, "delete", "key", key)
+	query := "DELETE FROM kv_vise WHERE key = $1"
+	r, err := sdb.tx.ExecContext(ctx, query, actualKey)
+	if err != nil {
+		sdb.abortSingle(ctx)
+		return err
+	}
+	err = sdb.stopSingle(ctx)
+	if err != nil {
+		return err
+	}
+	c, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if c == 0 {
+		return db.NewErrNotFound(key)
+	}
+	return nil
+}
+
+// Sweep implements db.Sweeper.
+//
+// The age of an entry is determined by its updated column.
+func (sdb *sqliteDb) Sweep(ctx context.Context, maxAge time.Duration) (int, error) {
+	if !sdb.CheckPut() {
+		return 0, errors.New("unsafe sweep and safety set")
+	}
+	err := sdb.start(ctx)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().UTC().Add(-maxAge).Format(timeLayout)
+	query := "DELETE FROM kv_vise WHERE substr(key, 1, 1) = $1 AND updated < $2"
+	r, err := sdb.tx.ExecContext(ctx, query, []byte{sdb.Prefix()}, cutoff)
+	if err != nil {
+		sdb.abortSingle(ctx)
+		return 0, err
+	}
+	c, err := r.RowsAffected()
+	if err != nil {
+		sdb.abortSingle(ctx)
+		return 0, err
+	}
+	logg.TraceCtxf(ctx, "sweep", "pfx", sdb.Prefix(), "deleted", c)
+	return int(c), sdb.stopSingle(ctx)
+}
+
+// Close implements Db.
+//
+// A pending transaction is committed before closing.
+func (sdb *sqliteDb) Close(ctx context.Context) error {
+	err := sdb.stop(ctx)
+	if err == db.ErrNoTx {
+		err = nil
+	}
+	cerr := sdb.conn.Close()
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// abortSingle rolls back the current transaction, unless it was started with Start.
+func (sdb *sqliteDb) abortSingle(ctx context.Context) {
+	if sdb.multi {
+		return
+	}
+	sdb.Abort(ctx)
+}
+
+// set up table
+func (sdb *sqliteDb) ensureTable(ctx context.Context) error {
+	if sdb.prepd {
+		logg.WarnCtxf(ctx, "ensureTable called more than once")
+		return nil
+	}
+	query := `CREATE TABLE IF NOT EXISTS kv_vise (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		key BLOB NOT NULL UNIQUE,
+		value BLOB NOT NULL,
+		updated TIMESTAMP NOT NULL
+	);
+`
+	_, err := sdb.conn.ExecContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	sdb.prepd = true
+	return nil
+}
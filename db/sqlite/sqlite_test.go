@@ -0,0 +1,197 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"git.defalsify.org/vise.git/db"
+	"git.defalsify.org/vise.git/db/dbtest"
+)
+
+func TestCasesSqlite(t *testing.T) {
+	ctx := context.Background()
+
+	store := NewSqliteDb()
+	f, err := ioutil.TempFile("", "vise-db-sqlite-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Connect(ctx, f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dbtest.RunTests(t, ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPutGetSqlite(t *testing.T) {
+	var dbi db.Db
+	ctx := context.Background()
+	sid := "ses"
+	f, err := ioutil.TempFile("", "vise-db-sqlite-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewSqliteDb()
+	store.SetPrefix(db.DATATYPE_USERDATA)
+	store.SetSession(sid)
+
+	dbi = store
+	_ = dbi
+
+	err = store.Connect(ctx, f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Put(ctx, []byte("foo"), []byte("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := store.Get(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v, []byte("bar")) {
+		t.Fatalf("expected value 'bar', found '%s'", v)
+	}
+	_, err = store.Get(ctx, []byte("bar"))
+	if err == nil {
+		t.Fatal("expected get error for key 'bar'")
+	}
+	err = store.Put(ctx, []byte("empty"), []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err = store.Get(ctx, []byte("empty"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != 0 {
+		t.Fatalf("expected empty value, found '%s'", v)
+	}
+}
+
+func TestTxSqlite(t *testing.T) {
+	ctx := context.Background()
+	f, err := ioutil.TempFile("", "vise-db-sqlite-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewSqliteDb()
+	err = store.Connect(ctx, f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetPrefix(db.DATATYPE_USERDATA)
+
+	err = store.Stop(ctx)
+	if err != db.ErrSingleTx {
+		t.Fatalf("expected ErrSingleTx, got %v", err)
+	}
+	err = store.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Start(ctx)
+	if err != db.ErrTxExist {
+		t.Fatalf("expected ErrTxExist, got %v", err)
+	}
+	err = store.Put(ctx, []byte("foo"), []byte("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := store.Get(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v, []byte("bar")) {
+		t.Fatalf("expected value 'bar', found '%s'", v)
+	}
+	store.Abort(ctx)
+	_, err = store.Get(ctx, []byte("foo"))
+	if err == nil {
+		t.Fatal("expected get error after abort")
+	}
+
+	err = store.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Put(ctx, []byte("foo"), []byte("baz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Stop(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err = store.Get(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v, []byte("baz")) {
+		t.Fatalf("expected value 'baz', found '%s'", v)
+	}
+}
+
+func TestSweepSqlite(t *testing.T) {
+	ctx := context.Background()
+	f, err := ioutil.TempFile("", "vise-db-sqlite-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewSqliteDb()
+	err = store.Connect(ctx, f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbtest.RunSweepTests(t, ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTxCommitOnCloseSqlite(t *testing.T) {
+	ctx := context.Background()
+	f, err := ioutil.TempFile("", "vise-db-sqlite-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewSqliteDb()
+	err = store.Connect(ctx, f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetPrefix(db.DATATYPE_USERDATA)
+	err = store.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Put(ctx, []byte("foo"), []byte("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store = NewSqliteDb()
+	err = store.Connect(ctx, f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetPrefix(db.DATATYPE_USERDATA)
+	v, err := store.Get(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v, []byte("bar")) {
+		t.Fatalf("expected 'bar', got: '%s'", v)
+	}
+}
@@ -0,0 +1,192 @@
+package debug
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"git.defalsify.org/vise.git/resource"
+	"git.defalsify.org/vise.git/state"
+	"git.defalsify.org/vise.git/vm"
+)
+
+// Edge is a navigation from one node to another.
+type Edge struct {
+	// From is the symbol of the node the navigation starts from.
+	From string
+	// To is the symbol of the node navigated to.
+	To string
+	// Label describes the condition for the navigation, e.g. an input selector or a flag.
+	Label string
+}
+
+// Graph is the navigation graph of all nodes reachable from a root node.
+type Graph struct {
+	root  string
+	nodes []string
+	edges []Edge
+}
+
+// NewGraph creates a new Graph for the nodes reachable from the given root symbol.
+func NewGraph(root string) *Graph {
+	return &Graph{
+		root: root,
+	}
+}
+
+// Run builds the graph using the given resource.
+//
+// Flag conditions are labelled with the names registered in state.FlagDebugger, when available.
+func (g *Graph) Run(ctx context.Context, rs resource.Resource) error {
+	nm := NewNodeMap(g.root)
+	err := nm.Run(ctx, rs)
+	if err != nil {
+		return err
+	}
+	g.nodes = []string{}
+	g.edges = []Edge{}
+	have := make(map[string]bool)
+	for _, sym := range nm.Nodes() {
+		have[sym] = true
+		g.nodes = append(g.nodes, sym)
+	}
+	for _, sym := range nm.Nodes() {
+		edges, err := g.parse(ctx, rs, sym)
+		if err != nil {
+			return err
+		}
+		for _, v := range edges {
+			if !have[v.To] {
+				have[v.To] = true
+				g.nodes = append(g.nodes, v.To)
+			}
+		}
+		g.edges = append(g.edges, edges...)
+	}
+	return nil
+}
+
+// Nodes returns the symbols of all nodes in the graph, starting with the root.
+func (g *Graph) Nodes() []string {
+	return g.nodes
+}
+
+// Edges returns all edges in the graph.
+func (g *Graph) Edges() []Edge {
+	return g.edges
+}
+
+// collect the navigation edges in the bytecode of a node.
+func (g *Graph) parse(ctx context.Context, rs resource.Resource, sym string) ([]Edge, error) {
+	var r []Edge
+	b, err := rs.GetCode(ctx, sym)
+	if err != nil {
+		return nil, err
+	}
+	edge := func(target string, label string) {
+		if isRelative(target) {
+			return
+		}
+		r = append(r, Edge{
+			From:  sym,
+			To:    target,
+			Label: label,
+		})
+	}
+	ph := vm.NewParseHandler().WithDefaultHandlers()
+	ph.InCmp = func(target string, sel string) error {
+		edge(target, sel)
+		return nil
+	}
+	ph.Move = func(target string) error {
+		edge(target, "")
+		return nil
+	}
+	ph.Catch = func(target string, flag uint32, inv bool) error {
+		edge(target, flagLabel(flag, inv))
+		return nil
+	}
+	ph.Call = func(target string) error {
+		edge(target, "call")
+		return nil
+	}
+	_, err = ph.ParseAll(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", sym, err)
+	}
+	return r, nil
+}
+
+// WriteDot writes the graph in the Graphviz DOT language.
+func (g *Graph) WriteDot(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "digraph %s {\n", strconv.Quote(g.root))
+	if err != nil {
+		return err
+	}
+	for _, v := range g.nodes {
+		_, err = fmt.Fprintf(w, "\t%s;\n", strconv.Quote(v))
+		if err != nil {
+			return err
+		}
+	}
+	for _, v := range g.edges {
+		var attr string
+		if v.Label != "" {
+			attr = fmt.Sprintf(" [label=%s]", strconv.Quote(v.Label))
+		}
+		_, err = fmt.Fprintf(w, "\t%s -> %s%s;\n", strconv.Quote(v.From), strconv.Quote(v.To), attr)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(w, "}\n")
+	return err
+}
+
+// WriteMermaid writes the graph as a Mermaid flowchart.
+//
+// Nodes are given generated identifiers, as node symbols may collide with Mermaid keywords.
+func (g *Graph) WriteMermaid(w io.Writer) error {
+	_, err := io.WriteString(w, "flowchart TD\n")
+	if err != nil {
+		return err
+	}
+	ids := make(map[string]string)
+	for i, v := range g.nodes {
+		ids[v] = "n" + strconv.Itoa(i)
+		_, err = fmt.Fprintf(w, "\t%s[\"%s\"]\n", ids[v], mermaidEscape(v))
+		if err != nil {
+			return err
+		}
+	}
+	for _, v := range g.edges {
+		var label string
+		if v.Label != "" {
+			label = fmt.Sprintf("|\"%s\"|", mermaidEscape(v.Label))
+		}
+		_, err = fmt.Fprintf(w, "\t%s -->%s %s\n", ids[v.From], label, ids[v.To])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// label for a CATCH flag condition, e.g. "FOO=1".
+func flagLabel(flag uint32, inv bool) string {
+	s, ok := state.FlagDebugger.Name(flag)
+	if !ok {
+		s = strconv.FormatUint(uint64(flag), 10)
+	}
+	if inv {
+		return s + "=1"
+	}
+	return s + "=0"
+}
+
+// escape characters with special meaning in Mermaid text.
+func mermaidEscape(s string) string {
+	return strings.ReplaceAll(s, "\"", "#quot;")
+}
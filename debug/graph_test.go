@@ -0,0 +1,74 @@
+package debug
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"git.defalsify.org/vise.git/internal/resourcetest"
+	"git.defalsify.org/vise.git/state"
+	"git.defalsify.org/vise.git/vm"
+)
+
+func TestGraph(t *testing.T) {
+	ctx := context.Background()
+	state.FlagDebugger.Register(9, "FOO")
+
+	rs := resourcetest.NewTestResource()
+	b := vm.NewLine(nil, vm.CATCH, []string{"end"}, []byte{0x09}, []uint8{1})
+	b = vm.NewLine(b, vm.HALT, nil, nil, nil)
+	b = vm.NewLine(b, vm.INCMP, []string{"foo", "0"}, nil, nil)
+	b = vm.NewLine(b, vm.INCMP, []string{"_", "9"}, nil, nil)
+	rs.AddBytecode(ctx, "root", b)
+	b = vm.NewLine(nil, vm.CATCH, []string{"end"}, []byte{0x0a}, []uint8{0})
+	b = vm.NewLine(b, vm.MOVE, []string{"bar"}, nil, nil)
+	rs.AddBytecode(ctx, "foo", b)
+	b = vm.NewLine(nil, vm.HALT, nil, nil, nil)
+	rs.AddBytecode(ctx, "end", b)
+	rs.Lock()
+
+	g := NewGraph("root")
+	err := g.Run(ctx, rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := bytes.NewBuffer(nil)
+	err = g.WriteDot(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `digraph "root" {
+	"root";
+	"foo";
+	"end";
+	"bar";
+	"root" -> "end" [label="FOO=1"];
+	"root" -> "foo" [label="0"];
+	"foo" -> "end" [label="10=0"];
+	"foo" -> "bar";
+}
+`
+	if w.String() != expect {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expect, w)
+	}
+
+	w = bytes.NewBuffer(nil)
+	err = g.WriteMermaid(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = `flowchart TD
+	n0["root"]
+	n1["foo"]
+	n2["end"]
+	n3["bar"]
+	n0 -->|"FOO=1"| n2
+	n0 -->|"0"| n1
+	n1 -->|"10=0"| n2
+	n1 --> n3
+`
+	if w.String() != expect {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expect, w)
+	}
+}
@@ -0,0 +1,275 @@
+package debug
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"git.defalsify.org/vise.git/lang"
+	"git.defalsify.org/vise.git/resource"
+	"git.defalsify.org/vise.git/vm"
+)
+
+// IssueKind identifies the type of problem found by the Linter.
+type IssueKind uint8
+
+const (
+	// Node exists but cannot be reached from the root node.
+	ISSUE_UNREACHABLE IssueKind = iota + 1
+	// Node is referenced but has no bytecode.
+	ISSUE_NO_CODE
+	// Node has no template.
+	ISSUE_NO_TEMPLATE
+	// Menu label has no translation for a language.
+	ISSUE_NO_TRANSLATION
+	// LOAD or RELOAD symbol has no registered EntryFunc.
+	ISSUE_NO_FUNC
+	// MAP symbol is not LOADed by any node.
+	ISSUE_NOT_LOADED
+	// Node yields for input without any INCMP to handle it.
+	ISSUE_NO_INPUT
+)
+
+var (
+	// IssueString maps issue kinds to a short description.
+	IssueString = map[IssueKind]string{
+		ISSUE_UNREACHABLE:    "unreachable node",
+		ISSUE_NO_CODE:        "missing bytecode",
+		ISSUE_NO_TEMPLATE:    "missing template",
+		ISSUE_NO_TRANSLATION: "missing menu translation",
+		ISSUE_NO_FUNC:        "no function for symbol",
+		ISSUE_NOT_LOADED:     "MAP of symbol never LOADed",
+		ISSUE_NO_INPUT:       "HALT without INCMP",
+	}
+)
+
+// Issue is a problem found by the Linter.
+type Issue struct {
+	// Kind is the type of problem.
+	Kind IssueKind
+	// Node is the symbol of the node the problem was found in.
+	Node string
+	// Sym is the symbol the problem concerns, if other than the node itself.
+	Sym string
+	// Detail adds optional context, e.g. the language of a missing translation.
+	Detail string
+}
+
+// String implements the String interface.
+func (i Issue) String() string {
+	s := fmt.Sprintf("%s: %s", i.Node, IssueString[i.Kind])
+	if i.Sym != "" {
+		s += ": " + i.Sym
+	}
+	if i.Detail != "" {
+		s += " (" + i.Detail + ")"
+	}
+	return s
+}
+
+// instructions of interest in the bytecode of a single node.
+type lintNode struct {
+	loads   []string
+	maps    []string
+	menus   []string
+	targets []string
+	halt    bool
+	incmp   bool
+}
+
+// Linter statically analyzes the node graph reachable from a root node for problems that
+// would otherwise only be found at runtime.
+type Linter struct {
+	root  string
+	nodes []string
+	langs []lang.Language
+	funcs map[string]bool
+}
+
+// NewLinter creates a new Linter for the graph starting at the given root symbol.
+func NewLinter(root string) *Linter {
+	return &Linter{
+		root:  root,
+		funcs: make(map[string]bool),
+	}
+}
+
+// WithNodes is a chainable function that sets all known node symbols.
+//
+// Nodes in the list that cannot be reached from the root will be reported.
+func (l *Linter) WithNodes(nodes []string) *Linter {
+	l.nodes = nodes
+	return l
+}
+
+// WithLanguage is a chainable function that adds a language to check menu translations for.
+func (l *Linter) WithLanguage(ln lang.Language) *Linter {
+	l.langs = append(l.langs, ln)
+	return l
+}
+
+// WithFunc is a chainable function that declares the symbol of an EntryFunc that will be registered at runtime.
+//
+// LOAD and RELOAD of the symbol will not be reported even if the resource cannot resolve it.
+func (l *Linter) WithFunc(sym string) *Linter {
+	l.funcs[sym] = true
+	return l
+}
+
+// Run analyzes the node graph using the given resource, and returns all problems found.
+func (l *Linter) Run(ctx context.Context, rs resource.Resource) ([]Issue, error) {
+	var r []Issue
+	nm := NewNodeMap(l.root)
+	err := nm.Run(ctx, rs)
+	if err != nil {
+		return nil, err
+	}
+	reached := make(map[string]bool)
+	nodes := make(map[string]*lintNode)
+	loaded := make(map[string]bool)
+	for _, sym := range nm.Nodes() {
+		reached[sym] = true
+		n, err := l.parse(ctx, rs, sym)
+		if err != nil {
+			return nil, err
+		}
+		nodes[sym] = n
+		for _, v := range n.loads {
+			loaded[v] = true
+		}
+	}
+
+	for _, sym := range nm.Nodes() {
+		r = append(r, l.check(ctx, rs, sym, nodes[sym], loaded)...)
+	}
+
+	var unreached []string
+	for _, sym := range l.nodes {
+		if !reached[sym] && sym != "_catch" {
+			unreached = append(unreached, sym)
+		}
+	}
+	sort.Strings(unreached)
+	for _, sym := range unreached {
+		r = append(r, Issue{Kind: ISSUE_UNREACHABLE, Node: sym})
+	}
+	return r, nil
+}
+
+// collect the instructions of interest in the bytecode of a node.
+func (l *Linter) parse(ctx context.Context, rs resource.Resource, sym string) (*lintNode, error) {
+	n := &lintNode{}
+	b, err := rs.GetCode(ctx, sym)
+	if err != nil {
+		return nil, err
+	}
+	target := func(sym string) {
+		if isRelative(sym) {
+			return
+		}
+		n.targets = append(n.targets, sym)
+	}
+	menu := func(sym string, sel string) error {
+		n.menus = append(n.menus, sym)
+		return nil
+	}
+	ph := vm.NewParseHandler().WithDefaultHandlers()
+	ph.Load = func(sym string, size uint32) error {
+		n.loads = append(n.loads, sym)
+		return nil
+	}
+	ph.Reload = func(sym string) error {
+		n.loads = append(n.loads, sym)
+		return nil
+	}
+	ph.Map = func(sym string) error {
+		n.maps = append(n.maps, sym)
+		return nil
+	}
+	ph.Halt = func() error {
+		n.halt = true
+		return nil
+	}
+	ph.InCmp = func(sym string, sel string) error {
+		n.incmp = true
+		target(sym)
+		return nil
+	}
+	ph.Move = func(sym string) error {
+		target(sym)
+		return nil
+	}
+	ph.Catch = func(sym string, flag uint32, inv bool) error {
+		target(sym)
+		return nil
+	}
+	ph.Call = func(sym string) error {
+		target(sym)
+		return nil
+	}
+	ph.MOut = menu
+	ph.MNext = menu
+	ph.MPrev = menu
+	_, err = ph.ParseAll(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", sym, err)
+	}
+	return n, nil
+}
+
+// check a single node for problems.
+func (l *Linter) check(ctx context.Context, rs resource.Resource, sym string, n *lintNode, loaded map[string]bool) []Issue {
+	var r []Issue
+	_, err := rs.GetTemplate(ctx, sym)
+	if err != nil {
+		r = append(r, Issue{Kind: ISSUE_NO_TEMPLATE, Node: sym})
+	}
+	for _, v := range n.targets {
+		_, err := rs.GetCode(ctx, v)
+		if err != nil {
+			r = append(r, Issue{Kind: ISSUE_NO_CODE, Node: sym, Sym: v})
+		}
+	}
+	for _, v := range n.loads {
+		if l.funcs[v] {
+			continue
+		}
+		_, err := rs.FuncFor(ctx, v)
+		if err != nil {
+			r = append(r, Issue{Kind: ISSUE_NO_FUNC, Node: sym, Sym: v})
+		}
+	}
+	for _, v := range n.maps {
+		if !loaded[v] {
+			r = append(r, Issue{Kind: ISSUE_NOT_LOADED, Node: sym, Sym: v})
+		}
+	}
+	tr, haveTr := rs.(resource.MenuTranslator)
+	for _, v := range n.menus {
+		dflt, _ := rs.GetMenu(ctx, v)
+		for _, ln := range l.langs {
+			// if the resource cannot tell whether the translation exists, a translation identical to the default is treated as missing.
+			if haveTr {
+				ok, err := tr.HasMenuTranslation(ctx, v, ln)
+				if err != nil || !ok {
+					r = append(r, Issue{Kind: ISSUE_NO_TRANSLATION, Node: sym, Sym: v, Detail: ln.Code})
+				}
+				continue
+			}
+			lctx := context.WithValue(ctx, "Language", ln)
+			s, err := rs.GetMenu(lctx, v)
+			if err != nil || s == dflt {
+				r = append(r, Issue{Kind: ISSUE_NO_TRANSLATION, Node: sym, Sym: v, Detail: ln.Code})
+			}
+		}
+	}
+	if n.halt && !n.incmp {
+		r = append(r, Issue{Kind: ISSUE_NO_INPUT, Node: sym})
+	}
+	return r
+}
+
+// true if the symbol is a relative navigation target rather than a node.
+func isRelative(sym string) bool {
+	return sym == "<" || sym == ">" || sym == "^" || sym == "_" || sym == "."
+}
@@ -0,0 +1,74 @@
+package debug
+
+import (
+	"context"
+	"testing"
+
+	"git.defalsify.org/vise.git/internal/resourcetest"
+	"git.defalsify.org/vise.git/lang"
+	"git.defalsify.org/vise.git/resource"
+	"git.defalsify.org/vise.git/vm"
+)
+
+func TestLint(t *testing.T) {
+	ctx := context.Background()
+	ln, err := lang.LanguageFromCode("nor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lctx := context.WithValue(ctx, "Language", ln)
+
+	rs := resourcetest.NewTestResource()
+	b := vm.NewLine(nil, vm.MOUT, []string{"foo", "0"}, nil, nil)
+	b = vm.NewLine(b, vm.MOUT, []string{"bar", "1"}, nil, nil)
+	b = vm.NewLine(b, vm.MOUT, []string{"ok", "2"}, nil, nil)
+	b = vm.NewLine(b, vm.HALT, nil, nil, nil)
+	b = vm.NewLine(b, vm.INCMP, []string{"foo", "0"}, nil, nil)
+	b = vm.NewLine(b, vm.INCMP, []string{"bar", "1"}, nil, nil)
+	rs.AddBytecode(ctx, "root", b)
+	b = vm.NewLine(nil, vm.LOAD, []string{"one"}, []byte{0x00}, nil)
+	b = vm.NewLine(b, vm.LOAD, []string{"two"}, []byte{0x00}, nil)
+	b = vm.NewLine(b, vm.LOAD, []string{"three"}, []byte{0x00}, nil)
+	b = vm.NewLine(b, vm.MAP, []string{"one"}, nil, nil)
+	b = vm.NewLine(b, vm.MAP, []string{"four"}, nil, nil)
+	b = vm.NewLine(b, vm.HALT, nil, nil, nil)
+	rs.AddBytecode(ctx, "foo", b)
+	b = vm.NewLine(nil, vm.MOVE, []string{"baz"}, nil, nil)
+	rs.AddBytecode(ctx, "bar", b)
+	b = vm.NewLine(nil, vm.HALT, nil, nil, nil)
+	rs.AddBytecode(ctx, "qux", b)
+	rs.AddTemplate(ctx, "root", "root")
+	rs.AddTemplate(ctx, "foo", "foo")
+	rs.AddMenu(ctx, "foo_menu", "to foo")
+	rs.AddMenu(lctx, "foo_menu", "til foo")
+	rs.AddMenu(ctx, "bar_menu", "to bar")
+	rs.AddMenu(ctx, "ok_menu", "OK")
+	rs.AddMenu(lctx, "ok_menu", "OK")
+	rs.AddLocalFunc("one", func(ctx context.Context, sym string, input []byte) (resource.Result, error) {
+		return resource.Result{}, nil
+	})
+	rs.Lock()
+
+	lt := NewLinter("root").WithNodes([]string{"root", "foo", "bar", "qux", "_catch"}).WithLanguage(ln).WithFunc("two")
+	r, err := lt.Run(ctx, rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		"root: missing menu translation: bar (nor)",
+		"bar: missing template",
+		"bar: missing bytecode: baz",
+		"foo: no function for symbol: three",
+		"foo: MAP of symbol never LOADed: four",
+		"foo: HALT without INCMP",
+		"qux: unreachable node",
+	}
+	if len(r) != len(expect) {
+		t.Fatalf("expected %d issues, got %d: %v", len(expect), len(r), r)
+	}
+	for i, v := range r {
+		if v.String() != expect[i] {
+			t.Fatalf("issue %d: expected '%s', got '%s'", i, expect[i], v)
+		}
+	}
+}
@@ -91,3 +91,20 @@ func (nm *NodeMap) Apply(nodeFunc func(*Node) error) error {
 	}
 	return err
 }
+
+// Nodes returns the symbols of all nodes visited by Run, starting with the root.
+func (nm *NodeMap) Nodes() []string {
+	var r []string
+	seen := make(map[string]bool)
+	l := len(nm.outs)
+	for i := l; i > 0; i-- {
+		p := strings.Split(nm.outs[i-1], "/")
+		sym := p[len(p)-1]
+		if seen[sym] {
+			continue
+		}
+		seen[sym] = true
+		r = append(r, sym)
+	}
+	return r
+}
@@ -16,6 +16,7 @@ type NodeParseHandler struct {
 	parentMoveFunc  func(string) error
 	parentInCmpFunc func(string, string) error
 	parentCatchFunc func(string, uint32, bool) error
+	parentCallFunc  func(string) error
 }
 
 func NewNodeParseHandler(node *Node) *NodeParseHandler {
@@ -28,10 +29,12 @@ func NewNodeParseHandler(node *Node) *NodeParseHandler {
 	np.parentInCmpFunc = np.ParseHandler.InCmp
 	np.parentCatchFunc = np.ParseHandler.Catch
 	np.parentMOutFunc = np.ParseHandler.MOut
+	np.parentCallFunc = np.ParseHandler.Call
 	np.Move = np.move
 	np.InCmp = np.incmp
 	np.Catch = np.catch
 	np.MOut = np.mout
+	np.Call = np.call
 	return np
 }
 
@@ -82,3 +85,12 @@ func (np *NodeParseHandler) catch(sym string, flag uint32, inv bool) error {
 	logg.Debugf("connect CATCH", "src", np.node.Name, "dst", node.Name)
 	return np.parentCatchFunc(sym, flag, inv)
 }
+
+func (np *NodeParseHandler) call(sym string) error {
+	var node Node
+
+	node.Name = sym
+	np.node.Connect(node)
+	logg.Debugf("connect CALL", "src", np.node.Name, "dst", node.Name)
+	return np.parentCallFunc(sym)
+}
@@ -14,8 +14,10 @@ import (
 	"strings"
 
 	"git.defalsify.org/vise.git/db"
+	boltdb "git.defalsify.org/vise.git/db/bolt"
 	fsdb "git.defalsify.org/vise.git/db/fs"
 	gdbmdb "git.defalsify.org/vise.git/db/gdbm"
+	sqlitedb "git.defalsify.org/vise.git/db/sqlite"
 	"git.defalsify.org/vise.git/logging"
 )
 
@@ -23,6 +25,7 @@ var (
 	binaryPrefix     = ".bin"
 	menuPrefix       = "menu"
 	staticloadPrefix = ".txt"
+	srcmapPrefix     = ".map"
 	templatePrefix   = ""
 	scan             = make(map[string]string)
 	logg             = logging.NewVanilla()
@@ -31,6 +34,7 @@ var (
 		db.DATATYPE_TEMPLATE:   "TEMPLATE",
 		db.DATATYPE_MENU:       "MENU",
 		db.DATATYPE_STATICLOAD: "STATICLOAD",
+		db.DATATYPE_SRCMAP:     "SRCMAP",
 	}
 )
 
@@ -80,6 +84,8 @@ func (sc *scanner) Scan(fp string, d fs.DirEntry, err error) error {
 		}
 	case staticloadPrefix:
 		sc.db.SetPrefix(db.DATATYPE_STATICLOAD)
+	case srcmapPrefix:
+		sc.db.SetPrefix(db.DATATYPE_SRCMAP)
 	default:
 		log.Printf("skip foreign file: %s", fp)
 		return nil
@@ -115,8 +121,10 @@ func main() {
 	var dbPath string
 	var dbFile string
 	var dbBackend string
+	var snapshot string
 	flag.StringVar(&dbPath, "d", "", "output directory")
-	flag.StringVar(&dbBackend, "backend", "gdbm", "db backend. valid choices are: gdbm (default), fs")
+	flag.StringVar(&dbBackend, "backend", "gdbm", "db backend. valid choices are: gdbm (default), bolt, fs, sqlite")
+	flag.StringVar(&snapshot, "snapshot", "", "write to the named snapshot. valid for backends: fs")
 	flag.Parse()
 
 	ctx := context.Background()
@@ -124,8 +132,30 @@ func main() {
 	case "gdbm":
 		store = gdbmdb.NewGdbmDb()
 		dbFile = "vise_resources.gdbm"
+	case "bolt":
+		store = boltdb.NewBoltDb()
+		dbFile = "vise_resources.bolt"
 	case "fs":
 		store = fsdb.NewFsDb()
+	case "sqlite":
+		store = sqlitedb.NewSqliteDb()
+		dbFile = "vise_resources.sqlite"
+	default:
+		fmt.Fprintf(os.Stderr, "invalid backend: %s", dbBackend)
+		os.Exit(1)
+	}
+
+	if snapshot != "" {
+		sn, ok := store.(db.Snapshotter)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "backend %s does not support snapshots", dbBackend)
+			os.Exit(1)
+		}
+		err = sn.SetSnapshot(snapshot)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid snapshot: %s", err)
+			os.Exit(1)
+		}
 	}
 
 	dir = flag.Arg(0)
@@ -156,6 +186,7 @@ func main() {
 	store.SetLock(db.DATATYPE_TEMPLATE, false)
 	store.SetLock(db.DATATYPE_MENU, false)
 	store.SetLock(db.DATATYPE_STATICLOAD, false)
+	store.SetLock(db.DATATYPE_SRCMAP, false)
 
 	o, err := newScanner(ctx, store)
 	if err != nil {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -9,16 +10,32 @@ import (
 )
 
 func main() {
-	if len(os.Args) < 2 {
+	var smfp string
+	flag.StringVar(&smfp, "m", "", "source map to annotate instructions with")
+	flag.Parse()
+	if len(flag.Args()) < 1 {
 		os.Exit(1)
 	}
-	fp := os.Args[1]
+	fp := flag.Arg(0)
 	v, err := ioutil.ReadFile(fp)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "read error: %v", err)
 		os.Exit(1)
 	}
 	ph := vm.NewParseHandler().WithDefaultHandlers()
+	if len(smfp) > 0 {
+		b, err := ioutil.ReadFile(smfp)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "read error: %v", err)
+			os.Exit(1)
+		}
+		sm, err := vm.ParseSourceMap(b)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "source map error: %v", err)
+			os.Exit(1)
+		}
+		ph = ph.WithSourceMap(sm)
+	}
 	r, err := ph.ToString(v)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "parse error: %v", err)
@@ -0,0 +1,2 @@
+// Executable graph exports the navigation graph of compiled bytecode as a DOT or Mermaid diagram.
+package main
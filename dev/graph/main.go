@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"git.defalsify.org/vise.git/asm"
+	"git.defalsify.org/vise.git/db"
+	fsdb "git.defalsify.org/vise.git/db/fs"
+	"git.defalsify.org/vise.git/db/postgres"
+	"git.defalsify.org/vise.git/debug"
+	"git.defalsify.org/vise.git/resource"
+)
+
+func main() {
+	var dir string
+	var connStr string
+	var root string
+	var flagFile string
+	var format string
+
+	flag.StringVar(&dir, "d", ".", "resource dir to read from")
+	flag.StringVar(&connStr, "pg", "", "postgres connection string to read resources from instead of resource dir")
+	flag.StringVar(&root, "root", "root", "entry point symbol")
+	flag.StringVar(&flagFile, "f", "", "flag names to label flag conditions with")
+	flag.StringVar(&format, "format", "dot", "output format (dot, mermaid)")
+	flag.Parse()
+
+	if format != "dot" && format != "mermaid" {
+		fmt.Fprintf(os.Stderr, "unknown output format: %s\n", format)
+		os.Exit(1)
+	}
+
+	if flagFile != "" {
+		_, err := asm.NewFlagParser().WithDebug().Load(flagFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "flag file load error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	ctx := context.Background()
+	var store db.Db
+	if connStr != "" {
+		store = postgres.NewPgDb()
+	} else {
+		store = fsdb.NewFsDb()
+		connStr = dir
+	}
+	err := store.Connect(ctx, connStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "resource db connect error: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close(ctx)
+
+	rs := resource.NewDbResource(store)
+	g := debug.NewGraph(root)
+	err = g.Run(ctx, rs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "node tree process fail: %v\n", err)
+		os.Exit(1)
+	}
+
+	if format == "mermaid" {
+		err = g.WriteMermaid(os.Stdout)
+	} else {
+		err = g.WriteDot(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "write error: %v\n", err)
+		os.Exit(1)
+	}
+}
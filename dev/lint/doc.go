@@ -0,0 +1,2 @@
+// Executable lint reports problems in the node graph of compiled bytecode, templates and menus.
+package main
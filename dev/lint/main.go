@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"git.defalsify.org/vise.git/db"
+	fsdb "git.defalsify.org/vise.git/db/fs"
+	"git.defalsify.org/vise.git/db/postgres"
+	"git.defalsify.org/vise.git/debug"
+	"git.defalsify.org/vise.git/lang"
+	"git.defalsify.org/vise.git/resource"
+)
+
+type langVar struct {
+	v []lang.Language
+}
+
+func (lv *langVar) Set(s string) error {
+	v, err := lang.LanguageFromCode(s)
+	if err != nil {
+		return err
+	}
+	lv.v = append(lv.v, v)
+	return err
+}
+
+func (lv *langVar) String() string {
+	var s []string
+	for _, v := range lv.v {
+		s = append(s, v.Code)
+	}
+	return strings.Join(s, ",")
+}
+
+type funcVar struct {
+	v []string
+}
+
+func (fv *funcVar) Set(s string) error {
+	fv.v = append(fv.v, s)
+	return nil
+}
+
+func (fv *funcVar) String() string {
+	return strings.Join(fv.v, ",")
+}
+
+// node symbols of all bytecode files in a resource directory.
+func nodesFromDir(dir string) ([]string, error) {
+	var r []string
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range entries {
+		fb := v.Name()
+		if v.IsDir() || !strings.HasSuffix(fb, ".bin") {
+			continue
+		}
+		r = append(r, strings.TrimSuffix(fb, ".bin"))
+	}
+	return r, nil
+}
+
+// node symbols of all bytecode entries in a db.
+func nodesFromDb(ctx context.Context, store db.Db) ([]string, error) {
+	var r []string
+	store.SetPrefix(db.DATATYPE_BIN)
+	d, err := store.Dump(ctx, []byte{})
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	for k, _ := d.Next(ctx); k != nil; k, _ = d.Next(ctx) {
+		r = append(r, string(k))
+	}
+	return r, nil
+}
+
+func main() {
+	var dir string
+	var connStr string
+	var root string
+	var langs langVar
+	var funcs funcVar
+	var nodes []string
+
+	flag.StringVar(&dir, "d", ".", "resource dir to read from")
+	flag.StringVar(&connStr, "pg", "", "postgres connection string to read resources from instead of resource dir")
+	flag.StringVar(&root, "root", "root", "entry point symbol")
+	flag.Var(&langs, "l", "check menu translations for language")
+	flag.Var(&funcs, "func", "symbol of external function registered at runtime")
+	flag.Parse()
+
+	ctx := context.Background()
+	var store db.Db
+	var err error
+	if connStr != "" {
+		store = postgres.NewPgDb()
+		err = store.Connect(ctx, connStr)
+		if err == nil {
+			nodes, err = nodesFromDb(ctx, store)
+		}
+	} else {
+		store = fsdb.NewFsDb()
+		err = store.Connect(ctx, dir)
+		if err == nil {
+			nodes, err = nodesFromDir(dir)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "resource db error: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close(ctx)
+
+	rs := resource.NewDbResource(store)
+	rs = rs.With(db.DATATYPE_STATICLOAD)
+
+	lt := debug.NewLinter(root).WithNodes(nodes)
+	for _, ln := range langs.v {
+		lt = lt.WithLanguage(ln)
+	}
+	for _, sym := range funcs.v {
+		lt = lt.WithFunc(sym)
+	}
+	r, err := lt.Run(ctx, rs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lint error: %v\n", err)
+		os.Exit(1)
+	}
+	for _, v := range r {
+		fmt.Println(v)
+	}
+	if len(r) > 0 {
+		os.Exit(1)
+	}
+}
@@ -2,12 +2,26 @@ package engine
 
 import (
 	"fmt"
+	"text/template"
+	"time"
+
+	"git.defalsify.org/vise.git/render"
 )
 
 // Config globally defines behavior of all components driven by the engine.
 type Config struct {
 	// OutputSize sets the maximum size of output from a single rendered page. If set to 0, no size limit is imposed.
 	OutputSize uint32
+	// SizeFunc sets the function used to measure the size of output and cached content, in the same unit as OutputSize, e.g. render.Gsm7Size. If not set, the size is the number of bytes.
+	SizeFunc render.SizeFunc
+	// PageSizeFunc sets the function used to choose how to measure the parts of a page, given all text of the page. It must be set if the size of a text depends on all of it, e.g. render.Gsm7PageSize for render.Gsm7Size.
+	PageSizeFunc render.PageSizeFunc
+	// TemplateFuncs adds functions to use in templates, in addition to the built-in functions of render.FuncMap.
+	TemplateFuncs template.FuncMap
+	// ContinuationMarker is appended to the parts of a sink value that is too long for a single page, and therefore is continued on the next page.
+	ContinuationMarker string
+	// SinkShares sets the share of the page for sink symbols, when several sinks are mapped on the same page. Sinks not included have a weight of 1 and no minimum.
+	SinkShares map[string]render.SinkShare
 	// SessionId is used to segment the context of state and application data retrieval and storage.
 	SessionId string
 	// Root is the node name of the bytecode entry point.
@@ -28,6 +42,8 @@ type Config struct {
 	ResetOnEmptyInput bool
 	// ResetRoot purges cache for the root node on a engine reset.
 	ResetRoot bool
+	// TTL sets the time-to-live of persisted state. Expired state is treated as a new session. If set to 0, state never expires.
+	TTL time.Duration
 }
 
 // String implements the string interface.
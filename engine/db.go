@@ -33,6 +33,7 @@ type DefaultEngine struct {
 	exit       string
 	exiting    bool
 	execd      bool
+	cont       bool
 	regexCount int
 }
 
@@ -248,6 +249,9 @@ func (en *DefaultEngine) ensurePersist() error {
 		en.ca = cac
 	}
 	en.pe = en.pe.WithContent(st, cac)
+	if en.cfg.TTL > 0 {
+		en.pe = en.pe.WithTTL(en.cfg.TTL)
+	}
 	err := en.pe.Load(en.cfg.SessionId)
 	if err != nil {
 		logg.Infof("persister load fail. trying save in case new session", "err", err, "session", en.cfg.SessionId)
@@ -269,12 +273,24 @@ func (en *DefaultEngine) ensurePersist() error {
 func (en *DefaultEngine) setupVm() {
 	var szr *render.Sizer
 	if en.cfg.OutputSize > 0 {
-		szr = render.NewSizer(en.cfg.OutputSize)
+		szr = render.NewSizer(en.cfg.OutputSize).WithSizeFunc(en.cfg.SizeFunc).WithPageSizeFunc(en.cfg.PageSizeFunc).WithContinuation(en.cfg.ContinuationMarker)
+		for k, v := range en.cfg.SinkShares {
+			szr = szr.WithSinkShare(k, v)
+		}
+	}
+	if en.cfg.SizeFunc != nil {
+		cac, ok := en.ca.(*cache.Cache)
+		if ok {
+			cac.WithSizeFunc(en.cfg.SizeFunc)
+		}
 	}
 	en.vm = vm.NewVm(en.st, en.rs, en.ca, szr)
 	if en.cfg.MenuSeparator != "" {
 		en.vm = en.vm.WithMenuSeparator(en.cfg.MenuSeparator)
 	}
+	if en.cfg.TemplateFuncs != nil {
+		en.vm = en.vm.WithTemplateFuncs(en.cfg.TemplateFuncs)
+	}
 }
 
 func (en *DefaultEngine) empty(ctx context.Context) error {
@@ -534,6 +550,7 @@ func (en *DefaultEngine) exec(ctx context.Context, input []byte) (bool, error) {
 		return false, err
 	}
 	en.execd = true
+	en.cont = false
 	logg.Debugf("end VM run", "code", code, "state", en.st.String(), "vm", en.vm)
 
 	v := en.st.MatchFlag(state.FLAG_TERMINATE, true)
@@ -544,6 +561,7 @@ func (en *DefaultEngine) exec(ctx context.Context, input []byte) (bool, error) {
 		return false, err
 	}
 	cont, err := en.setCode(ctx, code)
+	en.cont = cont
 	if en.dbg != nil {
 		en.dbg.Break(en.st, en.ca)
 	}
@@ -563,6 +581,9 @@ func (en *DefaultEngine) Flush(ctx context.Context, w io.Writer) (int, error) {
 	if !en.execd {
 		return 0, ErrFlushNoExec
 	}
+	if en.cfg.SessionId != "" {
+		ctx = context.WithValue(ctx, "SessionId", en.cfg.SessionId)
+	}
 	if en.st.Language != nil {
 		ctx = context.WithValue(ctx, "Language", *en.st.Language)
 	}
@@ -596,6 +617,44 @@ func (en *DefaultEngine) Flush(ctx context.Context, w io.Writer) (int, error) {
 	return l, err
 }
 
+// FlushOutput is the same as Flush, but returns the output of the last vm execution as structured data.
+//
+// Output from a quitting node is appended to the Text field.
+//
+// Fails under the same conditions as Flush.
+func (en *DefaultEngine) FlushOutput(ctx context.Context) (*Output, error) {
+	if !en.execd {
+		return nil, ErrFlushNoExec
+	}
+	if en.cfg.SessionId != "" {
+		ctx = context.WithValue(ctx, "SessionId", en.cfg.SessionId)
+	}
+	if en.st.Language != nil {
+		ctx = context.WithValue(ctx, "Language", *en.st.Language)
+	}
+	logg.TraceCtxf(ctx, "render output with state", "state", en.st)
+	o := &Output{
+		Continue: en.cont,
+	}
+	r, err := en.vm.RenderOutput(ctx)
+	if err != nil {
+		if len(en.exit) == 0 {
+			return nil, err
+		}
+	} else if r != nil {
+		o.Output = *r
+	}
+	if len(en.exit) > 0 {
+		logg.TraceCtxf(ctx, "have exit", "exit", en.exit)
+		o.Text += en.exit
+	}
+	if en.exiting {
+		_, err = en.reset(ctx)
+		en.exiting = false
+	}
+	return o, err
+}
+
 // start execution over at top node while keeping current state of client error flags.
 func (en *DefaultEngine) Reset(ctx context.Context, force bool) (bool, error) {
 	if en.st.Depth() == -1 {
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"io"
+
+	"git.defalsify.org/vise.git/render"
 )
 
 var (
@@ -23,3 +25,10 @@ type Engine interface {
 	// Finish must be called after the last call to Exec.
 	Finish(ctx context.Context) error
 }
+
+// Output is the structured output of a vm execution, as returned by DefaultEngine.FlushOutput.
+type Output struct {
+	render.Output
+	// Continue is set if the session is awaiting more input.
+	Continue bool `json:"continue"`
+}
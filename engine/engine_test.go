@@ -3,6 +3,7 @@ package engine
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 
 	//	"io/ioutil"
@@ -183,6 +184,60 @@ it has more lines
 	}
 }
 
+func TestEngineFlushOutput(t *testing.T) {
+	var err error
+	generateTestData(t)
+	ctx := context.Background()
+	st := state.NewState(17)
+	rs := newTestWrapper(dataDir, st)
+	ca := cache.NewCache().WithCacheSize(1024)
+
+	cfg := Config{
+		Root: "root",
+	}
+	en := NewEngine(cfg, &rs)
+	en = en.WithState(st)
+	en = en.WithMemory(ca)
+
+	_, err = en.FlushOutput(ctx)
+	if err != ErrFlushNoExec {
+		t.Fatalf("expected ErrFlushNoExec, got %v", err)
+	}
+
+	cont, err := en.Exec(ctx, []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := en.FlushOutput(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Continue != cont {
+		t.Fatalf("expected continue %v, got %v", cont, o.Continue)
+	}
+	if o.Node != "root" {
+		t.Fatalf("expected node 'root', got '%s'", o.Node)
+	}
+	if o.Text != "hello world" {
+		t.Fatalf("expected text 'hello world', got '%s'", o.Text)
+	}
+	if len(o.Menu) != 3 {
+		t.Fatalf("expected 3 menu items, got %v", o.Menu)
+	}
+	if o.Menu[1].Selector != "2" || o.Menu[1].Label != "go to the bar" {
+		t.Fatalf("unexpected menu item: %v", o.Menu[1])
+	}
+
+	b, err := json.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"node":"root","text":"hello world","menu":[{"selector":"1","label":"do the foo"},{"selector":"2","label":"go to the bar"},{"selector":"3","label":"language template"}],"page":0,"page_count":0,"next":false,"previous":false,"continue":true}`
+	if string(b) != expect {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s", expect, b)
+	}
+}
+
 func TestEngineExecInvalidInput(t *testing.T) {
 	generateTestData(t)
 	ctx := context.Background()
@@ -0,0 +1,441 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"git.defalsify.org/vise.git/db"
+	"git.defalsify.org/vise.git/lang"
+	"git.defalsify.org/vise.git/persist"
+	"git.defalsify.org/vise.git/resource"
+	"git.defalsify.org/vise.git/state"
+)
+
+// EngineFunc is a function that is applied to every new engine created by the Manager.
+//
+// It can be used to set up the engine further, e.g. with WithFirst or WithDebug.
+type EngineFunc func(sessionId string, en *DefaultEngine) *DefaultEngine
+
+// Manager hands out engines for individual sessions, sharing a single resource and persistence backend.
+//
+// Concurrent requests for the same session are serialized. Requests for different sessions may run
+// concurrently. Each single operation on the shared resource and persistence backends is serialized by the
+// Manager, as the backends keep a storage context between calls. The resource and the persistence backend
+// are locked independently of each other.
+//
+// Engines of sessions that have not been used for the duration of the idle timeout are evicted by Sweep.
+//
+// If Config.TTL is set, a session that has not been used for longer than the TTL starts over as a new session.
+type Manager struct {
+	cfg      Config
+	rs       *sharedResource
+	store    db.Db
+	fn       EngineFunc
+	idle     time.Duration
+	mu       sync.Mutex
+	rmu      sync.Mutex
+	dmu      sync.Mutex
+	sessions map[string]*managedSession
+}
+
+// a session handled by the Manager.
+type managedSession struct {
+	mu   sync.Mutex
+	en   *DefaultEngine
+	last time.Time
+	refs int
+}
+
+// NewManager creates a new Manager.
+//
+// The configuration is used as a template for all engines, with the SessionId replaced by that of each session.
+//
+// If store is not nil, state and memory of each session will be persisted to it after every request.
+func NewManager(cfg Config, rs resource.Resource, store db.Db) *Manager {
+	if rs == nil {
+		panic("resource cannot be nil")
+	}
+	m := &Manager{
+		cfg:      cfg,
+		store:    store,
+		idle:     time.Minute * 5,
+		sessions: make(map[string]*managedSession),
+	}
+	m.rs = &sharedResource{
+		Resource: rs,
+		mu:       &m.rmu,
+	}
+	return m
+}
+
+// WithIdleTimeout is a chainable function that sets the duration after which an unused session will be evicted by Sweep.
+//
+// Default is five minutes.
+func (m *Manager) WithIdleTimeout(d time.Duration) *Manager {
+	m.idle = d
+	return m
+}
+
+// WithEngineFunc is a chainable function that sets a function to apply to every new engine.
+func (m *Manager) WithEngineFunc(fn EngineFunc) *Manager {
+	m.fn = fn
+	return m
+}
+
+// Exec executes the input for the given session, and writes the rendered output to the writer.
+//
+// The session engine is created on first use. If a persistence backend is set, the state of the session
+// is restored from it, and saved again after the execution.
+//
+// A bool return value of false indicates that the session has terminated, and the engine is discarded. If the resource implements resource.Unpinner, the session is also unpinned from it.
+//
+// If execution fails, the engine is discarded without saving, and will be restored from the last persisted state on the next request.
+//
+// Invalid input does not discard the engine. The error is then returned with a bool value of true, and the current page is
+// written to the writer again, so that the end-user can retry.
+func (m *Manager) Exec(ctx context.Context, sessionId string, input []byte, w io.Writer) (bool, error) {
+	if sessionId == "" {
+		return false, errors.New("session id cannot be empty")
+	}
+	s := m.acquire(sessionId)
+	defer m.release(sessionId, s)
+
+	if s.en != nil && m.cfg.TTL > 0 && time.Since(s.last) > m.cfg.TTL {
+		logg.InfoCtxf(ctx, "session expired", "session", sessionId, "last", s.last)
+		s.en = nil
+	}
+	if s.en == nil {
+		s.en = m.newEngine(sessionId)
+	}
+	en := s.en
+	cont, err := en.Exec(ctx, input)
+	if err != nil {
+		if !cont {
+			s.en = nil
+			return cont, err
+		}
+		// re-render the page the input was rejected for
+		en.execd = true
+		_ = en.st.SetFlag(state.FLAG_DIRTY)
+		_, ferr := en.Flush(ctx, w)
+		if ferr != nil {
+			logg.WarnCtxf(ctx, "could not render current page after invalid input", "session", sessionId, "err", ferr)
+		}
+		return cont, err
+	}
+	_, err = en.Flush(ctx, w)
+	if err != nil {
+		s.en = nil
+		return false, err
+	}
+	if !cont {
+		s.en = nil
+		err = en.Finish(ctx)
+		m.rs.unpin(ctx, sessionId)
+		return cont, err
+	}
+	if en.pe != nil {
+		err = en.pe.Save(sessionId)
+		if err != nil {
+			s.en = nil
+			return false, err
+		}
+	}
+	return cont, nil
+}
+
+// Sweep evicts the engines of all sessions that have been idle for longer than the idle timeout.
+//
+// It returns the number of sessions evicted.
+//
+// The method is meant to be called periodically, e.g. from a time.Ticker loop.
+func (m *Manager) Sweep(ctx context.Context) (int, error) {
+	var c int
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for k, s := range m.sessions {
+		if s.refs > 0 || now.Sub(s.last) < m.idle {
+			continue
+		}
+		m.evict(s)
+		delete(m.sessions, k)
+		c += 1
+	}
+	logg.DebugCtxf(ctx, "swept sessions", "evicted", c, "remaining", len(m.sessions))
+	return c, nil
+}
+
+// Sessions returns the number of sessions with an active engine.
+func (m *Manager) Sessions() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+// Close evicts all sessions, and closes the resource.
+func (m *Manager) Close(ctx context.Context) error {
+	m.mu.Lock()
+	for k, s := range m.sessions {
+		s.mu.Lock()
+		m.evict(s)
+		s.mu.Unlock()
+		delete(m.sessions, k)
+	}
+	m.mu.Unlock()
+	return m.rs.Resource.Close(ctx)
+}
+
+// get the session with the given id, and wait for exclusive access to it.
+func (m *Manager) acquire(sessionId string) *managedSession {
+	m.mu.Lock()
+	s, ok := m.sessions[sessionId]
+	if !ok {
+		s = &managedSession{}
+		m.sessions[sessionId] = s
+	}
+	s.refs += 1
+	m.mu.Unlock()
+	s.mu.Lock()
+	return s
+}
+
+// release exclusive access to the session, and forget it if the engine has been discarded.
+func (m *Manager) release(sessionId string, s *managedSession) {
+	s.last = time.Now()
+	s.mu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.refs -= 1
+	if s.refs == 0 && s.en == nil {
+		delete(m.sessions, sessionId)
+	}
+}
+
+// discard the engine of the session.
+//
+// The engine is not finished, as its state has already been persisted at the end of its last execution.
+// Saving it again would renew the time-to-live of the persisted state.
+func (m *Manager) evict(s *managedSession) {
+	s.en = nil
+}
+
+// create a new engine for the session.
+func (m *Manager) newEngine(sessionId string) *DefaultEngine {
+	cfg := m.cfg
+	cfg.SessionId = sessionId
+	en := NewEngine(cfg, m.rs)
+	if m.store != nil {
+		store := &sharedDb{
+			Db: m.store,
+			mu: &m.dmu,
+		}
+		en = en.WithPersister(persist.NewPersister(store))
+	}
+	if m.fn != nil {
+		en = m.fn(sessionId, en)
+	}
+	return en
+}
+
+// resource.Resource shared between engines, serializing access to the backend.
+//
+// Close is a noop, as the resource is closed by the Manager.
+type sharedResource struct {
+	resource.Resource
+	mu *sync.Mutex
+}
+
+// GetTemplate implements the resource.Resource interface.
+func (sr *sharedResource) GetTemplate(ctx context.Context, sym string) (string, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	return sr.Resource.GetTemplate(ctx, sym)
+}
+
+// GetCode implements the resource.Resource interface.
+func (sr *sharedResource) GetCode(ctx context.Context, sym string) ([]byte, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	return sr.Resource.GetCode(ctx, sym)
+}
+
+// GetMenu implements the resource.Resource interface.
+func (sr *sharedResource) GetMenu(ctx context.Context, sym string) (string, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	return sr.Resource.GetMenu(ctx, sym)
+}
+
+// FuncFor implements the resource.Resource interface.
+func (sr *sharedResource) FuncFor(ctx context.Context, sym string) (resource.EntryFunc, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	return sr.Resource.FuncFor(ctx, sym)
+}
+
+// GetSourceMap implements the resource.SourceMapper interface.
+func (sr *sharedResource) GetSourceMap(ctx context.Context, sym string) ([]byte, error) {
+	smr, ok := sr.Resource.(resource.SourceMapper)
+	if !ok {
+		return nil, errors.New("resource does not provide source maps")
+	}
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	return smr.GetSourceMap(ctx, sym)
+}
+
+// Close implements the resource.Resource interface.
+func (sr *sharedResource) Close(ctx context.Context) error {
+	return nil
+}
+
+// release the state kept for an ended session, if the shared resource implements resource.Unpinner.
+func (sr *sharedResource) unpin(ctx context.Context, sessionId string) {
+	up, ok := sr.Resource.(resource.Unpinner)
+	if !ok {
+		return
+	}
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	err := up.Unpin(ctx, sessionId)
+	if err != nil {
+		logg.WarnCtxf(ctx, "resource unpin failed", "session", sessionId, "err", err)
+	}
+}
+
+// db.Db shared between engines.
+//
+// Each instance keeps its own prefix, session and language context, which is applied to the
+// shared backend on every access, while holding the lock. Key locks are taken without holding the lock.
+//
+// It implements db.Locker and db.Sweeper, which are forwarded to the shared backend if it implements them.
+type sharedDb struct {
+	db.Db
+	mu  *sync.Mutex
+	pfx uint8
+	sid string
+	ln  *lang.Language
+}
+
+// apply the storage context of the instance to the shared backend.
+func (sd *sharedDb) apply() {
+	sd.Db.SetPrefix(sd.pfx)
+	sd.Db.SetSession(sd.sid)
+	sd.Db.SetLanguage(sd.ln)
+}
+
+// SetPrefix implements the db.Db interface.
+func (sd *sharedDb) SetPrefix(pfx uint8) {
+	sd.pfx = pfx
+}
+
+// Prefix implements the db.Db interface.
+func (sd *sharedDb) Prefix() uint8 {
+	return sd.pfx
+}
+
+// SetSession implements the db.Db interface.
+func (sd *sharedDb) SetSession(sessionId string) {
+	sd.sid = sessionId
+}
+
+// SetLanguage implements the db.Db interface.
+func (sd *sharedDb) SetLanguage(ln *lang.Language) {
+	sd.ln = ln
+}
+
+// Get implements the db.Db interface.
+func (sd *sharedDb) Get(ctx context.Context, key []byte) ([]byte, error) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	sd.apply()
+	return sd.Db.Get(ctx, key)
+}
+
+// Put implements the db.Db interface.
+func (sd *sharedDb) Put(ctx context.Context, key []byte, val []byte) error {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	sd.apply()
+	return sd.Db.Put(ctx, key, val)
+}
+
+// Delete implements the db.Db interface.
+func (sd *sharedDb) Delete(ctx context.Context, key []byte) error {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	sd.apply()
+	return sd.Db.Delete(ctx, key)
+}
+
+// Range implements the db.Db interface.
+func (sd *sharedDb) Range(ctx context.Context, start []byte, end []byte, limit int) (*db.Dumper, error) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	sd.apply()
+	return sd.Db.Range(ctx, start, end, limit)
+}
+
+// Dump implements the db.Db interface.
+func (sd *sharedDb) Dump(ctx context.Context, key []byte) (*db.Dumper, error) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	sd.apply()
+	return sd.Db.Dump(ctx, key)
+}
+
+// Lock implements the db.Locker interface.
+//
+// It is a noop if the shared backend does not implement db.Locker.
+//
+// The shared backend is not locked while waiting for the key lock, so that other sessions can use it meanwhile. The
+// key is resolved in the storage context of the instance by db.WithKeyContext instead.
+func (sd *sharedDb) Lock(ctx context.Context, key []byte) error {
+	locker, ok := sd.Db.(db.Locker)
+	if !ok {
+		return nil
+	}
+	return locker.Lock(sd.keyContext(ctx), key)
+}
+
+// Unlock implements the db.Locker interface.
+//
+// It is a noop if the shared backend does not implement db.Locker.
+func (sd *sharedDb) Unlock(ctx context.Context, key []byte) error {
+	locker, ok := sd.Db.(db.Locker)
+	if !ok {
+		return nil
+	}
+	return locker.Unlock(sd.keyContext(ctx), key)
+}
+
+// apply the storage context of the instance to key resolution in the context.
+func (sd *sharedDb) keyContext(ctx context.Context) context.Context {
+	return db.WithKeyContext(ctx, sd.pfx, sd.sid, sd.ln)
+}
+
+// Sweep implements the db.Sweeper interface.
+//
+// Fails if the shared backend does not implement db.Sweeper.
+func (sd *sharedDb) Sweep(ctx context.Context, maxAge time.Duration) (int, error) {
+	sw, ok := sd.Db.(db.Sweeper)
+	if !ok {
+		return 0, fmt.Errorf("%T does not implement db.Sweeper", sd.Db)
+	}
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	sd.apply()
+	return sw.Sweep(ctx, maxAge)
+}
+
+// Close implements the db.Db interface.
+//
+// It is a noop, as the shared backend is owned by the caller of NewManager.
+func (sd *sharedDb) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,434 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"git.defalsify.org/vise.git/db"
+	memdb "git.defalsify.org/vise.git/db/mem"
+	"git.defalsify.org/vise.git/internal/resourcetest"
+	"git.defalsify.org/vise.git/persist"
+	"git.defalsify.org/vise.git/resource"
+	"git.defalsify.org/vise.git/vm"
+)
+
+func TestManagerSessions(t *testing.T) {
+	generateTestData(t)
+	ctx := context.Background()
+	rs := newTestWrapper(dataDir, nil)
+	store := memdb.NewMemDb()
+	store.Connect(ctx, "")
+	cfg := Config{
+		Root:      "root",
+		FlagCount: 1,
+	}
+	m := NewManager(cfg, rs, store)
+
+	expectRoot := `hello world
+1:do the foo
+2:go to the bar
+3:language template`
+	expectFoo := `this is in foo
+
+it has more lines
+0:to foo
+1:go bar
+2:see long`
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	run := func(sessionId string, input []byte, expect string) {
+		defer wg.Done()
+		w := bytes.NewBuffer(nil)
+		_, err := m.Exec(ctx, sessionId, input, w)
+		if err != nil {
+			errs <- err
+			return
+		}
+		if expect != "" && w.String() != expect {
+			errs <- fmt.Errorf("session %s expected:\n\t%s\ngot:\n\t%s", sessionId, expect, w)
+		}
+	}
+	for _, v := range []string{"", "1"} {
+		expect := expectRoot
+		if v == "1" {
+			expect = expectFoo
+		}
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go run(fmt.Sprintf("session%d", i), []byte(v), expect)
+		}
+		wg.Wait()
+	}
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if m.Sessions() != 5 {
+		t.Fatalf("expected 5 sessions, got %d", m.Sessions())
+	}
+
+	n, err := m.Sweep(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expected no evictions, got %d", n)
+	}
+
+	m = m.WithIdleTimeout(time.Millisecond)
+	time.Sleep(time.Millisecond * 2)
+	n, err = m.Sweep(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Fatalf("expected 5 evictions, got %d", n)
+	}
+	if m.Sessions() != 0 {
+		t.Fatalf("expected no sessions, got %d", m.Sessions())
+	}
+
+	w := bytes.NewBuffer(nil)
+	_, err = m.Exec(ctx, "session0", []byte("0"), w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != expectRoot {
+		t.Fatalf("expected session to resume from foo:\n\t%s\ngot:\n\t%s", expectRoot, w)
+	}
+
+	err = m.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManagerSameSession(t *testing.T) {
+	generateTestData(t)
+	ctx := context.Background()
+	rs := newTestWrapper(dataDir, nil)
+	cfg := Config{
+		Root:      "root",
+		FlagCount: 1,
+	}
+	m := NewManager(cfg, rs, nil)
+
+	w := bytes.NewBuffer(nil)
+	_, err := m.Exec(ctx, "foo", []byte{}, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := bytes.NewBuffer(nil)
+			_, err := m.Exec(ctx, "foo", []byte("1"), w)
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if m.Sessions() != 1 {
+		t.Fatalf("expected 1 session, got %d", m.Sessions())
+	}
+
+	_, err = m.Exec(ctx, "", []byte{}, w)
+	if err == nil {
+		t.Fatalf("expected error for empty session id")
+	}
+
+	err = m.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Sessions() != 0 {
+		t.Fatalf("expected no sessions, got %d", m.Sessions())
+	}
+}
+
+func TestManagerTTL(t *testing.T) {
+	generateTestData(t)
+	ctx := context.Background()
+	rs := newTestWrapper(dataDir, nil)
+	store := memdb.NewMemDb()
+	store.Connect(ctx, "")
+	cfg := Config{
+		Root:      "root",
+		FlagCount: 1,
+		TTL:       time.Millisecond * 200,
+	}
+	m := NewManager(cfg, rs, store)
+	for _, v := range []string{"", "1"} {
+		w := bytes.NewBuffer(nil)
+		_, err := m.Exec(ctx, "foo", []byte(v), w)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(time.Millisecond * 300)
+	w := bytes.NewBuffer(nil)
+	_, err := m.Exec(ctx, "foo", []byte{}, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `hello world
+1:do the foo
+2:go to the bar
+3:language template`
+	if w.String() != expect {
+		t.Fatalf("expected expired session to start at root:\n\t%s\ngot:\n\t%s", expect, w)
+	}
+
+	_, err = m.Sweep(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = m.WithIdleTimeout(0)
+	n, err := m.Sweep(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 eviction, got %d", n)
+	}
+	w = bytes.NewBuffer(nil)
+	_, err = m.Exec(ctx, "foo", []byte("1"), w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(w.Bytes(), []byte("this is in foo")) {
+		t.Fatalf("expected session to resume before expiry, got:\n\t%s", w)
+	}
+}
+
+func TestManagerSharedDb(t *testing.T) {
+	ctx := context.Background()
+	store := memdb.NewMemDb()
+	store.Connect(ctx, "")
+	var mu sync.Mutex
+	sd := &sharedDb{
+		Db: store,
+		mu: &mu,
+	}
+	sd.SetSession("foo")
+	sd.SetPrefix(db.DATATYPE_STATE)
+	err := sd.Put(ctx, []byte("bar"), []byte("baz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sd.Lock(ctx, []byte("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	err = sd.Lock(tctx, []byte("bar"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	err = sd.Unlock(ctx, []byte("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := persist.Sweep(ctx, sd, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != 1 {
+		t.Fatalf("expected 1 entry swept, got %d", c)
+	}
+}
+
+// keyLockDb is a db.Locker backend that keeps the lock state of each key in the handle.
+//
+// All access is serialized, and the storage context of the handle is never changed by it.
+type keyLockDb struct {
+	db.Db
+	mu    sync.Mutex
+	locks map[string]chan struct{}
+	waits chan string
+}
+
+func newKeyLockDb(store db.Db) *keyLockDb {
+	return &keyLockDb{
+		Db:    store,
+		locks: make(map[string]chan struct{}),
+		waits: make(chan string, 10),
+	}
+}
+
+func (ld *keyLockDb) Get(ctx context.Context, key []byte) ([]byte, error) {
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+	return ld.Db.Get(ctx, key)
+}
+
+func (ld *keyLockDb) Put(ctx context.Context, key []byte, val []byte) error {
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+	return ld.Db.Put(ctx, key, val)
+}
+
+func (ld *keyLockDb) Lock(ctx context.Context, key []byte) error {
+	ld.mu.Lock()
+	lk, err := ld.Base().ToKey(ctx, key)
+	ld.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	k := string(lk.Default)
+	for {
+		ld.mu.Lock()
+		ch, ok := ld.locks[k]
+		if !ok {
+			ld.locks[k] = make(chan struct{})
+			ld.mu.Unlock()
+			return nil
+		}
+		ld.mu.Unlock()
+		ld.waits <- k
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (ld *keyLockDb) Unlock(ctx context.Context, key []byte) error {
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+	lk, err := ld.Base().ToKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	ch, ok := ld.locks[string(lk.Default)]
+	if !ok {
+		return fmt.Errorf("key not locked: %x", key)
+	}
+	delete(ld.locks, string(lk.Default))
+	close(ch)
+	return nil
+}
+
+func TestManagerLockWait(t *testing.T) {
+	generateTestData(t)
+	ctx := context.Background()
+	rs := newTestWrapper(dataDir, nil)
+	mem := memdb.NewMemDb()
+	mem.Connect(ctx, "")
+	store := newKeyLockDb(mem)
+	cfg := Config{
+		Root:      "root",
+		FlagCount: 1,
+	}
+	m := NewManager(cfg, rs, store)
+
+	// held elsewhere, e.g. by another process
+	fctx := db.WithKeyContext(ctx, db.DATATYPE_STATE, "", nil)
+	err := store.Lock(fctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 2)
+	run := func(sessionId string) {
+		w := bytes.NewBuffer(nil)
+		_, err := m.Exec(ctx, sessionId, []byte{}, w)
+		errs <- err
+	}
+	go run("foo")
+	select {
+	case <-store.waits:
+	case <-time.After(time.Second):
+		t.Fatal("expected session to wait for lock")
+	}
+
+	go run("bar")
+	select {
+	case err = <-errs:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("session stalled by lock wait of other session")
+	}
+
+	err = store.Unlock(fctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = <-errs
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mem.SetPrefix(db.DATATYPE_STATE)
+	for _, sessionId := range []string{"foo", "bar"} {
+		_, err = mem.Get(ctx, []byte(sessionId))
+		if err != nil {
+			t.Fatalf("expected state of session %s to be saved: %v", sessionId, err)
+		}
+	}
+}
+
+func TestManagerUnpin(t *testing.T) {
+	ctx := context.Background()
+	sr := resource.NewSnapshotResource(func(ctx context.Context, name string) (resource.Resource, error) {
+		rs := resourcetest.NewTestResource()
+		rs.AddTemplate(ctx, "root", "welcome")
+		b := vm.NewLine(nil, vm.MOUT, []string{"quit", "0"}, nil, nil)
+		b = vm.NewLine(b, vm.HALT, nil, nil, nil)
+		b = vm.NewLine(b, vm.INCMP, []string{"bye", "0"}, nil, nil)
+		rs.AddBytecode(ctx, "root", b)
+		rs.AddTemplate(ctx, "bye", "goodbye")
+		rs.AddBytecode(ctx, "bye", []byte{})
+		rs.Lock()
+		return rs, nil
+	})
+	err := sr.Switch(ctx, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{
+		Root: "root",
+	}
+	m := NewManager(cfg, sr, nil)
+
+	w := bytes.NewBuffer(nil)
+	cont, err := m.Exec(ctx, "foo", []byte{}, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cont {
+		t.Fatal("expected session to continue")
+	}
+	_, ok := sr.Pinned("foo")
+	if !ok {
+		t.Fatal("expected session to be pinned")
+	}
+	cont, err = m.Exec(ctx, "foo", []byte("0"), w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cont {
+		t.Fatal("expected session to end")
+	}
+	_, ok = sr.Pinned("foo")
+	if ok {
+		t.Fatal("expected session to be unpinned")
+	}
+}
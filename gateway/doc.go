@@ -0,0 +1,2 @@
+// Package gateway serves engine sessions over HTTP, using the request and response format of a USSD aggregator.
+package gateway
@@ -0,0 +1,82 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+
+	"git.defalsify.org/vise.git/engine"
+)
+
+// SessionFunc returns the engine session id to use for a request.
+type SessionFunc func(rq Request) string
+
+// Gateway is a http.Handler that executes the input of gateway requests with the engines of an engine.Manager.
+type Gateway struct {
+	m  *engine.Manager
+	p  Protocol
+	fn SessionFunc
+}
+
+// NewGateway creates a new Gateway, using the given Protocol to parse requests and format responses.
+//
+// By default, the session id of the gateway is used as the engine session id.
+func NewGateway(m *engine.Manager, p Protocol) *Gateway {
+	return &Gateway{
+		m:  m,
+		p:  p,
+		fn: defaultSessionFunc,
+	}
+}
+
+// WithSessionFunc is a chainable function that sets the function deciding the engine session id of a request.
+//
+// For example, PhoneSession keeps the state of the end-user across gateway sessions.
+func (g *Gateway) WithSessionFunc(fn SessionFunc) *Gateway {
+	g.fn = fn
+	return g
+}
+
+// ServeHTTP implements the http.Handler interface.
+//
+// If the input is rejected, the current page is shown again and the session continues. All other errors end the session.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	rq, err := g.p.Parse(req)
+	if err != nil {
+		logg.WarnCtxf(ctx, "invalid gateway request", "err", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sessionId := g.fn(rq)
+	logg.DebugCtxf(ctx, "gateway request", "session", sessionId, "input", rq.Input)
+	b := bytes.NewBuffer(nil)
+	cont, err := g.m.Exec(ctx, sessionId, rq.Input, b)
+	if err != nil {
+		if cont && b.Len() > 0 {
+			logg.InfoCtxf(ctx, "gateway request input rejected", "session", sessionId, "err", err)
+			err = g.p.InputError(w, err, b.Bytes())
+			if err != nil {
+				logg.ErrorCtxf(ctx, "gateway response write failed", "session", sessionId, "err", err)
+			}
+			return
+		}
+		logg.ErrorCtxf(ctx, "gateway request execution failed", "session", sessionId, "err", err)
+		g.p.Error(w, err)
+		return
+	}
+	err = g.p.Format(w, b.Bytes(), cont)
+	if err != nil {
+		logg.ErrorCtxf(ctx, "gateway response write failed", "session", sessionId, "err", err)
+	}
+}
+
+// PhoneSession is a SessionFunc that uses the phone number of the end-user as the engine session id.
+//
+// It is typically used together with engine.Config.ResetOnEmptyInput, so that every new gateway session starts at the root node.
+func PhoneSession(rq Request) string {
+	return rq.PhoneNumber
+}
+
+func defaultSessionFunc(rq Request) string {
+	return rq.SessionId
+}
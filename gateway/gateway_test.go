@@ -0,0 +1,190 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"git.defalsify.org/vise.git/engine"
+	"git.defalsify.org/vise.git/gateway/gatewaytest"
+	"git.defalsify.org/vise.git/internal/resourcetest"
+	"git.defalsify.org/vise.git/vm"
+)
+
+func newTestServer(t *testing.T, fn SessionFunc, cfg engine.Config) *httptest.Server {
+	ctx := context.Background()
+	rs := resourcetest.NewTestResource()
+	rs.AddTemplate(ctx, "root", "welcome")
+	b := vm.NewLine(nil, vm.MOUT, []string{"next", "1"}, nil, nil)
+	b = vm.NewLine(b, vm.HALT, nil, nil, nil)
+	b = vm.NewLine(b, vm.INCMP, []string{"next", "1"}, nil, nil)
+	rs.AddBytecode(ctx, "root", b)
+	rs.AddTemplate(ctx, "next", "almost done")
+	b = vm.NewLine(nil, vm.MOUT, []string{"quit", "0"}, nil, nil)
+	b = vm.NewLine(b, vm.HALT, nil, nil, nil)
+	b = vm.NewLine(b, vm.INCMP, []string{"bye", "0"}, nil, nil)
+	rs.AddBytecode(ctx, "next", b)
+	rs.AddTemplate(ctx, "bye", "goodbye")
+	rs.AddBytecode(ctx, "bye", []byte{})
+	rs.Lock()
+
+	cfg.Root = "root"
+	m := engine.NewManager(cfg, rs, nil)
+	g := NewGateway(m, NewCumulativeProtocol())
+	if fn != nil {
+		g = g.WithSessionFunc(fn)
+	}
+	srv := httptest.NewServer(g)
+	t.Cleanup(func() {
+		srv.Close()
+		m.Close(ctx)
+	})
+	return srv
+}
+
+func TestGatewaySession(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t, nil, engine.Config{})
+	ses := gatewaytest.NewSession(srv.URL, "foo", "+25412345678").WithClient(srv.Client())
+
+	r, cont, err := ses.Dial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cont {
+		t.Fatalf("expected session to continue")
+	}
+	expect := "welcome\n1:next"
+	if r != expect {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s", expect, r)
+	}
+
+	r, cont, err = ses.Send(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cont {
+		t.Fatalf("expected session to continue")
+	}
+	expect = "almost done\n0:quit"
+	if r != expect {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s", expect, r)
+	}
+
+	r, cont, err = ses.Send(ctx, "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cont {
+		t.Fatalf("expected session to end")
+	}
+	expect = "goodbye"
+	if r != expect {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s", expect, r)
+	}
+}
+
+func TestGatewayPhoneSession(t *testing.T) {
+	ctx := context.Background()
+	cfg := engine.Config{
+		ResetOnEmptyInput: true,
+	}
+	srv := newTestServer(t, PhoneSession, cfg)
+	ses := gatewaytest.NewSession(srv.URL, "foo", "+25412345678").WithClient(srv.Client())
+	_, _, err := ses.Dial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = ses.Send(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ses = gatewaytest.NewSession(srv.URL, "bar", "+25412345678").WithClient(srv.Client())
+	r, cont, err := ses.Dial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cont {
+		t.Fatalf("expected session to continue")
+	}
+	expect := "welcome\n1:next"
+	if r != expect {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s", expect, r)
+	}
+}
+
+func TestGatewayInvalid(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t, nil, engine.Config{})
+	ses := gatewaytest.NewSession(srv.URL, "foo", "+25412345678").WithClient(srv.Client())
+	_, _, err := ses.Dial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, cont, err := ses.Send(ctx, "!!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cont {
+		t.Fatalf("expected session to continue")
+	}
+	expect := "Invalid input.\nwelcome\n1:next"
+	if r != expect {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s", expect, r)
+	}
+	r, cont, err = ses.Send(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cont {
+		t.Fatalf("expected session to continue")
+	}
+	expect = "almost done\n0:quit"
+	if r != expect {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s", expect, r)
+	}
+
+	ses = gatewaytest.NewSession(srv.URL, "bar", "+25412345678").WithClient(srv.Client())
+	r, cont, err = ses.Send(ctx, "!!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cont {
+		t.Fatalf("expected session to end")
+	}
+	if r != NewCumulativeProtocol().errMsg {
+		t.Fatalf("expected error message, got '%s'", r)
+	}
+
+	v := url.Values{}
+	v.Set("phoneNumber", "+25412345678")
+	rsp, err := srv.Client().Post(srv.URL, "application/x-www-form-urlencoded", strings.NewReader(v.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rsp.StatusCode)
+	}
+}
+
+func TestLastInput(t *testing.T) {
+	for _, v := range []struct {
+		text   string
+		expect string
+	}{
+		{"", ""},
+		{"1", "1"},
+		{"1*2*33", "33"},
+		{"1*", ""},
+	} {
+		r := string(lastInput(v.text))
+		if r != v.expect {
+			t.Fatalf("text '%s': expected '%s', got '%s'", v.text, v.expect, r)
+		}
+	}
+}
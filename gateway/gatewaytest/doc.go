@@ -0,0 +1,2 @@
+// Package gatewaytest simulates end-user sessions against a gateway http.Handler, e.g. one served by httptest.
+package gatewaytest
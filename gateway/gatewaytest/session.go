@@ -0,0 +1,90 @@
+package gatewaytest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Session simulates the session of an end-user with a gateway using the cumulative text protocol.
+type Session struct {
+	url         string
+	sessionId   string
+	phoneNumber string
+	serviceCode string
+	inputs      []string
+	client      *http.Client
+}
+
+// NewSession creates a new Session sending requests to the given url.
+func NewSession(url string, sessionId string, phoneNumber string) *Session {
+	return &Session{
+		url:         url,
+		sessionId:   sessionId,
+		phoneNumber: phoneNumber,
+		serviceCode: "*384#",
+		client:      http.DefaultClient,
+	}
+}
+
+// WithServiceCode is a chainable function that sets the service code sent with every request.
+func (s *Session) WithServiceCode(code string) *Session {
+	s.serviceCode = code
+	return s
+}
+
+// WithClient is a chainable function that sets the http client used for requests, e.g. the one of a httptest.Server.
+func (s *Session) WithClient(client *http.Client) *Session {
+	s.client = client
+	return s
+}
+
+// Dial sends the first request of the session, with empty text.
+func (s *Session) Dial(ctx context.Context) (string, bool, error) {
+	s.inputs = []string{}
+	return s.send(ctx, "")
+}
+
+// Send adds the input to the cumulative text, and sends it.
+//
+// It returns the response content without the CON or END prefix, and whether the session continues.
+func (s *Session) Send(ctx context.Context, input string) (string, bool, error) {
+	s.inputs = append(s.inputs, input)
+	return s.send(ctx, strings.Join(s.inputs, "*"))
+}
+
+func (s *Session) send(ctx context.Context, text string) (string, bool, error) {
+	v := url.Values{}
+	v.Set("sessionId", s.sessionId)
+	v.Set("phoneNumber", s.phoneNumber)
+	v.Set("serviceCode", s.serviceCode)
+	v.Set("text", text)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, strings.NewReader(v.Encode()))
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return "", false, err
+	}
+	defer rsp.Body.Close()
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return "", false, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return "", false, fmt.Errorf("unexpected status %d: %s", rsp.StatusCode, b)
+	}
+	r := string(b)
+	if strings.HasPrefix(r, "CON ") {
+		return r[4:], true, nil
+	}
+	if strings.HasPrefix(r, "END ") {
+		return r[4:], false, nil
+	}
+	return "", false, fmt.Errorf("invalid response: %s", r)
+}
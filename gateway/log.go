@@ -0,0 +1,9 @@
+package gateway
+
+import (
+	"git.defalsify.org/vise.git/logging"
+)
+
+var (
+	logg logging.Logger = logging.NewVanilla().WithDomain("gateway")
+)
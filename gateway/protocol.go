@@ -0,0 +1,31 @@
+package gateway
+
+import (
+	"net/http"
+)
+
+// Request is an incoming request from the gateway, parsed by a Protocol.
+type Request struct {
+	// SessionId identifies the session of the end-user with the gateway.
+	SessionId string
+	// PhoneNumber is the phone number of the end-user.
+	PhoneNumber string
+	// ServiceCode is the service code dialed by the end-user, e.g. "*384#".
+	ServiceCode string
+	// Input is the latest input of the end-user. Empty on the first request of a session.
+	Input []byte
+}
+
+// Protocol translates between the request and response format of a gateway and the engine.
+type Protocol interface {
+	// Parse parses an incoming HTTP request.
+	Parse(req *http.Request) (Request, error)
+	// Format writes the rendered output of the engine as a response.
+	//
+	// If cont is false, the response must instruct the gateway to end the session.
+	Format(w http.ResponseWriter, output []byte, cont bool) error
+	// Error writes a response for a request that failed to execute, and ends the session.
+	Error(w http.ResponseWriter, err error)
+	// InputError writes a response for a request with input that was rejected, together with the current page, and continues the session.
+	InputError(w http.ResponseWriter, err error, output []byte) error
+}
@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	ussdContinue  = "CON "
+	ussdEnd       = "END "
+	ussdSeparator = "*"
+)
+
+// CumulativeProtocol implements the Protocol interface for gateways that send all inputs of a session
+// as one cumulative text, e.g. "1*2*3", and expect responses prefixed with "CON" or "END".
+//
+// Requests are form encoded, with the fields sessionId, phoneNumber, serviceCode and text.
+//
+// Only the last element of the text is used as input, as the engine keeps track of the previous ones.
+type CumulativeProtocol struct {
+	errMsg      string
+	inputErrMsg string
+}
+
+// NewCumulativeProtocol creates a new CumulativeProtocol.
+func NewCumulativeProtocol() *CumulativeProtocol {
+	return &CumulativeProtocol{
+		errMsg:      "Service unavailable. Please try again later.",
+		inputErrMsg: "Invalid input.",
+	}
+}
+
+// WithErrorMessage is a chainable function that sets the message shown to the end-user when execution fails.
+func (p *CumulativeProtocol) WithErrorMessage(msg string) *CumulativeProtocol {
+	p.errMsg = msg
+	return p
+}
+
+// WithInputErrorMessage is a chainable function that sets the message shown to the end-user above the current page when the input is rejected.
+//
+// If set to an empty string, only the current page is shown.
+func (p *CumulativeProtocol) WithInputErrorMessage(msg string) *CumulativeProtocol {
+	p.inputErrMsg = msg
+	return p
+}
+
+// Parse implements the Protocol interface.
+func (p *CumulativeProtocol) Parse(req *http.Request) (Request, error) {
+	var rq Request
+	err := req.ParseForm()
+	if err != nil {
+		return rq, err
+	}
+	rq.SessionId = req.Form.Get("sessionId")
+	if rq.SessionId == "" {
+		return rq, errors.New("missing sessionId")
+	}
+	rq.PhoneNumber = req.Form.Get("phoneNumber")
+	if rq.PhoneNumber == "" {
+		return rq, errors.New("missing phoneNumber")
+	}
+	rq.ServiceCode = req.Form.Get("serviceCode")
+	rq.Input = lastInput(req.Form.Get("text"))
+	return rq, nil
+}
+
+// Format implements the Protocol interface.
+func (p *CumulativeProtocol) Format(w http.ResponseWriter, output []byte, cont bool) error {
+	pfx := ussdContinue
+	if !cont {
+		pfx = ussdEnd
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write(append([]byte(pfx), output...))
+	return err
+}
+
+// Error implements the Protocol interface.
+//
+// The gateway expects a successful HTTP response, so the error is reported to the end-user as the end of the session.
+func (p *CumulativeProtocol) Error(w http.ResponseWriter, err error) {
+	err = p.Format(w, []byte(p.errMsg), false)
+	if err != nil {
+		logg.Errorf("error response write failed", "err", err)
+	}
+}
+
+// InputError implements the Protocol interface.
+//
+// The input error message is shown on a separate line above the current page.
+func (p *CumulativeProtocol) InputError(w http.ResponseWriter, err error, output []byte) error {
+	if p.inputErrMsg != "" {
+		output = append([]byte(p.inputErrMsg+"\n"), output...)
+	}
+	return p.Format(w, output, true)
+}
+
+// extract the latest input from the cumulative text.
+func lastInput(text string) []byte {
+	i := strings.LastIndex(text, ussdSeparator)
+	return []byte(text[i+1:])
+}
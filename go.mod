@@ -10,8 +10,10 @@ require (
 	github.com/fxamacker/cbor/v2 v2.4.0
 	github.com/graygnuorg/go-gdbm v0.0.0-20220711140707-71387d66dce4
 	github.com/jackc/pgx/v5 v5.7.0
+	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/pashagolub/pgxmock/v4 v4.3.0
 	github.com/peteole/testdata-loader v0.3.0
+	go.etcd.io/bbolt v1.3.11
 	gopkg.in/leonelquinteros/gotext.v1 v1.3.1
 )
 
@@ -24,5 +26,6 @@ require (
 	github.com/x448/float16 v0.8.4 // indirect
 	golang.org/x/crypto v0.27.0 // indirect
 	golang.org/x/sync v0.8.0 // indirect
+	golang.org/x/sys v0.25.0 // indirect
 	golang.org/x/text v0.18.0 // indirect
 )
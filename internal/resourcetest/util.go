@@ -34,17 +34,19 @@ func newTestResource(path string) *TestResource {
 		mem.SetLock(db.DATATYPE_TEMPLATE, false)
 		mem.SetLock(db.DATATYPE_BIN, false)
 		mem.SetLock(db.DATATYPE_MENU, false)
+		mem.SetLock(db.DATATYPE_SRCMAP, false)
 		store = mem
 	} else {
 		fs := mem.NewMemDb()
 		fs.SetLock(db.DATATYPE_TEMPLATE, false)
 		fs.SetLock(db.DATATYPE_BIN, false)
 		fs.SetLock(db.DATATYPE_MENU, false)
+		fs.SetLock(db.DATATYPE_SRCMAP, false)
 		store = fs
 	}
 
 	store.Connect(ctx, path)
-	rsd := resource.NewDbResource(store)
+	rsd := resource.NewDbResource(store).With(db.DATATYPE_SRCMAP)
 	rs := &TestResource{
 		DbResource: rsd,
 		ctx:        ctx,
@@ -68,6 +70,11 @@ func (tr *TestResource) AddMenu(ctx context.Context, key string, val string) err
 	return tr.db.Put(ctx, []byte(key), []byte(val))
 }
 
+func (tr *TestResource) AddSourceMap(ctx context.Context, key string, val []byte) error {
+	tr.db.SetPrefix(db.DATATYPE_SRCMAP)
+	return tr.db.Put(ctx, []byte(key), val)
+}
+
 func (tr *TestResource) AddFunc(ctx context.Context, key string, fn resource.EntryFunc) {
 	tr.AddLocalFunc(key, fn)
 }
@@ -2,7 +2,9 @@ package persist
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/fxamacker/cbor/v2"
 
@@ -11,13 +13,32 @@ import (
 	"git.defalsify.org/vise.git/state"
 )
 
+var (
+	// ErrConflict is returned by Save if the stored state has been changed since it was loaded.
+	ErrConflict = errors.New("persisted state version conflict")
+	// ErrExpired is returned by Load if the stored state is older than the time-to-live of the Persister.
+	ErrExpired = errors.New("persisted state expired")
+)
+
 // Persister abstracts storage and retrieval of state and cache.
 type Persister struct {
 	State  *state.State
 	Memory *cache.Cache
-	ctx    context.Context
-	db     db.Db
-	flush  bool
+	// Version is incremented on every Save, and is used to detect concurrent modification of the stored state.
+	Version uint64
+	// Updated is the unix time in milliseconds of the last Save.
+	Updated int64
+	ctx     context.Context
+	db      db.Db
+	flush   bool
+	key     string
+	ttl     time.Duration
+}
+
+// stored metadata of persisted state.
+type meta struct {
+	Version uint64
+	Updated int64
 }
 
 // NewPersister creates a new Persister instance.
@@ -56,6 +77,16 @@ func (p *Persister) WithFlush() *Persister {
 	return p
 }
 
+// WithTTL is a chainable function that sets the time-to-live of persisted state.
+//
+// State that has not been saved for longer than the time-to-live is ignored by Load.
+//
+// If not set, or set to 0, state never expires.
+func (p *Persister) WithTTL(ttl time.Duration) *Persister {
+	p.ttl = ttl
+	return p
+}
+
 // Invalid checks if the underlying state has been invalidated.
 //
 // An invalid state will cause Save to panic.
@@ -80,29 +111,67 @@ func (p *Persister) Serialize() ([]byte, error) {
 
 // Deserialize decodes the state and cache from storage, and applies them to the persister.
 func (p *Persister) Deserialize(b []byte) error {
+	p.Version = 0
 	err := cbor.Unmarshal(b, p)
 	return err
 }
 
 // Save persists the state and cache to the db.Db backend.
 //
+// If the state was loaded from the same key, Save fails with ErrConflict if the
+// stored state has been saved by someone else in the meantime.
+//
+// If the db.Db backend implements db.Locker, the key is locked while the stored
+// version is checked and the new state written.
+//
 // If save is successful and WithFlush() has been called, the state and memory
 // will be empty when the method returns.
-func (p *Persister) Save(key string) error {
+func (p *Persister) Save(key string) (err error) {
 	if p.Invalid() {
 		panic("persister has been invalidated")
 	}
+	k := []byte(key)
+	p.db.SetPrefix(db.DATATYPE_STATE)
+	locker, ok := p.db.(db.Locker)
+	if ok {
+		err = locker.Lock(p.ctx, k)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			p.db.SetPrefix(db.DATATYPE_STATE)
+			lerr := locker.Unlock(p.ctx, k)
+			if lerr != nil && err == nil {
+				err = lerr
+			}
+		}()
+	}
+	m, err := p.stored(k)
+	if err != nil {
+		return err
+	}
+	if key == p.key && m.Version != p.Version {
+		return fmt.Errorf("%w: key %s has version %d, expected %d", ErrConflict, key, m.Version, p.Version)
+	}
+	version := p.Version
+	updated := p.Updated
+	p.Version = m.Version + 1
+	p.Updated = time.Now().UnixMilli()
 	b, err := p.Serialize()
 	if err != nil {
+		p.Version = version
+		p.Updated = updated
 		return err
 	}
-	p.db.SetPrefix(db.DATATYPE_STATE)
-	logg.Infof("saving state and cache", "self", p, "key", key, "state", p.State)
+	logg.Infof("saving state and cache", "self", p, "key", key, "state", p.State, "version", p.Version)
 	logg.Tracef("saving bytecode", "code", p.State.Code)
-	err = p.db.Put(p.ctx, []byte(key), b)
+	err = p.db.Put(p.ctx, k, b)
 	if err != nil {
+		p.Version = version
+		p.Updated = updated
 		return err
 	}
+	p.key = key
 	if p.flush {
 		logg.Tracef("state and cache flushed from persister")
 		p.Memory.Reset()
@@ -113,22 +182,85 @@ func (p *Persister) Save(key string) error {
 }
 
 // Load retrieves state and cache from the db.Db backend.
+//
+// The version of the loaded state is used by consecutive calls to Save with the same key.
+//
+// If a time-to-live is set and the stored state has expired, Load fails with ErrExpired, and the
+// state and cache of the Persister are left untouched. A consecutive Save will replace the expired state.
 func (p *Persister) Load(key string) error {
 	p.db.SetPrefix(db.DATATYPE_STATE)
 	b, err := p.db.Get(p.ctx, []byte(key))
 	if err != nil {
+		if db.IsNotFound(err) {
+			p.key = key
+			p.Version = 0
+		}
 		return err
 	}
+	if p.ttl > 0 {
+		var m meta
+		err = cbor.Unmarshal(b, &m)
+		if err != nil {
+			return err
+		}
+		if p.expired(m.Updated) {
+			logg.Infof("persisted state expired", "key", key, "updated", time.UnixMilli(m.Updated), "ttl", p.ttl)
+			p.key = key
+			p.Version = m.Version
+			return fmt.Errorf("%w: %s", ErrExpired, key)
+		}
+	}
 	err = p.Deserialize(b)
 	if err != nil {
 		return err
 	}
-	logg.Infof("loaded state and cache", "self", p, "key", key, "state", p.State)
+	p.key = key
+	logg.Infof("loaded state and cache", "self", p, "key", key, "state", p.State, "version", p.Version)
 	logg.Tracef("loaded bytecode", "code", p.State.Code)
 	return nil
 }
 
+// retrieve the metadata of the state currently stored under the key.
+//
+// Returns zero values if no state is stored.
+func (p *Persister) stored(k []byte) (meta, error) {
+	var m meta
+	b, err := p.db.Get(p.ctx, k)
+	if err != nil {
+		if db.IsNotFound(err) {
+			return m, nil
+		}
+		return m, err
+	}
+	err = cbor.Unmarshal(b, &m)
+	return m, err
+}
+
+// check whether state saved at the given unix time in milliseconds has outlived the time-to-live.
+//
+// State saved before timestamps were introduced never expires.
+func (p *Persister) expired(updated int64) bool {
+	if p.ttl == 0 || updated == 0 {
+		return false
+	}
+	return time.Since(time.UnixMilli(updated)) > p.ttl
+}
+
+// Sweep deletes all persisted state in the store that has not been written to for the duration of ttl.
+//
+// It returns the number of entries deleted.
+//
+// The store must implement db.Sweeper.
+func Sweep(ctx context.Context, store db.Db, ttl time.Duration) (int, error) {
+	sw, ok := store.(db.Sweeper)
+	if !ok {
+		return 0, fmt.Errorf("%T does not implement db.Sweeper", store)
+	}
+	store.SetPrefix(db.DATATYPE_STATE)
+	return sw.Sweep(ctx, ttl)
+}
+
 // String implements the String interface
 func (p *Persister) String() string {
-	return fmt.Sprintf("persister @%p state:%p cache:%p", p, p.State, p.Memory)
+	return fmt.Sprintf("persister @%p state:%p cache:%p version:%d", p, p.State, p.Memory, p.Version)
 }
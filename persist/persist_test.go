@@ -2,9 +2,12 @@ package persist
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"git.defalsify.org/vise.git/cache"
+	"git.defalsify.org/vise.git/db"
 	"git.defalsify.org/vise.git/db/mem"
 	"git.defalsify.org/vise.git/state"
 )
@@ -180,3 +183,152 @@ func TestFlush(t *testing.T) {
 		t.Fatalf("expected cache use size 0, got: %v", o.CacheUseSize)
 	}
 }
+
+func TestSaveConflict(t *testing.T) {
+	ctx := context.Background()
+	store := mem.NewMemDb()
+	store.Connect(ctx, "")
+
+	st := state.NewState(0)
+	ca := cache.NewCache()
+	pe := NewPersister(store).WithContent(st, ca)
+	err := pe.Load("foo")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	peOther := NewPersister(store).WithContent(state.NewState(0), cache.NewCache())
+	err = peOther.Load("foo")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	err = pe.Save("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = peOther.Save("foo")
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+
+	err = peOther.Load("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peOther.Version != 1 {
+		t.Fatalf("expected version 1, got %d", peOther.Version)
+	}
+	err = peOther.Save("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pe.Save("foo")
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+	if pe.Version != 1 {
+		t.Fatalf("expected version unchanged after conflict, got %d", pe.Version)
+	}
+
+	err = pe.Load("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pe.Save("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pe.Save("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pe.Version != 4 {
+		t.Fatalf("expected version 4, got %d", pe.Version)
+	}
+
+	err = pe.Save("bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pe.Version != 1 {
+		t.Fatalf("expected version 1, got %d", pe.Version)
+	}
+}
+
+func TestLoadExpired(t *testing.T) {
+	ctx := context.Background()
+	store := mem.NewMemDb()
+	store.Connect(ctx, "")
+
+	st := state.NewState(0)
+	st.Down("foo")
+	pe := NewPersister(store).WithContent(st, cache.NewCache())
+	pe.Version = 1
+	pe.Updated = time.Now().Add(-time.Hour).UnixMilli()
+	b, err := pe.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetPrefix(db.DATATYPE_STATE)
+	err = store.Put(ctx, []byte("xyzzy"), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pe = NewPersister(store).WithContent(state.NewState(0), cache.NewCache()).WithTTL(time.Hour * 2)
+	err = pe.Load("xyzzy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, _ := pe.GetState().Where()
+	if node != "foo" {
+		t.Fatalf("expected node 'foo', got '%s'", node)
+	}
+
+	pe = NewPersister(store).WithContent(state.NewState(0), cache.NewCache()).WithTTL(time.Minute)
+	err = pe.Load("xyzzy")
+	if !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected expired, got %v", err)
+	}
+	node, _ = pe.GetState().Where()
+	if node != "" {
+		t.Fatalf("expected empty state, got node '%s'", node)
+	}
+	err = pe.Save("xyzzy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pe.Load("xyzzy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pe.Version != 2 {
+		t.Fatalf("expected version 2, got %d", pe.Version)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	ctx := context.Background()
+	store := mem.NewMemDb()
+	store.Connect(ctx, "")
+	for _, v := range []string{"foo", "bar"} {
+		pe := NewPersister(store).WithContent(state.NewState(0), cache.NewCache())
+		err := pe.Save(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := Sweep(ctx, store, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != 0 {
+		t.Fatalf("expected no swept entries, got %d", c)
+	}
+	c, err = Sweep(ctx, store, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != 2 {
+		t.Fatalf("expected 2 swept entries, got %d", c)
+	}
+}
@@ -0,0 +1,92 @@
+package render
+
+const (
+	// characters of the GSM 03.38 default alphabet.
+	gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	// characters of the GSM 03.38 extension table, which are encoded with a preceding escape character.
+	gsm7Ext = "\f^{}\\[~]|€"
+)
+
+var (
+	gsm7 = make(map[rune]uint32)
+)
+
+func init() {
+	for _, r := range gsm7Basic {
+		gsm7[r] = 1
+	}
+	for _, r := range gsm7Ext {
+		gsm7[r] = 2
+	}
+	// NUL is used as line separator within a sink page.
+	gsm7[0] = 1
+}
+
+// SizeFunc is the function signature for measuring the size of output text.
+//
+// The size must be in the same unit as the output size limit of the Sizer, and the size limits of the cache.
+type SizeFunc func(s string) uint32
+
+// PageSizeFunc is the function signature for choosing how to measure the parts of a page, given all text of the page.
+//
+// The parts of a page, like the items of a sink, are measured separately and their sizes added up. If the size of a text depends on all of it, every part must be measured the way the whole page will be.
+type PageSizeFunc func(s string) SizeFunc
+
+// ByteSize measures the size of text as the number of bytes of its UTF-8 encoding.
+//
+// It is the default if no SizeFunc is set.
+func ByteSize(s string) uint32 {
+	return uint32(len(s))
+}
+
+// Gsm7Size measures the size of text as the number of septets of its GSM 7-bit default alphabet encoding.
+//
+// Characters of the extension table, like "€" and "{", count as two septets.
+//
+// If the text contains a character that is not in the GSM 7-bit alphabet, it has to be sent with UCS-2 encoding instead. The whole text is then measured as its UCS-2 encoding (see Ucs2Size), converted to septets: every UTF-16 code unit takes 16 bits, i.e. 16/7 septets, rounded up for the text. A limit given in septets, e.g. 182 for USSD, thus also holds for text that will be UCS-2 encoded.
+//
+// Since the size of a part of the text then depends on the rest of it, pages measured with Gsm7Size must be sized with Gsm7PageSize as the PageSizeFunc.
+func Gsm7Size(s string) uint32 {
+	var c uint32
+	for _, r := range s {
+		l, ok := gsm7[r]
+		if !ok {
+			return ucs2Septets(s)
+		}
+		c += l
+	}
+	return c
+}
+
+// Gsm7PageSize is the PageSizeFunc for Gsm7Size.
+//
+// If the text of the page contains a character that is not in the GSM 7-bit alphabet, every part of the page is measured by its UCS-2 encoding in septets, as Gsm7Size measures the whole page. Otherwise the parts are measured with Gsm7Size.
+func Gsm7PageSize(s string) SizeFunc {
+	for _, r := range s {
+		_, ok := gsm7[r]
+		if !ok {
+			return ucs2Septets
+		}
+	}
+	return Gsm7Size
+}
+
+// size of the UCS-2 encoding of the text in septets, rounded up.
+func ucs2Septets(s string) uint32 {
+	return (Ucs2Size(s)*16 + 6) / 7
+}
+
+// Ucs2Size measures the size of text as the number of UTF-16 code units of its UCS-2 encoding.
+//
+// Characters outside the Basic Multilingual Plane count as two code units.
+func Ucs2Size(s string) uint32 {
+	var c uint32
+	for _, r := range s {
+		if r > 0xffff {
+			c += 2
+		} else {
+			c += 1
+		}
+	}
+	return c
+}
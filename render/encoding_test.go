@@ -0,0 +1,60 @@
+package render
+
+import (
+	"testing"
+)
+
+func TestSizeFuncs(t *testing.T) {
+	for i, v := range []struct {
+		s    string
+		b    uint32
+		gsm7 uint32
+		ucs2 uint32
+	}{
+		{"foo bar", 7, 7, 7},
+		{"blåbærsyltetøy", 17, 14, 14},
+		{"Ni ya €10 {x}", 15, 16, 13},
+		{"ŵ", 2, 3, 1},
+		{"inky\x00pinky", 10, 10, 10},
+		{"😀", 4, 5, 2},
+		{"Habari ŵ", 9, 19, 8},
+	} {
+		r := ByteSize(v.s)
+		if r != v.b {
+			t.Fatalf("test %d: expected byte size %d, got %d", i, v.b, r)
+		}
+		r = Gsm7Size(v.s)
+		if r != v.gsm7 {
+			t.Fatalf("test %d: expected gsm7 size %d, got %d", i, v.gsm7, r)
+		}
+		r = Ucs2Size(v.s)
+		if r != v.ucs2 {
+			t.Fatalf("test %d: expected ucs2 size %d, got %d", i, v.ucs2, r)
+		}
+	}
+}
+
+func TestSizeCheckEncoding(t *testing.T) {
+	szr := NewSizer(14)
+	_, ok := szr.Check("blåbærsyltetøy")
+	if ok {
+		t.Fatalf("expected not ok")
+	}
+
+	szr = szr.WithSizeFunc(Gsm7Size)
+	l, ok := szr.Check("blåbærsyltetøy")
+	if !ok {
+		t.Fatalf("expected ok")
+	}
+	if l != 0 {
+		t.Fatalf("expected 0, got %v", l)
+	}
+
+	l, ok = szr.Check("{blåbær}")
+	if !ok {
+		t.Fatalf("expected ok")
+	}
+	if l != 4 {
+		t.Fatalf("expected 4, got %v", l)
+	}
+}
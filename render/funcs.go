@@ -0,0 +1,241 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"git.defalsify.org/vise.git/lang"
+)
+
+// decimal and thousands separators for number formatting.
+type numberFormat struct {
+	decimal   string
+	thousands string
+}
+
+var (
+	defaultNumberFormat = numberFormat{".", ","}
+	// number formats by ISO 639-3 language code.
+	numberFormats = map[string]numberFormat{
+		"dan": {",", "."},
+		"deu": {",", "."},
+		"fin": {",", " "},
+		"fra": {",", " "},
+		"ita": {",", "."},
+		"nld": {",", "."},
+		"nob": {",", " "},
+		"nno": {",", " "},
+		"nor": {",", " "},
+		"por": {",", "."},
+		"spa": {",", "."},
+		"swe": {",", " "},
+	}
+)
+
+// FuncMap returns the built-in helper functions for templates, for the language in the context.
+//
+// The following functions are available. Arguments are given before the piped value, e.g. {{.balance | currency "KES" 2}}:
+//
+//   - number <decimals> <value>: number with the given number of decimals, using the decimal and thousands separators of the language. The value may be of any integer, floating point or string type, and is rounded with halves away from zero.
+//   - currency <code> <decimals> <value>: same as number, prefixed with the currency code.
+//   - truncate <length> <value>: value truncated to the given number of characters, ending with "..." if truncated.
+//   - padleft <length> <value>: value padded with spaces on the left to the given number of characters.
+//   - padright <length> <value>: value padded with spaces on the right to the given number of characters.
+//   - upper <value>: value in upper case.
+//   - lower <value>: value in lower case.
+//   - mask <visible> <value>: all digits but the given number of last digits replaced with "*", e.g. for phone numbers.
+func FuncMap(ctx context.Context) template.FuncMap {
+	nf := defaultNumberFormat
+	ln, ok := lang.LanguageFromContext(ctx)
+	if ok {
+		v, ok := numberFormats[ln.Code]
+		if ok {
+			nf = v
+		}
+	}
+	return template.FuncMap{
+		"number": func(decimals int, v any) (string, error) {
+			return formatNumber(nf, decimals, v)
+		},
+		"currency": func(code string, decimals int, v any) (string, error) {
+			s, err := formatNumber(nf, decimals, v)
+			if err != nil {
+				return "", err
+			}
+			return code + " " + s, nil
+		},
+		"truncate": truncate,
+		"padleft": func(l int, s string) string {
+			return pad(l, s, true)
+		},
+		"padright": func(l int, s string) string {
+			return pad(l, s, false)
+		},
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"mask":  mask,
+	}
+}
+
+// format the number value with the given separators.
+//
+// Values are converted to exact decimals, and rounded to the given number of decimals with halves rounded away from zero. Floating point values are first converted to the shortest decimal that represents them, so that e.g. 0.285 is rounded to 0.29.
+func formatNumber(nf numberFormat, decimals int, v any) (string, error) {
+	n, err := toDecimal(v)
+	if err != nil {
+		return "", err
+	}
+	if decimals < 0 {
+		decimals = 0
+	}
+	s := n.FloatString(decimals)
+	var sign string
+	if s[0] == '-' {
+		s = s[1:]
+		// no sign for values rounded to zero.
+		if strings.Trim(s, "0.") != "" {
+			sign = "-"
+		}
+	}
+	frac := ""
+	i := strings.IndexByte(s, '.')
+	if i > -1 {
+		frac = nf.decimal + s[i+1:]
+		s = s[:i]
+	}
+	b := strings.Builder{}
+	for i, c := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteString(nf.thousands)
+		}
+		b.WriteRune(c)
+	}
+	return sign + b.String() + frac, nil
+}
+
+// convert a number value of any integer, floating point or string type to an exact decimal.
+func toDecimal(v any) (*big.Rat, error) {
+	n := new(big.Rat)
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return n.SetInt64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return n.SetUint64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("not a number: %v", v)
+		}
+		bits := 64
+		if rv.Kind() == reflect.Float32 {
+			bits = 32
+		}
+		n, _ = n.SetString(strconv.FormatFloat(f, 'f', -1, bits))
+		return n, nil
+	case reflect.String:
+		s := strings.TrimSpace(rv.String())
+		// fractions are accepted by big.Rat, but are not decimal numbers.
+		if strings.ContainsRune(s, '/') {
+			return nil, fmt.Errorf("not a number: %q", s)
+		}
+		_, ok := n.SetString(s)
+		if !ok {
+			return nil, fmt.Errorf("not a number: %q", s)
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("not a number: %v", v)
+}
+
+// truncate the string to the given number of characters, including the ellipsis.
+func truncate(l int, s string) string {
+	r := []rune(s)
+	if len(r) <= l {
+		return s
+	}
+	if l <= 3 {
+		return string(r[:max(l, 0)])
+	}
+	return string(r[:l-3]) + "..."
+}
+
+// pad the string with spaces to the given number of characters.
+func pad(l int, s string, left bool) string {
+	c := l - len([]rune(s))
+	if c <= 0 {
+		return s
+	}
+	if left {
+		return strings.Repeat(" ", c) + s
+	}
+	return s + strings.Repeat(" ", c)
+}
+
+// replace all but the last digits with "*".
+func mask(visible int, s string) string {
+	var c int
+	for _, v := range s {
+		if v >= '0' && v <= '9' {
+			c += 1
+		}
+	}
+	c -= visible
+	b := strings.Builder{}
+	for _, v := range s {
+		if v >= '0' && v <= '9' && c > 0 {
+			b.WriteByte('*')
+			c -= 1
+			continue
+		}
+		b.WriteRune(v)
+	}
+	return b.String()
+}
+
+// visit all action nodes of the template tree, including those in conditional and range blocks.
+func walkActions(node parse.Node, fn func(*parse.ActionNode)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, v := range n.Nodes {
+			walkActions(v, fn)
+		}
+	case *parse.ActionNode:
+		fn(n)
+	case *parse.IfNode:
+		walkActions(n.List, fn)
+		walkActions(n.ElseList, fn)
+	case *parse.RangeNode:
+		walkActions(n.List, fn)
+		walkActions(n.ElseList, fn)
+	case *parse.WithNode:
+		walkActions(n.List, fn)
+		walkActions(n.ElseList, fn)
+	}
+}
+
+// return the symbol of an action that outputs a single symbol, optionally piped to functions, e.g. {{.foo | upper}}.
+func sinkField(a *parse.ActionNode) (string, bool) {
+	if len(a.Pipe.Decl) > 0 || len(a.Pipe.Cmds) == 0 {
+		return "", false
+	}
+	args := a.Pipe.Cmds[0].Args
+	if len(args) != 1 {
+		return "", false
+	}
+	f, ok := args[0].(*parse.FieldNode)
+	if !ok || len(f.Ident) != 1 {
+		return "", false
+	}
+	return f.Ident[0], true
+}
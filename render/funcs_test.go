@@ -0,0 +1,162 @@
+package render
+
+import (
+	"context"
+	"testing"
+
+	"git.defalsify.org/vise.git/cache"
+	"git.defalsify.org/vise.git/internal/resourcetest"
+	"git.defalsify.org/vise.git/lang"
+)
+
+func TestFuncNumber(t *testing.T) {
+	ctx := context.Background()
+	fns := FuncMap(ctx)
+	number := fns["number"].(func(int, any) (string, error))
+	for _, v := range []struct {
+		decimals int
+		v        any
+		expect   string
+	}{
+		{0, "42", "42"},
+		{2, "1234567.891", "1,234,567.89"},
+		{0, "-1234", "-1,234"},
+		{1, 999999, "999,999.0"},
+		{0, 100.5, "101"},
+		{2, "0.285", "0.29"},
+		{2, 0.285, "0.29"},
+		{2, float32(0.1), "0.10"},
+		{2, "-0.001", "0.00"},
+		{0, "1e3", "1,000"},
+		{0, int64(9007199254740993), "9,007,199,254,740,993"},
+		{0, uint64(18446744073709551615), "18,446,744,073,709,551,615"},
+		{2, "123456789012345678901234567890.125", "123,456,789,012,345,678,901,234,567,890.13"},
+		{0, int32(-5), "-5"},
+		{0, int8(-5), "-5"},
+		{0, uint(7), "7"},
+		{0, uint16(7), "7"},
+	} {
+		r, err := number(v.decimals, v.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r != v.expect {
+			t.Fatalf("expected '%s', got '%s'", v.expect, r)
+		}
+	}
+	for _, v := range []any{"foo", "1/3", true, nil} {
+		_, err := number(0, v)
+		if err == nil {
+			t.Fatalf("expected error for %v", v)
+		}
+	}
+
+	ln, err := lang.LanguageFromCode("nor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = context.WithValue(ctx, "Language", ln)
+	fns = FuncMap(ctx)
+	currency := fns["currency"].(func(string, int, any) (string, error))
+	r, err := currency("NOK", 2, "1234.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != "NOK 1 234,50" {
+		t.Fatalf("expected 'NOK 1 234,50', got '%s'", r)
+	}
+}
+
+func TestFuncText(t *testing.T) {
+	for _, v := range []struct {
+		r      string
+		expect string
+	}{
+		{truncate(8, "inky pinky"), "inky ..."},
+		{truncate(10, "inky pinky"), "inky pinky"},
+		{truncate(2, "inky pinky"), "in"},
+		{truncate(5, "blåbærsyltetøy"), "bl..."},
+		{pad(6, "inky", true), "  inky"},
+		{pad(6, "inky", false), "inky  "},
+		{pad(2, "inky", false), "inky"},
+		{mask(4, "+254 712 345678"), "+*** *** **5678"},
+		{mask(20, "0712345678"), "0712345678"},
+	} {
+		if v.r != v.expect {
+			t.Fatalf("expected '%s', got '%s'", v.expect, v.r)
+		}
+	}
+}
+
+func TestPageFuncs(t *testing.T) {
+	ctx := context.Background()
+	ca := cache.NewCache()
+	rs := resourcetest.NewTestResource()
+	rs.AddTemplate(ctx, "foo", "{{.bar | upper}} {{.baz | currency \"KES\" 2}} {{.baz | double}}")
+	rs.AddTemplate(ctx, "pad", "{{.bar | padleft 12}}")
+	rs.Lock()
+	ca.Push()
+	ca.Add("bar", "inky", 4)
+	ca.Add("baz", "1500", 4)
+
+	pg := NewPage(ca, rs).WithSizer(NewSizer(16))
+	pg = pg.WithFuncs(map[string]any{
+		"double": func(s string) string {
+			return s + s
+		},
+	})
+	pg.Map("bar")
+	pg.Map("baz")
+	_, err := pg.Render(ctx, "foo", 0)
+	if err == nil {
+		t.Fatalf("expected size exceeded")
+	}
+
+	pg = pg.WithSizer(NewSizer(64))
+	r, err := pg.Render(ctx, "foo", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "INKY KES 1,500.00 15001500"
+	if r != expect {
+		t.Fatalf("expected '%s', got '%s'", expect, r)
+	}
+
+	pg = pg.WithSizer(NewSizer(10))
+	_, err = pg.Render(ctx, "pad", 0)
+	if err == nil {
+		t.Fatalf("expected size exceeded")
+	}
+}
+
+func TestPageFuncsSink(t *testing.T) {
+	ctx := context.Background()
+	ca := cache.NewCache()
+	rs := resourcetest.NewTestResource()
+	rs.AddTemplate(ctx, "foo", "{{.bar | padright 8 | upper}}")
+	rs.AddTemplate(ctx, "baz", "{{.bar | upper}} {{.bar}}")
+	rs.Lock()
+	ca.Push()
+	ca.Add("bar", "inky\npinky\nblinky\nclyde", 0)
+
+	pg := NewPage(ca, rs).WithSizer(NewSizer(20))
+	pg.Map("bar")
+	var r []string
+	for i := 0; i < 2; i++ {
+		s, err := pg.Render(ctx, "foo", uint16(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = append(r, s)
+	}
+	for i, expect := range []string{"INKY    \nPINKY   ", "BLINKY  \nCLYDE   "} {
+		if r[i] != expect {
+			t.Fatalf("page %d expected:\n\t%q\ngot:\n\t%q", i, expect, r[i])
+		}
+	}
+
+	_, err := pg.Render(ctx, "baz", 0)
+	if err == nil {
+		t.Fatalf("expected error for sink with different functions")
+	}
+}
@@ -59,9 +59,10 @@ type Menu struct {
 	canNext     bool         // availability flag for the "next" browse option.
 	canPrevious bool         // availability flag for the "previous" browse option.
 	//outputSize uint16 // maximum size constraint for the menu.
-	sink bool
-	keep bool
-	sep  string
+	sink     bool
+	keep     bool
+	sep      string
+	sizeFunc SizeFunc // measures the size of rendered menu.
 }
 
 // String implements the String interface.
@@ -117,6 +118,14 @@ func (m *Menu) WithDispose() *Menu {
 	return m
 }
 
+// WithSizeFunc is a chainable function that sets the function used to measure the rendered menu in Sizes.
+//
+// If not set, ByteSize is used.
+func (m *Menu) WithSizeFunc(fn SizeFunc) *Menu {
+	m.sizeFunc = fn
+	return m
+}
+
 func (m *Menu) WithResource(rs resource.Resource) *Menu {
 	m.rs = rs
 	return m
@@ -172,18 +181,22 @@ func (m *Menu) Sizes(ctx context.Context) ([4]uint32, error) {
 	if err != nil {
 		return menuSizes, err
 	}
-	menuSizes[0] = uint32(len(v))
+	measure := m.sizeFunc
+	if measure == nil {
+		measure = ByteSize
+	}
+	menuSizes[0] = measure(v)
 	tmpm = tmpm.WithPageCount(2)
 	v, err = tmpm.Render(ctx, 0)
 	if err != nil {
 		return menuSizes, err
 	}
-	menuSizes[1] = uint32(len(v)) - menuSizes[0]
+	menuSizes[1] = measure(v) - menuSizes[0]
 	v, err = tmpm.Render(ctx, 1)
 	if err != nil {
 		return menuSizes, err
 	}
-	menuSizes[2] = uint32(len(v)) - menuSizes[0]
+	menuSizes[2] = measure(v) - menuSizes[0]
 	menuSizes[3] = menuSizes[1] + menuSizes[2]
 	return menuSizes, nil
 }
@@ -204,6 +217,24 @@ func (m *Menu) titleFor(ctx context.Context, title string) (string, error) {
 //
 // After this has been executed, the state of the menu will be empty.
 func (m *Menu) Render(ctx context.Context, idx uint16) (string, error) {
+	items, err := m.Items(ctx, idx)
+	if err != nil {
+		return "", err
+	}
+	r := ""
+	for i, v := range items {
+		if i > 0 {
+			r += "\n"
+		}
+		r += fmt.Sprintf("%s%s%s", v.Selector, m.sep, v.Label)
+	}
+	return r, nil
+}
+
+// Items returns the full current state of the menu as a list of selectors and labels, including the browse options for the page index.
+//
+// After this has been executed, the state of the menu will be empty.
+func (m *Menu) Items(ctx context.Context, idx uint16) ([]MenuItem, error) {
 	var menuCopy [][2]string
 	if m.keep {
 		for _, v := range m.menu {
@@ -213,24 +244,23 @@ func (m *Menu) Render(ctx context.Context, idx uint16) (string, error) {
 
 	err := m.applyPage(idx)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	r := ""
+	var r []MenuItem
 	for true {
-		l := len(r)
 		choice, title, err := m.shiftMenu()
 		if err != nil {
 			break
 		}
-		if l > 0 {
-			r += "\n"
-		}
 		title, err = m.titleFor(ctx, title)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		r += fmt.Sprintf("%s%s%s", choice, m.sep, title)
+		r = append(r, MenuItem{
+			Selector: choice,
+			Label:    title,
+		})
 	}
 	if m.keep {
 		m.menu = menuCopy
@@ -0,0 +1,27 @@
+package render
+
+// MenuItem is a single menu option.
+type MenuItem struct {
+	// Selector is the input that chooses the option.
+	Selector string `json:"selector"`
+	// Label is the display title of the option.
+	Label string `json:"label"`
+}
+
+// Output is the structured representation of a rendered page, as an alternative to the rendered text.
+type Output struct {
+	// Node is the symbol of the node that was rendered.
+	Node string `json:"node"`
+	// Text is the rendered template, without the menu.
+	Text string `json:"text"`
+	// Menu is the menu options of the page, including the browse options.
+	Menu []MenuItem `json:"menu"`
+	// Page is the index of the rendered page.
+	Page uint16 `json:"page"`
+	// PageCount is the number of pages available for browsing. It is 0 if the content is not paged.
+	PageCount uint16 `json:"page_count"`
+	// Next is set if there is a next page to browse to.
+	Next bool `json:"next"`
+	// Previous is set if there is a previous page to browse to.
+	Previous bool `json:"previous"`
+}
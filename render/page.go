@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"math"
+	"sort"
 	"strings"
 	"text/template"
+	"text/template/parse"
 
 	"git.defalsify.org/vise.git/cache"
 	"git.defalsify.org/vise.git/resource"
@@ -17,10 +20,11 @@ type Page struct {
 	cache    cache.Memory      // Content store.
 	resource resource.Resource // Symbol resolver.
 	menu     *Menu             // Menu rendererer.
-	sink     *string           // Content symbol rendered by dynamic size.
 	sizer    *Sizer            // Process size constraints.
 	err      error             // Error state to prepend to output.
 	extra    string            // Extra content to append to received template
+	funcs    template.FuncMap  // Template functions in addition to the built-in ones.
+	applied  map[string]bool   // Sinks of which the template functions have been applied to every value before pagination.
 }
 
 // NewPage creates a new Page object.
@@ -50,6 +54,19 @@ func (pg *Page) WithSizer(sizer *Sizer) *Page {
 	return pg
 }
 
+// WithFuncs adds functions to use in templates, in addition to the built-in functions of FuncMap.
+//
+// Functions with the same name as a built-in function replace the built-in function.
+func (pg *Page) WithFuncs(fns template.FuncMap) *Page {
+	if pg.funcs == nil {
+		pg.funcs = make(template.FuncMap)
+	}
+	for k, v := range fns {
+		pg.funcs[k] = v
+	}
+	return pg
+}
+
 // WithError adds an error to prepend to the page output.
 func (pg *Page) WithError(err error) *Page {
 	pg.err = err
@@ -66,17 +83,17 @@ func (pg *Page) Error() string {
 
 // Usage returns size used by values and menu, and remaining size available
 func (pg *Page) Usage() (uint32, uint32, error) {
-	var l int
+	var l uint32
 	var c uint16
 	for k, v := range pg.cacheMap {
-		l += len(v)
+		l += pg.measure(v)
 		sz, err := pg.cache.ReservedSize(k)
 		if err != nil {
 			return 0, 0, err
 		}
 		c += sz
 	}
-	r := uint32(l)
+	r := l
 	rsv := uint32(0)
 	if uint32(c) > r {
 		rsv = uint32(c) - r
@@ -91,7 +108,7 @@ func (pg *Page) Usage() (uint32, uint32, error) {
 //
 // After this, Val() will return the value for the key, and Size() will include the value size and limitations in its calculations.
 //
-// Only one symbol with no size limitation may be mapped at the current level.
+// Several symbols with no size limitation, sinks, may be mapped at the current level. They share the space remaining on the page according to the SinkShare set for each in the Sizer.
 func (pg *Page) Map(key string) error {
 	v, err := pg.cache.Get(key)
 	if err != nil {
@@ -101,12 +118,6 @@ func (pg *Page) Map(key string) error {
 	if err != nil {
 		return err
 	}
-	if l == 0 {
-		if pg.sink != nil && *pg.sink != key {
-			return fmt.Errorf("sink already set to symbol '%v'", *pg.sink)
-		}
-		pg.sink = &key
-	}
 	pg.cacheMap[key] = v
 	if pg.sizer != nil {
 		err := pg.sizer.Set(key, l)
@@ -129,40 +140,30 @@ func (pg *Page) Val(key string) (string, error) {
 	return r, nil
 }
 
-// Sizes returned the actual used bytes by each mapped symbol.
+// Sizes returns the size of the content of each mapped symbol, as measured by the sizer if set.
+//
+// Sizes beyond the range of uint16, which only sinks can have, are capped.
 func (pg *Page) Sizes() (map[string]uint16, error) {
 	sizes := make(map[string]uint16)
-	var haveSink bool
-	for k, _ := range pg.cacheMap {
-		l, err := pg.cache.ReservedSize(k)
-		if err != nil {
-			return nil, err
-		}
-		if l == 0 {
-			if haveSink {
-				panic(fmt.Sprintf("duplicate sink for %v", k))
-			}
-			haveSink = true
-		}
+	for k, v := range pg.cacheMap {
+		sizes[k] = uint16(min(pg.measure(v), math.MaxUint16))
 	}
 	return sizes, nil
 }
 
 // RenderTemplate is an adapter to implement the builtin golang text template renderer as resource.RenderTemplate.
 func (pg *Page) RenderTemplate(ctx context.Context, sym string, values map[string]string, idx uint16) (string, error) {
-	tpl, err := pg.resource.GetTemplate(ctx, sym)
+	tp, err := pg.parseTemplate(ctx, sym)
 	if err != nil {
 		return "", err
 	}
-	tpl += pg.extra
-	if pg.err != nil {
-		derr := pg.Error()
-		logg.DebugCtxf(ctx, "prepending error", "err", pg.err, "display", derr)
-		if len(tpl) == 0 {
-			tpl = derr
-		} else {
-			tpl = fmt.Sprintf("%s\n%s", derr, tpl)
-		}
+	if len(pg.applied) > 0 {
+		walkActions(tp.Tree.Root, func(a *parse.ActionNode) {
+			k, ok := sinkField(a)
+			if ok && pg.applied[k] {
+				a.Pipe.Cmds = a.Pipe.Cmds[:1]
+			}
+		})
 	}
 	if pg.sizer != nil {
 		values, err = pg.sizer.GetAt(values, idx)
@@ -174,11 +175,6 @@ func (pg *Page) RenderTemplate(ctx context.Context, sym string, values map[strin
 	}
 	logg.Debugf("render for", "index", idx)
 
-	tp, err := template.New("tester").Option("missingkey=error").Parse(tpl)
-	if err != nil {
-		return "", err
-	}
-
 	b := bytes.NewBuffer([]byte{})
 	err = tp.Execute(b, values)
 	if err != nil {
@@ -187,6 +183,93 @@ func (pg *Page) RenderTemplate(ctx context.Context, sym string, values map[strin
 	return b.String(), err
 }
 
+// template functions for the language in the context, including those added with WithFuncs.
+func (pg *Page) funcMap(ctx context.Context) template.FuncMap {
+	fns := FuncMap(ctx)
+	for k, v := range pg.funcs {
+		fns[k] = v
+	}
+	return fns
+}
+
+// parse the template associated with the symbol, including the error state and extra content.
+func (pg *Page) parseTemplate(ctx context.Context, sym string) (*template.Template, error) {
+	tpl, err := pg.resource.GetTemplate(ctx, sym)
+	if err != nil {
+		return nil, err
+	}
+	tpl += pg.extra
+	if pg.err != nil {
+		derr := pg.Error()
+		logg.DebugCtxf(ctx, "prepending error", "err", pg.err, "display", derr)
+		if len(tpl) == 0 {
+			tpl = derr
+		} else {
+			tpl = fmt.Sprintf("%s\n%s", derr, tpl)
+		}
+	}
+	return template.New("tester").Option("missingkey=error").Funcs(pg.funcMap(ctx)).Parse(tpl)
+}
+
+// apply the template functions piped to each sink in the template to every value of the sink.
+//
+// Pagination then measures the values as they are output. The functions are skipped for the sinks when rendering the template.
+//
+// Fails if the same sink is used with different functions in the template.
+func (pg *Page) applySinkFuncs(ctx context.Context, sym string, sinks []string, sinkValues map[string][]string) error {
+	tp, err := pg.parseTemplate(ctx, sym)
+	if err != nil {
+		return err
+	}
+	pipes := make(map[string]string)
+	for _, k := range sinks {
+		pipes[k] = ""
+	}
+	seen := make(map[string]bool)
+	walkActions(tp.Tree.Root, func(a *parse.ActionNode) {
+		k, ok := sinkField(a)
+		if !ok {
+			return
+		}
+		if _, ok = pipes[k]; !ok {
+			return
+		}
+		var cmds []string
+		for _, v := range a.Pipe.Cmds[1:] {
+			cmds = append(cmds, v.String())
+		}
+		pipe := strings.Join(cmds, " | ")
+		if seen[k] && pipes[k] != pipe && err == nil {
+			err = fmt.Errorf("sink %s is used with different template functions", k)
+		}
+		seen[k] = true
+		pipes[k] = pipe
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range sinks {
+		if pipes[k] == "" {
+			continue
+		}
+		fp, err := template.New("sink").Option("missingkey=error").Funcs(pg.funcMap(ctx)).Parse("{{. | " + pipes[k] + "}}")
+		if err != nil {
+			return err
+		}
+		for i, v := range sinkValues[k] {
+			b := bytes.NewBuffer(nil)
+			err = fp.Execute(b, v)
+			if err != nil {
+				return fmt.Errorf("sink %s value %d: %w", k, i, err)
+			}
+			sinkValues[k][i] = b.String()
+		}
+		pg.applied[k] = true
+		logg.DebugCtxf(ctx, "applied template functions to sink", "sink", k, "pipe", pipes[k])
+	}
+	return nil
+}
+
 // Render renders the current mapped content and menu state against the template associated with the symbol.
 func (pg *Page) Render(ctx context.Context, sym string, idx uint16) (string, error) {
 	var err error
@@ -199,11 +282,34 @@ func (pg *Page) Render(ctx context.Context, sym string, idx uint16) (string, err
 	return pg.render(ctx, sym, values, idx)
 }
 
+// RenderOutput renders the same content as Render, as structured data.
+func (pg *Page) RenderOutput(ctx context.Context, sym string, idx uint16) (*Output, error) {
+	values, err := pg.prepare(ctx, sym, pg.cacheMap, idx)
+	if err != nil {
+		return nil, err
+	}
+	_, s, items, err := pg.renderParts(ctx, sym, values, idx)
+	if err != nil {
+		return nil, err
+	}
+	o := &Output{
+		Node: sym,
+		Text: s,
+		Menu: items,
+		Page: idx,
+	}
+	if pg.menu != nil && pg.menu.pageCount > 0 {
+		o.PageCount = pg.menu.pageCount
+		o.Next = pg.menu.canNext
+		o.Previous = pg.menu.canPrevious
+	}
+	return o, nil
+}
+
 // Reset prepared the Page object for re-use.
 //
-// It clears mappings and removes the sink definition.
+// It clears mappings and removes the sink definitions.
 func (pg *Page) Reset() {
-	pg.sink = nil
 	pg.extra = ""
 	pg.cacheMap = make(map[string]string)
 	if pg.menu != nil {
@@ -217,30 +323,64 @@ func (pg *Page) Reset() {
 // extract sink values to separate array, and set the content of sink in values map to zero-length string.
 //
 // this allows render of page with emptry content the sink symbol to discover remaining capacity.
-func (pg *Page) split(sym string, values map[string]string) (map[string]string, string, []string, error) {
-	var sink string
-	var sinkValues []string
+//
+// the sink symbols are returned in sorted order.
+func (pg *Page) split(sym string, values map[string]string) (map[string]string, []string, map[string][]string, error) {
+	var sinks []string
+	sinkValues := make(map[string][]string)
 	noSinkValues := make(map[string]string)
 
 	for k, v := range values {
 		sz, err := pg.cache.ReservedSize(k)
 		if err != nil {
-			return nil, "", nil, err
+			return nil, nil, nil, err
 		}
 		if sz == 0 {
-			sink = k
-			sinkValues = strings.Split(v, "\n")
+			sinks = append(sinks, k)
+			sinkValues[k] = strings.Split(v, "\n")
 			v = ""
 			logg.Infof("found sink", "sym", sym, "sink", k)
 		}
 		noSinkValues[k] = v
 	}
 
-	if sink == "" {
+	if len(sinks) == 0 {
 		logg.Tracef("no sink found", "sym", sym)
-		return values, "", nil, nil
+		return values, nil, nil, nil
 	}
-	return noSinkValues, sink, sinkValues, nil
+	sort.Strings(sinks)
+	return noSinkValues, sinks, sinkValues, nil
+}
+
+// break sink values that are too long to fit on a single page.
+//
+// The capacity for a single value is the remaining size after reserving room for both the next and previous browse menu items.
+//
+// If the sink only consists of a single value that fits on the page without browsing, it is returned as is. Values that cannot be broken are left for joinSink to fail on.
+func (pg *Page) breakSink(sinkValues []string, remaining uint32, menuSizes [4]uint32) []string {
+	sep := pg.sizer.Measure("\n")
+	if len(sinkValues) == 1 && pg.sizer.Measure(sinkValues[0])+2*sep <= remaining {
+		return sinkValues
+	}
+	capacity := int(remaining) - int(menuSizes[1]) - int(menuSizes[2]) - 4*int(sep)
+	return pg.breakValues(sinkValues, capacity)
+}
+
+// break each sink value that exceeds the capacity into parts.
+func (pg *Page) breakValues(sinkValues []string, capacity int) []string {
+	var r []string
+	for i, v := range sinkValues {
+		vv, err := breakValue(v, capacity, pg.sizer.marker, pg.sizer.Measure)
+		if err != nil {
+			logg.Debugf("cannot break sink value", "idx", i, "err", err)
+			vv = []string{v}
+		}
+		if len(vv) > 1 {
+			logg.Debugf("broke sink value", "idx", i, "parts", len(vv), "capacity", capacity)
+		}
+		r = append(r, vv...)
+	}
+	return r
 }
 
 // flatten the sink values array into a paged string.
@@ -248,41 +388,42 @@ func (pg *Page) split(sym string, values map[string]string) (map[string]string,
 // newlines (within the same page) render are defined by NUL (0x00).
 //
 // pages are separated by LF (0x0a).
-func (pg *Page) joinSink(sinkValues []string, remaining uint32, menuSizes [4]uint32) (string, uint16, error) {
+func (pg *Page) joinSink(sink string, sinkValues []string, remaining uint32, menuSizes [4]uint32) (string, uint16, error) {
 	l := 0
 	var count uint16
 	tb := strings.Builder{}
 	rb := strings.Builder{}
+	sep := pg.sizer.Measure("\n")
 
 	// remaining is remaining less one LF
-	netRemaining := remaining - 1
+	netRemaining := remaining - sep
 
 	// BUG: this reserves the previous browse before we know we need it
 	if len(sinkValues) > 1 {
-		netRemaining -= (menuSizes[1] + 1)
+		netRemaining -= (menuSizes[1] + sep)
 	}
 
 	for i, v := range sinkValues {
-		l += len(v)
+		l += int(pg.sizer.Measure(v))
 		logg.Tracef("processing sink", "idx", i, "value", v, "netremaining", netRemaining, "l", l)
-		if uint32(l) > netRemaining-1 {
+		if uint32(l) > netRemaining-sep {
 			if tb.Len() == 0 {
 				return "", 0, fmt.Errorf("capacity insufficient for sink field %v", i)
 			}
 			rb.WriteString(tb.String())
 			rb.WriteRune('\n')
 			c := uint32(rb.Len())
-			pg.sizer.AddCursor(c)
+			pg.sizer.AddSinkCursor(sink, c)
 			tb.Reset()
-			l = len(v)
+			l = int(pg.sizer.Measure(v))
 			if count == 0 {
-				netRemaining -= (menuSizes[2] + 1)
+				netRemaining -= (menuSizes[2] + sep)
 			}
 			count += 1
 		}
 		if tb.Len() > 0 {
 			tb.WriteByte(byte(0x00))
-			l += 1
+			l += int(sep)
 		}
 		tb.WriteString(v)
 	}
@@ -297,6 +438,104 @@ func (pg *Page) joinSink(sinkValues []string, remaining uint32, menuSizes [4]uin
 	return r, count, nil
 }
 
+// flatten the values arrays of several sinks into paged strings, browsed in step.
+//
+// The sinks share the capacity of every page according to their SinkShare. When a sink has no values left, its space is given to the other sinks, and it renders empty on the remaining pages.
+//
+// The strings are in the same format as for joinSink. The page count is the number of pages needed by the sink with the most pages.
+func (pg *Page) joinSinks(sinks []string, sinkValues map[string][]string, remaining uint32, menuSizes [4]uint32) (map[string]string, uint16, error) {
+	var count uint16
+	pos := make(map[string]int)
+	rb := make(map[string]*strings.Builder)
+	for _, k := range sinks {
+		rb[k] = &strings.Builder{}
+	}
+
+	// same allowance as for a single sink.
+	sep := pg.sizer.Measure("\n")
+	capacity := int(remaining) - 2*int(sep)
+	need := pg.sinkNeed(sinks, sinkValues, pos)
+	var total int
+	for _, v := range need {
+		total += int(v)
+	}
+	if total > capacity {
+		capacity -= int(menuSizes[1]) + int(sep)
+	}
+
+	for len(need) > 0 {
+		if count == 1 {
+			capacity -= int(menuSizes[2]) + int(sep)
+		}
+		if capacity <= 0 {
+			return nil, 0, fmt.Errorf("capacity insufficient for sinks on page %v", count)
+		}
+		alloc, err := allocate(uint32(capacity), need, pg.sizer.shares)
+		if err != nil {
+			return nil, 0, err
+		}
+		logg.Tracef("allocated sinks", "page", count, "capacity", capacity, "alloc", alloc)
+		for _, k := range sinks {
+			if _, ok := need[k]; !ok {
+				continue
+			}
+			tb := strings.Builder{}
+			var l uint32
+			i := pos[k]
+			for ; i < len(sinkValues[k]); i++ {
+				v := sinkValues[k][i]
+				sz := pg.sizer.Measure(v)
+				if i > pos[k] {
+					sz += sep
+				}
+				if l+sz > alloc[k] {
+					break
+				}
+				if i > pos[k] {
+					tb.WriteByte(byte(0x00))
+				}
+				tb.WriteString(v)
+				l += sz
+			}
+			if i == pos[k] {
+				return nil, 0, fmt.Errorf("capacity insufficient for sink %v field %v", k, i)
+			}
+			if count > 0 {
+				rb[k].WriteRune('\n')
+				pg.sizer.AddSinkCursor(k, uint32(rb[k].Len()))
+			}
+			rb[k].WriteString(tb.String())
+			pos[k] = i
+		}
+		need = pg.sinkNeed(sinks, sinkValues, pos)
+		count += 1
+	}
+
+	r := make(map[string]string)
+	for _, k := range sinks {
+		r[k] = rb[k].String()
+	}
+	return r, count, nil
+}
+
+// size of the values left to render for each sink, from the given positions in the values arrays.
+//
+// Sinks with no values left are not included.
+func (pg *Page) sinkNeed(sinks []string, sinkValues map[string][]string, pos map[string]int) map[string]uint32 {
+	need := make(map[string]uint32)
+	for _, k := range sinks {
+		vv := sinkValues[k][pos[k]:]
+		if len(vv) == 0 {
+			continue
+		}
+		need[k] = uint32(len(vv)-1) * pg.sizer.Measure("\n")
+		for _, v := range vv {
+			need[k] += pg.sizer.Measure(v)
+		}
+	}
+	return need
+}
+
 func (pg *Page) applyMenuSink(ctx context.Context) ([]string, error) {
 	s, err := pg.menu.WithDispose().WithPages().Render(ctx, 0)
 	if err != nil {
@@ -306,14 +545,41 @@ func (pg *Page) applyMenuSink(ctx context.Context) ([]string, error) {
 	return values, nil
 }
 
+// all text that may be output on a page, for the sizer to choose how to measure its parts.
+//
+// This is the pre-rendered page without sinks, the sink values, and the labels of the browse menu.
+func (pg *Page) fitText(s string, sinks []string, sinkValues map[string][]string) string {
+	b := strings.Builder{}
+	b.WriteString(s)
+	for _, k := range sinks {
+		for _, v := range sinkValues[k] {
+			b.WriteString(v)
+		}
+	}
+	if pg.menu != nil {
+		cfg := pg.menu.GetBrowseConfig()
+		b.WriteString(cfg.NextSelector + cfg.NextTitle + cfg.PreviousSelector + cfg.PreviousTitle)
+	}
+	return b.String()
+}
+
+// size of the string, as measured by the sizer if set.
+func (pg *Page) measure(s string) uint32 {
+	if pg.sizer == nil {
+		return ByteSize(s)
+	}
+	return pg.sizer.Measure(s)
+}
+
 // render menu and all syms except sink, split sink into display chunks
 func (pg *Page) prepare(ctx context.Context, sym string, values map[string]string, idx uint16) (map[string]string, error) {
+	pg.applied = make(map[string]bool)
 	if pg.sizer == nil {
 		return values, nil
 	}
 
 	// extract sink values
-	noSinkValues, sink, sinkValues, err := pg.split(sym, values)
+	noSinkValues, sinks, sinkValues, err := pg.split(sym, values)
 	if err != nil {
 		return nil, err
 	}
@@ -321,29 +587,42 @@ func (pg *Page) prepare(ctx context.Context, sym string, values map[string]strin
 	// check if menu is sink aswell, fail if it is.
 	if pg.menu != nil {
 		if pg.menu.IsSink() {
-			if sink != "" {
+			if len(sinks) > 0 {
 				return values, fmt.Errorf("cannot use menu as sink when sink already mapped")
 			}
-			sinkValues, err = pg.applyMenuSink(ctx)
+			menuValues, err := pg.applyMenuSink(ctx)
 			if err != nil {
 				return nil, err
 			}
-			sink = "_menu"
+			sinks = []string{"_menu"}
+			sinkValues = map[string][]string{"_menu": menuValues}
 			pg.extra = "\n{{._menu}}"
-			pg.sizer.sink = sink
-			noSinkValues[sink] = ""
-			logg.DebugCtxf(ctx, "menu is sink", "items", len(sinkValues))
+			noSinkValues["_menu"] = ""
+			logg.DebugCtxf(ctx, "menu is sink", "items", len(menuValues))
 		}
 	}
 
+	// output of template functions must be paginated, not the values they are applied to
+	err = pg.applySinkFuncs(ctx, sym, sinks, sinkValues)
+	if err != nil {
+		return nil, err
+	}
+
 	// pre-render template without sink
 	// this includes the menu before any browsing options have been added
-	pg.sizer.AddCursor(0)
+	// cursors are calculated anew for every render
+	pg.sizer.Reset()
+	for _, k := range sinks {
+		pg.sizer.AddSinkCursor(k, 0)
+	}
 	s, err := pg.render(ctx, sym, noSinkValues, 0)
 	if err != nil {
 		return nil, err
 	}
 
+	// measure all parts as the whole page will be, since all sink content may end up on the same page
+	pg.sizer.fit(pg.fitText(s, sinks, sinkValues))
+
 	// this is the available bytes left for sink content and browse menu
 	remaining, ok := pg.sizer.Check(s)
 	if !ok {
@@ -353,19 +632,59 @@ func (pg *Page) prepare(ctx context.Context, sym string, values map[string]strin
 	// pre-calculate the menu sizes for all browse conditions
 	var menuSizes [4]uint32
 	if pg.menu != nil {
-		menuSizes, err = pg.menu.Sizes(ctx)
+		menuSizes, err = pg.menu.WithSizeFunc(pg.sizer.Measure).Sizes(ctx)
 		if err != nil {
 			return nil, err
 		}
 	}
 	logg.Debugf("calculated pre-navigation allocation", "bytes", remaining, "menusizes", menuSizes)
 
-	// process sink values array into newline-separated string
-	sinkString, count, err := pg.joinSink(sinkValues, remaining, menuSizes)
-	if err != nil {
-		return nil, err
+	var count uint16
+	if len(sinks) == 1 {
+		sink := sinks[0]
+
+		// break values that do not fit on a single page, except menu items
+		if sink != "_menu" {
+			sinkValues[sink] = pg.breakSink(sinkValues[sink], remaining, menuSizes)
+		}
+
+		// process sink values array into newline-separated string
+		noSinkValues[sink], count, err = pg.joinSink(sink, sinkValues[sink], remaining, menuSizes)
+		if err != nil {
+			return nil, err
+		}
+	} else if len(sinks) > 1 {
+		// break values that do not fit within the smallest share of the sink, unless all sinks fit on a single page
+		var total uint32
+		for _, v := range pg.sinkNeed(sinks, sinkValues, nil) {
+			total += v
+		}
+		sep := pg.sizer.Measure("\n")
+		if total+2*sep > remaining {
+			capacity := uint32(max(int(remaining)-int(menuSizes[1])-int(menuSizes[2])-4*int(sep), 0))
+			need := make(map[string]uint32)
+			for _, k := range sinks {
+				need[k] = capacity
+			}
+			alloc, err := allocate(capacity, need, pg.sizer.shares)
+			if err != nil {
+				return nil, err
+			}
+			for _, k := range sinks {
+				sinkValues[k] = pg.breakValues(sinkValues[k], int(alloc[k]))
+			}
+		}
+
+		// process sink values arrays into newline-separated strings
+		var sinkStrings map[string]string
+		sinkStrings, count, err = pg.joinSinks(sinks, sinkValues, remaining, menuSizes)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range sinkStrings {
+			noSinkValues[k] = v
+		}
 	}
-	noSinkValues[sink] = sinkString
 
 	// update the page count of the menu
 	if pg.menu != nil {
@@ -373,8 +692,10 @@ func (pg *Page) prepare(ctx context.Context, sym string, values map[string]strin
 	}
 
 	// write all sink values to log.
-	for i, v := range strings.Split(sinkString, "\n") {
-		logg.Tracef("nosinkvalue", "idx", i, "value", v)
+	for _, k := range sinks {
+		for i, v := range strings.Split(noSinkValues[k], "\n") {
+			logg.Tracef("nosinkvalue", "sink", k, "idx", i, "value", v)
+		}
 	}
 
 	return noSinkValues, nil
@@ -382,32 +703,40 @@ func (pg *Page) prepare(ctx context.Context, sym string, values map[string]strin
 
 // render template, menu (if it exists), and audit size constraint (if it exists).
 func (pg *Page) render(ctx context.Context, sym string, values map[string]string, idx uint16) (string, error) {
+	r, _, _, err := pg.renderParts(ctx, sym, values, idx)
+	return r, err
+}
+
+// render template and menu (if it exists), and audit size constraint (if it exists).
+//
+// Returns the complete render, along with the rendered template and menu items.
+func (pg *Page) renderParts(ctx context.Context, sym string, values map[string]string, idx uint16) (string, string, []MenuItem, error) {
 	var ok bool
+	var items []MenuItem
 	r := ""
 	s, err := pg.RenderTemplate(ctx, sym, values, idx)
 	if err != nil {
-		return "", err
+		return "", "", nil, err
 	}
 	logg.Debugf("rendered template", "bytes", len(s))
 	r += s
 
 	if pg.menu != nil {
-		s, err = pg.menu.Render(ctx, idx)
+		items, err = pg.menu.Items(ctx, idx)
 		if err != nil {
-			return "", err
+			return "", "", nil, err
 		}
-		l := len(s)
-		logg.Debugf("rendered menu", "bytes", l)
-		if l > 0 {
-			r += "\n" + s
+		for _, v := range items {
+			r += fmt.Sprintf("\n%s%s%s", v.Selector, pg.menu.sep, v.Label)
 		}
+		logg.Debugf("rendered menu", "items", len(items))
 	}
 
 	if pg.sizer != nil {
 		_, ok = pg.sizer.Check(r)
 		if !ok {
-			return "", fmt.Errorf("limit exceeded: %v", pg.sizer)
+			return "", "", nil, fmt.Errorf("limit exceeded: %v", pg.sizer)
 		}
 	}
-	return r, nil
+	return r, s, items, nil
 }
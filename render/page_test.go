@@ -95,8 +95,8 @@ func TestStateMapSink(t *testing.T) {
 		t.Error(err)
 	}
 	err = pg.Map("xyzzy")
-	if err == nil {
-		t.Errorf("Expected fail on duplicate sink")
+	if err != nil {
+		t.Error(err)
 	}
 	err = pg.Map("baz")
 	if err != nil {
@@ -144,3 +144,95 @@ bar
 		t.Fatalf("expected:\n\t%s\ngot:\n\t%s", expect, r)
 	}
 }
+
+func TestPageRenderOutput(t *testing.T) {
+	ctx := context.Background()
+	ca := cache.NewCache()
+	rs := newTestSizeResource()
+	rs.Lock()
+	ca.Push()
+	ca.Add("foo", "inky", 4)
+	ca.Add("bar", "pinky", 10)
+	ca.Add("baz", "blinky", 20)
+	ca.Add("xyzzy", "inky pinky\nblinky clyde sue\ntinkywinky dipsy\nlala poo\none two three four five six seven\neight nine ten\neleven twelve", 0)
+
+	for i, expect := range []Output{
+		{
+			Node: "pages",
+			Text: "one inky two pinky three blinky\ninky pinky\nblinky clyde sue\ntinkywinky dipsy\nlala poo",
+			Menu: []MenuItem{
+				{Selector: "1", Label: "foo the foo"},
+				{Selector: "11", Label: "next"},
+			},
+			Page:      0,
+			PageCount: 3,
+			Next:      true,
+		},
+		{
+			Node: "pages",
+			Text: "one inky two pinky three blinky\none two three four five six seven\neight nine ten",
+			Menu: []MenuItem{
+				{Selector: "1", Label: "foo the foo"},
+				{Selector: "11", Label: "next"},
+				{Selector: "22", Label: "previous"},
+			},
+			Page:      1,
+			PageCount: 3,
+			Next:      true,
+			Previous:  true,
+		},
+	} {
+		mn := NewMenu().WithBrowseConfig(DefaultBrowseConfig())
+		pg := NewPage(ca, rs).WithSizer(NewSizer(128)).WithMenu(mn)
+		pg.Reset()
+		pg.Map("foo")
+		pg.Map("bar")
+		pg.Map("baz")
+		pg.Map("xyzzy")
+		mn.Put("1", "foo the foo")
+
+		o, err := pg.RenderOutput(ctx, "pages", uint16(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := fmt.Sprintf("%v", *o)
+		if r != fmt.Sprintf("%v", expect) {
+			t.Fatalf("page %d expected:\n\t%v\ngot:\n\t%v", i, expect, *o)
+		}
+	}
+}
+
+func TestPageSizes(t *testing.T) {
+	ca := cache.NewCache()
+	pg := NewPage(ca, nil)
+	ca.Push()
+	err := ca.Add("foo", "inky", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ca.Add("bar", "pinky", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pg.Map("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pg.Map("bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes, err := pg.Sizes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sizes) != 2 {
+		t.Fatalf("expected 2 sizes, got %v", sizes)
+	}
+	if sizes["foo"] != 4 {
+		t.Fatalf("expected 4, got %d", sizes["foo"])
+	}
+	if sizes["bar"] != 5 {
+		t.Fatalf("expected 5, got %d", sizes["bar"])
+	}
+}
@@ -10,10 +10,15 @@ import (
 type Sizer struct {
 	outputSize uint32 // maximum output for a single page.
 	//	menuSize uint16 // actual menu size for the dynamic page being sized
-	memberSizes     map[string]uint16 // individual byte sizes of all content to be rendered by template.
-	totalMemberSize uint32            // total byte size of all content to be rendered by template (sum of memberSizes)
-	crsrs           []uint32          // byte offsets in the sink content for browseable pages indices.
-	sink            string            // sink symbol.
+	memberSizes     map[string]uint16    // individual byte sizes of all content to be rendered by template.
+	totalMemberSize uint32               // total byte size of all content to be rendered by template (sum of memberSizes)
+	crsrs           map[string][]uint32  // byte offsets in the content of each sink for browseable pages indices.
+	sinks           []string             // sink symbols.
+	shares          map[string]SinkShare // share of the page for each sink, when several sinks are mapped.
+	sizeFunc        SizeFunc             // measures the size of output text.
+	pageSizeFunc    PageSizeFunc         // chooses how to measure the parts of a page.
+	pageFunc        SizeFunc             // measures the parts of the page being sized.
+	marker          string               // appended to sink values that continue on the next page.
 }
 
 // NewSizer creates a new Sizer object with the given output size constraint.
@@ -21,9 +26,56 @@ func NewSizer(outputSize uint32) *Sizer {
 	return &Sizer{
 		outputSize:  outputSize,
 		memberSizes: make(map[string]uint16),
+		crsrs:       make(map[string][]uint32),
+		shares:      make(map[string]SinkShare),
 	}
 }
 
+// WithSizeFunc sets the function used to measure the size of output text.
+//
+// If not set, ByteSize is used.
+func (szr *Sizer) WithSizeFunc(fn SizeFunc) *Sizer {
+	szr.sizeFunc = fn
+	return szr
+}
+
+// WithPageSizeFunc sets the function used to choose how to measure the parts of a page, given all text of the page.
+//
+// It must be set if the size of a text depends on all of it, e.g. Gsm7PageSize for Gsm7Size. If not set, the parts are measured with the SizeFunc of the sizer.
+func (szr *Sizer) WithPageSizeFunc(fn PageSizeFunc) *Sizer {
+	szr.pageSizeFunc = fn
+	return szr
+}
+
+// WithContinuation sets a marker to append to the parts of a sink value that continues on the next page, e.g. "..." or " >".
+//
+// The marker is included in the size of the page.
+func (szr *Sizer) WithContinuation(marker string) *Sizer {
+	szr.marker = marker
+	return szr
+}
+
+// WithSinkShare sets the share of the page for the sink symbol, when several sinks are mapped on the same page.
+//
+// If not set, the sink has a weight of 1 and no minimum.
+func (szr *Sizer) WithSinkShare(sym string, share SinkShare) *Sizer {
+	szr.shares[sym] = share
+	return szr
+}
+
+// Measure returns the size of the text, as measured by the SizeFunc of the sizer.
+//
+// While a page is being sized, the text is measured as chosen for the page by the PageSizeFunc of the sizer, if set.
+func (szr *Sizer) Measure(s string) uint32 {
+	if szr.pageFunc != nil {
+		return szr.pageFunc(s)
+	}
+	if szr.sizeFunc == nil {
+		return ByteSize(s)
+	}
+	return szr.sizeFunc(s)
+}
+
 // WithMenuSize sets the size of the menu being used in the rendering context.
 //func(szr *Sizer) WithMenuSize(menuSize uint16) *Sizer {
 //	szr.menuSize = menuSize
@@ -34,7 +86,7 @@ func NewSizer(outputSize uint32) *Sizer {
 func (szr *Sizer) Set(key string, size uint16) error {
 	szr.memberSizes[key] = size
 	if size == 0 {
-		szr.sink = key
+		szr.addSink(key)
 	}
 	szr.totalMemberSize += uint32(size)
 	return nil
@@ -42,7 +94,7 @@ func (szr *Sizer) Set(key string, size uint16) error {
 
 // Check audits whether the rendered string is within the output size constraint of the sizer.
 func (szr *Sizer) Check(s string) (uint32, bool) {
-	l := uint32(len(s))
+	l := szr.Measure(s)
 	if szr.outputSize > 0 {
 		if l > szr.outputSize {
 			logg.Infof("sized check fails", "length", l, "sizer", szr)
@@ -82,27 +134,53 @@ func (szr *Sizer) Size(s string) (uint16, error) {
 //	return szr.menuSize
 //}
 
-// AddCursor adds a pagination cursor for the paged sink content.
+// AddCursor adds a pagination cursor for the paged content of all sinks.
 func (szr *Sizer) AddCursor(c uint32) {
-	logg.Debugf("Added cursor", "offset", c)
-	szr.crsrs = append(szr.crsrs, c)
+	for _, k := range szr.sinks {
+		szr.AddSinkCursor(k, c)
+	}
+}
+
+// AddSinkCursor adds a pagination cursor for the paged content of a single sink.
+func (szr *Sizer) AddSinkCursor(sym string, c uint32) {
+	logg.Debugf("Added cursor", "sink", sym, "offset", c)
+	szr.addSink(sym)
+	szr.crsrs[sym] = append(szr.crsrs[sym], c)
+}
+
+// register the symbol as a sink, if not already registered.
+func (szr *Sizer) addSink(sym string) {
+	for _, k := range szr.sinks {
+		if k == sym {
+			return
+		}
+	}
+	szr.sinks = append(szr.sinks, sym)
 }
 
 // GetAt the paged symbols for the current page index.
 //
-// Fails if index requested is out of range.
+// If several sinks are mapped, a sink with fewer pages than the index is empty.
+//
+// Fails if index requested is out of range for all sinks.
 func (szr *Sizer) GetAt(values map[string]string, idx uint16) (map[string]string, error) {
-	if szr.sink == "" {
+	if len(szr.crsrs) == 0 {
 		return values, nil
 	}
+	var haveSink bool
+	var havePage bool
 	outValues := make(map[string]string)
 	for k, v := range values {
-		logg.Tracef("check values", "k", k, "v", v, "idx", idx, "cursors", szr.crsrs)
-		if szr.sink == k {
-			if idx >= uint16(len(szr.crsrs)) {
-				return nil, fmt.Errorf("no more values in index")
+		crsrs, ok := szr.crsrs[k]
+		logg.Tracef("check values", "k", k, "v", v, "idx", idx, "cursors", crsrs)
+		if ok {
+			haveSink = true
+			if idx >= uint16(len(crsrs)) {
+				outValues[k] = ""
+				continue
 			}
-			c := szr.crsrs[idx]
+			havePage = true
+			c := crsrs[idx]
 			v = v[c:]
 			nl := strings.Index(v, "\n")
 			if nl > 0 {
@@ -113,10 +191,25 @@ func (szr *Sizer) GetAt(values map[string]string, idx uint16) (map[string]string
 		}
 		outValues[k] = v
 	}
+	if haveSink && !havePage {
+		return nil, fmt.Errorf("no more values in index")
+	}
 	return outValues, nil
 }
 
-// Reset flushes all size measurements, making the sizer available for reuse.
+// Reset flushes all size measurements and sink registrations, making the sizer available for reuse.
+//
+// Sink shares set with WithSinkShare are kept.
 func (szr *Sizer) Reset() {
-	szr.crsrs = []uint32{}
+	szr.crsrs = make(map[string][]uint32)
+	szr.sinks = []string{}
+	szr.pageFunc = nil
+}
+
+// choose how to measure the parts of the page with the given text, until the next Reset.
+func (szr *Sizer) fit(s string) {
+	if szr.pageSizeFunc == nil {
+		return
+	}
+	szr.pageFunc = szr.pageSizeFunc(s)
 }
@@ -183,6 +183,157 @@ eleven twelve
 
 }
 
+func TestSizePagesEncoding(t *testing.T) {
+	st := state.NewState(0)
+	ca := cache.NewCache().WithSizeFunc(Gsm7Size)
+	mn := NewMenu()
+	rs := newTestSizeResource()
+	rs.AddTemplate(context.Background(), "pages_nor", "én {{.foo}} tø {{.bar}}\n{{.xyzzy}}")
+	rs.Lock()
+	szr := NewSizer(48).WithSizeFunc(Gsm7Size)
+	pg := NewPage(ca, rs).WithSizer(szr).WithMenu(mn)
+	ca.Push()
+	st.Down("test")
+	ca.Add("foo", "blå", 3)
+	ca.Add("bar", "rød", 3)
+	ca.Add("xyzzy", "blåbær\nbringebær\njordbær\nmultebær", 0)
+	pg.Map("foo")
+	pg.Map("bar")
+	pg.Map("xyzzy")
+
+	mn.Put("1", "først")
+
+	ctx := context.Background()
+	r, err := pg.Render(ctx, "pages_nor", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `én blå tø rød
+blåbær
+bringebær
+jordbær
+1:først`
+	if r != expect {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s\n", expect, r)
+	}
+	if ByteSize(r) <= 48 {
+		t.Fatalf("expected byte size of page to exceed output size, got %d", ByteSize(r))
+	}
+
+	r, err = pg.Render(ctx, "pages_nor", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = `én blå tø rød
+multebær
+1:først`
+	if r != expect {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s\n", expect, r)
+	}
+}
+
+func TestSizePagesLongValue(t *testing.T) {
+	ctx := context.Background()
+	ca := cache.NewCache()
+	rs := newTestSizeResource()
+	rs.AddTemplate(ctx, "terms", "Terms:\n{{.xyzzy}}")
+	rs.Lock()
+	szr := NewSizer(50).WithContinuation(" >")
+	ca.Push()
+	ca.Add("xyzzy", "Lorem ipsum dolor sit amet, consectetur adipiscing elit. Vivamus in mattis lorem. Aliquam erat volutpat.", 0)
+
+	expect := []string{`Terms:
+Lorem ipsum >
+dolor sit >
+0:ok
+11:next`, `Terms:
+amet, >
+0:ok
+11:next
+22:previous`, `Terms:
+elit. Vivamus >
+0:ok
+11:next
+22:previous`, `Terms:
+erat volutpat.
+0:ok
+22:previous`,
+	}
+	for i, v := range []uint16{0, 1, 4, 7} {
+		mn := NewMenu().WithBrowseConfig(DefaultBrowseConfig())
+		pg := NewPage(ca, rs).WithSizer(szr).WithMenu(mn)
+		pg.Reset()
+		pg.Map("xyzzy")
+		mn.Put("0", "ok")
+		r, err := pg.Render(ctx, "terms", v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r != expect[i] {
+			t.Fatalf("page %d expected:\n\t%s\ngot:\n\t%s\n", v, expect[i], r)
+		}
+	}
+}
+
+func TestSizePagesMultiSink(t *testing.T) {
+	ctx := context.Background()
+	ca := cache.NewCache()
+	rs := newTestSizeResource()
+	rs.AddTemplate(ctx, "recent", "Tx:\n{{.tx}}\nTo:\n{{.to}}")
+	rs.Lock()
+	szr := NewSizer(64).WithSinkShare("tx", SinkShare{Weight: 2}).WithSinkShare("to", SinkShare{Min: 10})
+	ca.Push()
+	ca.Add("tx", "+100 inky\n-20 pinky\n-5 blinky\n+42 clyde\n-1 sue", 0)
+	ca.Add("to", "tinkywinky\ndipsy\nlala\npo", 0)
+
+	expect := []string{`Tx:
++100 inky
+-20 pinky
+To:
+tinkywinky
+dipsy
+0:ok
+11:next`, `Tx:
+-5 blinky
++42 clyde
+To:
+lala
+po
+0:ok
+11:next
+22:previous`, `Tx:
+-1 sue
+To:
+
+0:ok
+22:previous`,
+	}
+	for i, v := range expect {
+		mn := NewMenu().WithBrowseConfig(DefaultBrowseConfig())
+		pg := NewPage(ca, rs).WithSizer(szr).WithMenu(mn)
+		pg.Reset()
+		pg.Map("tx")
+		pg.Map("to")
+		mn.Put("0", "ok")
+		r, err := pg.Render(ctx, "recent", uint16(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r != v {
+			t.Fatalf("page %d expected:\n\t%s\ngot:\n\t%s\n", i, v, r)
+		}
+	}
+
+	pg := NewPage(ca, rs).WithSizer(szr).WithMenu(NewMenu())
+	pg.Reset()
+	pg.Map("tx")
+	pg.Map("to")
+	_, err := pg.Render(ctx, "recent", uint16(len(expect)))
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
 func TestManySizes(t *testing.T) {
 	for i := 60; i < 160; i++ {
 		st := state.NewState(0)
@@ -399,3 +550,56 @@ func TestMiddlePage(t *testing.T) {
 	}
 	fmt.Printf("%s\n", r)
 }
+
+func TestSizeResetSinks(t *testing.T) {
+	szr := NewSizer(16)
+	szr.AddSinkCursor("foo", 0)
+	szr.Reset()
+	szr.AddSinkCursor("bar", 0)
+	if len(szr.sinks) != 1 || szr.sinks[0] != "bar" {
+		t.Fatalf("expected only sink bar, got %v", szr.sinks)
+	}
+}
+
+func TestSizePagesEncodingMixed(t *testing.T) {
+	ctx := context.Background()
+	ca := cache.NewCache().WithSizeFunc(Gsm7Size)
+	rs := newTestSizeResource()
+	rs.AddTemplate(ctx, "mixed", "Habari\n{{.xyzzy}}")
+	rs.Lock()
+	szr := NewSizer(128).WithSizeFunc(Gsm7Size).WithPageSizeFunc(Gsm7PageSize)
+	ca.Push()
+	ca.Add("xyzzy", "inky pinky\nblinky clyde\nsue 😀\ntinkywinky dipsy\nlala poo\none two three\nfour five six", 0)
+
+	expect := []string{`Habari
+inky pinky
+blinky clyde
+sue 😀
+11:next`, `Habari
+tinkywinky dipsy
+lala poo
+11:next
+22:previous`, `Habari
+one two three
+11:next
+22:previous`, `Habari
+four five six
+22:previous`,
+	}
+	for i, v := range expect {
+		mn := NewMenu().WithBrowseConfig(DefaultBrowseConfig())
+		pg := NewPage(ca, rs).WithSizer(szr).WithMenu(mn)
+		pg.Reset()
+		pg.Map("xyzzy")
+		r, err := pg.Render(ctx, "mixed", uint16(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r != v {
+			t.Fatalf("page %d expected:\n\t%s\ngot:\n\t%s\n", i, v, r)
+		}
+		if Gsm7Size(r) > 128 {
+			t.Fatalf("page %d size %d exceeds output size", i, Gsm7Size(r))
+		}
+	}
+}
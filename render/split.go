@@ -2,9 +2,117 @@ package render
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
+// break a sink value into parts that each fit within the capacity.
+//
+// Breaks are made at the last whitespace that fits, or within the word if no whitespace fits. The whitespace at the break is removed.
+//
+// All parts but the last have the marker appended, which is included in the capacity.
+func breakValue(v string, capacity int, marker string, measure SizeFunc) ([]string, error) {
+	var r []string
+	if int(measure(v)) <= capacity {
+		return []string{v}, nil
+	}
+	limit := capacity - int(measure(marker))
+	v = strings.TrimRightFunc(v, unicode.IsSpace)
+	for int(measure(v)) > capacity {
+		var end int
+		var cut int
+		for i, c := range v {
+			if unicode.IsSpace(c) && i > 0 {
+				cut = i
+			}
+			// the part is measured as a whole, since the size of text may depend on all of it
+			if int(measure(v[:i+utf8.RuneLen(c)])) > limit {
+				break
+			}
+			end = i + utf8.RuneLen(c)
+		}
+		part := strings.TrimRightFunc(v[:cut], unicode.IsSpace)
+		if part == "" {
+			cut = end
+			part = v[:cut]
+		}
+		if part == "" {
+			return nil, fmt.Errorf("capacity %d insufficient for value part", capacity)
+		}
+		r = append(r, part+marker)
+		v = strings.TrimLeftFunc(v[cut:], unicode.IsSpace)
+	}
+	return append(r, v), nil
+}
+
+// SinkShare defines how much of the space of a page a sink gets, when several sinks are mapped on the same page.
+//
+// The space is first allocated to the minimum of each sink, and the space remaining after that is divided between the sinks in proportion to their weight.
+type SinkShare struct {
+	// Weight is the proportional share of the page. A zero weight is the same as 1.
+	Weight uint32
+	// Min is the minimum space for the sink, if its values need that much.
+	Min uint32
+}
+
+// allocate the capacity of a page between sinks by their shares.
+//
+// need is the size of the content left for each sink. Sinks needing less than their share get only what they need, and the rest is divided between the other sinks.
+//
+// Fails if the capacity is smaller than the sum of the minimum shares.
+func allocate(capacity uint32, need map[string]uint32, shares map[string]SinkShare) (map[string]uint32, error) {
+	r := make(map[string]uint32)
+	var pending []string
+	for k := range need {
+		pending = append(pending, k)
+	}
+	sort.Strings(pending)
+	left := capacity
+	for len(pending) > 0 {
+		var weights uint32
+		var mins uint32
+		for _, k := range pending {
+			sh := shares[k]
+			if sh.Weight == 0 {
+				sh.Weight = 1
+			}
+			weights += sh.Weight
+			mins += min(sh.Min, need[k])
+		}
+		if mins > left {
+			return nil, fmt.Errorf("capacity %d insufficient for minimum sink sizes %d", left, mins)
+		}
+		var next []string
+		alloc := make(map[string]uint32)
+		for _, k := range pending {
+			sh := shares[k]
+			if sh.Weight == 0 {
+				sh.Weight = 1
+			}
+			alloc[k] = min(sh.Min, need[k]) + (left-mins)*sh.Weight/weights
+			if need[k] > alloc[k] {
+				next = append(next, k)
+			}
+		}
+		if len(next) == len(pending) {
+			for _, k := range pending {
+				r[k] = alloc[k]
+			}
+			break
+		}
+		for _, k := range pending {
+			if need[k] <= alloc[k] {
+				r[k] = need[k]
+				left -= need[k]
+			}
+		}
+		pending = next
+	}
+	return r, nil
+}
+
 func bookmark(values []string) []uint32 {
 	var c int
 	var bookmarks []uint32 = []uint32{0}
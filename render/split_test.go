@@ -47,6 +47,124 @@ func TestSplitPaginate(t *testing.T) {
 	}
 }
 
+func TestSplitBreakValue(t *testing.T) {
+	r, err := breakValue("inky pinky", 10, "", ByteSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 1 || r[0] != "inky pinky" {
+		t.Fatalf("expected unchanged value, got %v", r)
+	}
+
+	r, err = breakValue("inky pinky blinky clyde  ", 12, "", ByteSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"inky pinky", "blinky clyde"}
+	if len(r) != len(expect) {
+		t.Fatalf("expected %v, got %v", expect, r)
+	}
+	for i, v := range expect {
+		if r[i] != v {
+			t.Fatalf("expected %v, got %v", expect, r)
+		}
+	}
+
+	r, err = breakValue("inky pinky blinky clyde sue", 12, "..", ByteSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = []string{"inky pinky..", "blinky..", "clyde sue"}
+	if len(r) != len(expect) {
+		t.Fatalf("expected %v, got %v", expect, r)
+	}
+	for i, v := range expect {
+		if r[i] != v {
+			t.Fatalf("expected %v, got %v", expect, r)
+		}
+	}
+
+	r, err = breakValue("tinkywinkydipsy lala", 6, "", Gsm7Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = []string{"tinkyw", "inkydi", "psy", "lala"}
+	if len(r) != len(expect) {
+		t.Fatalf("expected %v, got %v", expect, r)
+	}
+	for i, v := range expect {
+		if r[i] != v {
+			t.Fatalf("expected %v, got %v", expect, r)
+		}
+	}
+
+	// parts with a character outside the GSM alphabet are measured as a whole
+	r, err = breakValue("inky pinky 😀 blinky", 16, "", Gsm7Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = []string{"inky pinky", "😀", "blinky"}
+	if len(r) != len(expect) {
+		t.Fatalf("expected %v, got %v", expect, r)
+	}
+	for i, v := range expect {
+		if r[i] != v || Gsm7Size(v) > 16 {
+			t.Fatalf("expected %v, got %v", expect, r)
+		}
+	}
+
+	_, err = breakValue("inky pinky", 2, "...", ByteSize)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestSplitAllocate(t *testing.T) {
+	shares := make(map[string]SinkShare)
+	need := map[string]uint32{"foo": 100, "bar": 100}
+	r, err := allocate(30, need, shares)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r["foo"] != 15 || r["bar"] != 15 {
+		t.Fatalf("expected 15 and 15, got %v", r)
+	}
+
+	shares["foo"] = SinkShare{Weight: 2}
+	r, err = allocate(30, need, shares)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r["foo"] != 20 || r["bar"] != 10 {
+		t.Fatalf("expected 20 and 10, got %v", r)
+	}
+
+	need["bar"] = 4
+	r, err = allocate(30, need, shares)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r["foo"] != 26 || r["bar"] != 4 {
+		t.Fatalf("expected 26 and 4, got %v", r)
+	}
+
+	need["bar"] = 100
+	shares["foo"] = SinkShare{Min: 20}
+	r, err = allocate(30, need, shares)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r["foo"] != 25 || r["bar"] != 5 {
+		t.Fatalf("expected 25 and 5, got %v", r)
+	}
+
+	shares["bar"] = SinkShare{Min: 20}
+	_, err = allocate(30, need, shares)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
 //func TestSplitMenuPaginate(t *testing.T) {
 //	menuCfg := DefaultBrowseConfig()
 //	menu := NewMenu().WithBrowseConfig(menuCfg)
@@ -0,0 +1,207 @@
+package resource
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+
+	"git.defalsify.org/vise.git/lang"
+)
+
+const (
+	cacheCode = iota
+	cacheTemplate
+	cacheMenu
+	cacheSourceMap
+)
+
+// CacheStats contains the usage statistics of a CachedResource.
+type CacheStats struct {
+	// Number of lookups served from cache.
+	Hits uint64
+	// Number of lookups passed to the wrapped Resource.
+	Misses uint64
+	// Number of entries removed to make room for new entries.
+	Evictions uint64
+	// Number of entries currently in cache.
+	Size int
+}
+
+// key of a cached lookup.
+type cacheKey struct {
+	typ  int
+	sym  string
+	lang string
+}
+
+// cached lookup result.
+type cacheEntry struct {
+	key cacheKey
+	v   []byte
+}
+
+// CachedResource is a read-through cache for the GetCode, GetTemplate, GetMenu and GetSourceMap lookups of a Resource.
+//
+// Entries are cached by symbol and the language in the context (lang.LanguageFromContext), so translations of the same symbol are kept apart.
+//
+// The cache holds a bounded number of entries. When full, the least recently used entry is evicted. Failed lookups are not cached.
+//
+// Cached values are shared between all callers. Returned byte slices are capped at their length, so that appending to them does not modify the cached value, but they must not be modified in place.
+//
+// All other methods are passed through to the wrapped Resource.
+type CachedResource struct {
+	Resource
+	mu        sync.Mutex
+	size      int
+	entries   map[cacheKey]*list.Element
+	lru       *list.List
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// NewCachedResource creates a new CachedResource for the given Resource, holding at most size entries.
+func NewCachedResource(rs Resource, size int) *CachedResource {
+	return &CachedResource{
+		Resource: rs,
+		size:     size,
+		entries:  make(map[cacheKey]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// GetCode implements Resource.
+func (cr *CachedResource) GetCode(ctx context.Context, nodeSym string) ([]byte, error) {
+	return cr.get(ctx, cacheCode, nodeSym, cr.Resource.GetCode)
+}
+
+// GetTemplate implements Resource.
+func (cr *CachedResource) GetTemplate(ctx context.Context, nodeSym string) (string, error) {
+	v, err := cr.get(ctx, cacheTemplate, nodeSym, func(ctx context.Context, sym string) ([]byte, error) {
+		s, err := cr.Resource.GetTemplate(ctx, sym)
+		return []byte(s), err
+	})
+	return string(v), err
+}
+
+// GetMenu implements Resource.
+func (cr *CachedResource) GetMenu(ctx context.Context, menuSym string) (string, error) {
+	v, err := cr.get(ctx, cacheMenu, menuSym, func(ctx context.Context, sym string) ([]byte, error) {
+		s, err := cr.Resource.GetMenu(ctx, sym)
+		return []byte(s), err
+	})
+	return string(v), err
+}
+
+// GetSourceMap implements SourceMapper.
+//
+// Fails if the wrapped Resource does not implement SourceMapper.
+func (cr *CachedResource) GetSourceMap(ctx context.Context, nodeSym string) ([]byte, error) {
+	sm, ok := cr.Resource.(SourceMapper)
+	if !ok {
+		return nil, fmt.Errorf("no source map getter for: %s", nodeSym)
+	}
+	return cr.get(ctx, cacheSourceMap, nodeSym, sm.GetSourceMap)
+}
+
+// HasMenuTranslation implements MenuTranslator.
+//
+// The result is not cached. Fails if the wrapped Resource does not implement MenuTranslator.
+func (cr *CachedResource) HasMenuTranslation(ctx context.Context, menuSym string, ln lang.Language) (bool, error) {
+	tr, ok := cr.Resource.(MenuTranslator)
+	if !ok {
+		return false, fmt.Errorf("no menu translation checker for: %s", menuSym)
+	}
+	return tr.HasMenuTranslation(ctx, menuSym, ln)
+}
+
+// Invalidate removes all cached entries for the given symbol, in all languages.
+func (cr *CachedResource) Invalidate(sym string) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	for k, e := range cr.entries {
+		if k.sym == sym {
+			cr.lru.Remove(e)
+			delete(cr.entries, k)
+		}
+	}
+}
+
+// Reset removes all cached entries.
+//
+// Statistics are not affected.
+func (cr *CachedResource) Reset() {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.entries = make(map[cacheKey]*list.Element)
+	cr.lru.Init()
+}
+
+// Stats returns the current usage statistics of the cache.
+func (cr *CachedResource) Stats() CacheStats {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	return CacheStats{
+		Hits:      cr.hits,
+		Misses:    cr.misses,
+		Evictions: cr.evictions,
+		Size:      cr.lru.Len(),
+	}
+}
+
+// look up entry in cache, or retrieve it with fn and cache the result.
+func (cr *CachedResource) get(ctx context.Context, typ int, sym string, fn func(context.Context, string) ([]byte, error)) ([]byte, error) {
+	k := cacheKey{
+		typ: typ,
+		sym: sym,
+	}
+	ln, ok := lang.LanguageFromContext(ctx)
+	if ok {
+		k.lang = ln.Code
+	}
+
+	cr.mu.Lock()
+	e, ok := cr.entries[k]
+	if ok {
+		cr.hits += 1
+		cr.lru.MoveToFront(e)
+		v := e.Value.(*cacheEntry).v
+		cr.mu.Unlock()
+		logg.TraceCtxf(ctx, "resource cache hit", "sym", sym, "lang", k.lang)
+		return v, nil
+	}
+	cr.misses += 1
+	cr.mu.Unlock()
+
+	v, err := fn(ctx, sym)
+	if err != nil {
+		return nil, err
+	}
+	// capacity is capped so that appends by the caller, e.g. State.AppendCode, reallocate instead of writing into the cached value.
+	v = v[:len(v):len(v)]
+	logg.TraceCtxf(ctx, "resource cache miss", "sym", sym, "lang", k.lang)
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	e, ok = cr.entries[k]
+	if ok {
+		e.Value.(*cacheEntry).v = v
+		cr.lru.MoveToFront(e)
+		return v, nil
+	}
+	if cr.size <= 0 {
+		return v, nil
+	}
+	for cr.lru.Len() >= cr.size {
+		last := cr.lru.Back()
+		cr.lru.Remove(last)
+		delete(cr.entries, last.Value.(*cacheEntry).key)
+		cr.evictions += 1
+	}
+	cr.entries[k] = cr.lru.PushFront(&cacheEntry{
+		key: k,
+		v:   v,
+	})
+	return v, nil
+}
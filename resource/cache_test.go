@@ -0,0 +1,168 @@
+package resource
+
+import (
+	"context"
+	"testing"
+
+	"git.defalsify.org/vise.git/lang"
+)
+
+func TestCachedResource(t *testing.T) {
+	var c int
+	ctx := context.Background()
+	rs := NewMenuResource()
+	rs.WithCodeGetter(func(ctx context.Context, nodeSym string) ([]byte, error) {
+		c += 1
+		return codeGet(ctx, nodeSym)
+	})
+	rs.WithMenuGetter(menuGet)
+	cr := NewCachedResource(rs, 2)
+
+	for i := 0; i < 3; i++ {
+		v, err := cr.GetCode(ctx, "bar")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(v) != "deafbeef" {
+			t.Fatalf("expected 'deafbeef', got %s", v)
+		}
+	}
+	if c != 1 {
+		t.Fatalf("expected 1 lookup, got %d", c)
+	}
+	_, err := cr.GetCode(ctx, "foo")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	_, err = cr.GetCode(ctx, "foo")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if c != 3 {
+		t.Fatalf("expected failed lookups not to be cached, got %d lookups", c)
+	}
+	st := cr.Stats()
+	if st.Hits != 2 || st.Misses != 3 || st.Size != 1 {
+		t.Fatalf("unexpected stats: %v", st)
+	}
+
+	cr.Invalidate("bar")
+	_, err = cr.GetCode(ctx, "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != 4 {
+		t.Fatalf("expected lookup after invalidate, got %d lookups", c)
+	}
+
+	v, err := cr.GetMenu(ctx, "baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "xyzzy" {
+		t.Fatalf("expected 'xyzzy', got %s", v)
+	}
+	_, err = cr.GetMenu(ctx, "baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cr.GetMenu(ctx, "foo")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	st = cr.Stats()
+	if st.Size != 2 || st.Evictions != 0 {
+		t.Fatalf("unexpected stats: %v", st)
+	}
+	rs.WithMenuGetter(func(ctx context.Context, menuSym string) (string, error) {
+		return menuSym, nil
+	})
+	_, err = cr.GetMenu(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st = cr.Stats()
+	if st.Size != 2 || st.Evictions != 1 {
+		t.Fatalf("unexpected stats: %v", st)
+	}
+
+	cr.Reset()
+	if cr.Stats().Size != 0 {
+		t.Fatalf("expected empty cache after reset")
+	}
+}
+
+func TestCachedResourceLanguage(t *testing.T) {
+	ctx := context.Background()
+	rs := NewMenuResource()
+	rs.WithTemplateGetter(func(ctx context.Context, nodeSym string) (string, error) {
+		ln, ok := lang.LanguageFromContext(ctx)
+		if !ok {
+			return "hello", nil
+		}
+		return "hello " + ln.Code, nil
+	})
+	cr := NewCachedResource(rs, 10)
+
+	ln, err := lang.LanguageFromCode("nor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctxNor := context.WithValue(ctx, "Language", ln)
+	for i := 0; i < 2; i++ {
+		v, err := cr.GetTemplate(ctx, "foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != "hello" {
+			t.Fatalf("expected 'hello', got %s", v)
+		}
+		v, err = cr.GetTemplate(ctxNor, "foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != "hello nor" {
+			t.Fatalf("expected 'hello nor', got %s", v)
+		}
+	}
+	st := cr.Stats()
+	if st.Hits != 2 || st.Misses != 2 {
+		t.Fatalf("unexpected stats: %v", st)
+	}
+	cr.Invalidate("foo")
+	if cr.Stats().Size != 0 {
+		t.Fatalf("expected all languages invalidated")
+	}
+}
+
+func TestCachedResourceAppend(t *testing.T) {
+	ctx := context.Background()
+	rs := NewMenuResource()
+	rs.WithCodeGetter(func(ctx context.Context, nodeSym string) ([]byte, error) {
+		b := make([]byte, 2, 16)
+		copy(b, []byte{0x00, 0x01})
+		return b, nil
+	})
+	cr := NewCachedResource(rs, 2)
+
+	a, err := cr.GetCode(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := cr.GetCode(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a = append(a, 0x02)
+	b = append(b, 0x03)
+	if a[2] != 0x02 || b[2] != 0x03 {
+		t.Fatalf("expected appended values to be separate, got %x and %x", a, b)
+	}
+	v, err := cr.GetCode(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != 2 {
+		t.Fatalf("expected cached value to be unchanged, got %x", v)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 
 	"git.defalsify.org/vise.git/db"
+	"git.defalsify.org/vise.git/lang"
 )
 
 const (
@@ -38,6 +39,7 @@ func NewDbResource(store db.Db) *DbResource {
 	rs.WithCodeGetter(rs.DbGetCode)
 	rs.WithTemplateGetter(rs.DbGetTemplate)
 	rs.WithEntryFuncGetter(rs.DbFuncFor)
+	rs.WithSourceMapGetter(rs.DbGetSourceMap)
 	return rs
 }
 
@@ -110,6 +112,27 @@ func (g *DbResource) DbGetMenu(ctx context.Context, sym string) (string, error)
 	return v, nil
 }
 
+// HasMenuTranslation implements MenuTranslator.
+//
+// Will fail if support for db.DATATYPE_MENU has been disabled.
+func (g *DbResource) HasMenuTranslation(ctx context.Context, sym string, ln lang.Language) (bool, error) {
+	if g.typs&db.DATATYPE_MENU == 0 {
+		return false, errors.New("not a menu getter")
+	}
+	g.db.SetPrefix(db.DATATYPE_MENU)
+	// look up the translation key directly, without fallback to the default language.
+	ctx = context.WithValue(ctx, "Language", lang.Language{})
+	qSym := sym + "_menu_" + ln.Code
+	_, err := g.fn(ctx, qSym)
+	if err != nil {
+		if db.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 // Will fail if support for db.DATATYPE_BIN has been disabled.
 //
 // By default bound to GetCode. Can be replaced with WithCodeGetter.
@@ -122,6 +145,17 @@ func (g *DbResource) DbGetCode(ctx context.Context, sym string) ([]byte, error)
 	return g.fn(ctx, sym)
 }
 
+// Will fail if support for db.DATATYPE_SRCMAP has not been enabled.
+//
+// By default bound to GetSourceMap. Can be replaced with WithSourceMapGetter.
+func (g *DbResource) DbGetSourceMap(ctx context.Context, sym string) ([]byte, error) {
+	if g.typs&db.DATATYPE_SRCMAP == 0 {
+		return nil, errors.New("not a source map getter")
+	}
+	g.db.SetPrefix(db.DATATYPE_SRCMAP)
+	return g.fn(ctx, sym)
+}
+
 // The method will first attempt to resolve using the function registered
 // with the MenuResource parent class.
 //
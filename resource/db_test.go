@@ -3,10 +3,14 @@ package resource
 import (
 	"bytes"
 	"context"
+	"errors"
 	"testing"
+	"testing/fstest"
 
 	"git.defalsify.org/vise.git/db"
+	fsdb "git.defalsify.org/vise.git/db/fs"
 	"git.defalsify.org/vise.git/db/mem"
+	"git.defalsify.org/vise.git/lang"
 )
 
 func TestDb(t *testing.T) {
@@ -134,3 +138,104 @@ func TestDbGetterDirect(t *testing.T) {
 		t.Fatalf("expected 'foo', got '%s'", v)
 	}
 }
+
+func TestDbFS(t *testing.T) {
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"app/root.bin":       {Data: []byte{0x00, 0x01}},
+		"app/root":           {Data: []byte("hello")},
+		"app/root_nor":       {Data: []byte("hallo")},
+		"app/foo_menu":       {Data: []byte("go foo")},
+		"app/foo_menu_nor":   {Data: []byte("gå til foo")},
+		"app/bar.txt":        {Data: []byte("static bar")},
+		"app/_catch.bin":     {Data: []byte{0x00, 0x03}},
+		"app/_catch":         {Data: []byte("something went wrong")},
+		"app/other/root.bin": {Data: []byte{0x00, 0x02}},
+	}
+	store := fsdb.NewFsDb().WithFS(fsys)
+	err := store.Connect(ctx, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := NewDbResource(store).With(db.DATATYPE_STATICLOAD)
+
+	b, err := rs.GetCode(ctx, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, []byte{0x00, 0x01}) {
+		t.Fatalf("expected code 0001, got %x", b)
+	}
+	s, err := rs.GetTemplate(ctx, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "hello" {
+		t.Fatalf("expected 'hello', got '%s'", s)
+	}
+	s, err = rs.GetMenu(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "go foo" {
+		t.Fatalf("expected 'go foo', got '%s'", s)
+	}
+	fn, err := rs.FuncFor(ctx, "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := fn(ctx, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Content != "static bar" {
+		t.Fatalf("expected 'static bar', got '%s'", r.Content)
+	}
+	b, err = rs.GetCode(ctx, "_catch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, []byte{0x00, 0x03}) {
+		t.Fatalf("expected code 0003, got %x", b)
+	}
+	s, err = rs.GetTemplate(ctx, "_catch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "something went wrong" {
+		t.Fatalf("expected 'something went wrong', got '%s'", s)
+	}
+
+	ln, err := lang.LanguageFromCode("nor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = context.WithValue(ctx, "Language", ln)
+	s, err = rs.GetTemplate(ctx, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "hallo" {
+		t.Fatalf("expected 'hallo', got '%s'", s)
+	}
+	s, err = rs.GetMenu(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "gå til foo" {
+		t.Fatalf("expected 'gå til foo', got '%s'", s)
+	}
+
+	store.SetLock(db.DATATYPE_USERDATA, false)
+	store.SetPrefix(db.DATATYPE_USERDATA)
+	err = store.Put(ctx, []byte("foo"), []byte("bar"))
+	if !errors.Is(err, fsdb.ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+
+	store = fsdb.NewFsDb().WithFS(fsys)
+	err = store.Connect(ctx, "app/root")
+	if err == nil {
+		t.Fatal("expected error connecting to file")
+	}
+}
@@ -0,0 +1,141 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// Middleware is the function signature for wrapping the EntryFunc resolving a LOAD symbol.
+//
+// The symbol being resolved is passed in the first argument.
+//
+// Middlewares are added to a MenuResource with Use.
+type Middleware func(sym string, fn EntryFunc) EntryFunc
+
+// PanicError is returned by an EntryFunc wrapped with Recover, when the wrapped function panics.
+type PanicError struct {
+	// Symbol being resolved when the panic occurred.
+	Sym string
+	// Value passed to panic.
+	Value any
+	// Stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+// Error implements the error interface.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in %s: %v", e.Sym, e.Value)
+}
+
+// ForSymbols applies the middleware only to the given symbols.
+//
+// All other symbols are passed through unchanged.
+func ForSymbols(mw Middleware, syms ...string) Middleware {
+	match := make(map[string]bool)
+	for _, sym := range syms {
+		match[sym] = true
+	}
+	return func(sym string, fn EntryFunc) EntryFunc {
+		if !match[sym] {
+			return fn
+		}
+		return mw(sym, fn)
+	}
+}
+
+// Recover converts a panic in the wrapped EntryFunc to a PanicError.
+func Recover() Middleware {
+	return func(sym string, fn EntryFunc) EntryFunc {
+		return func(ctx context.Context, nodeSym string, input []byte) (r Result, err error) {
+			defer func() {
+				v := recover()
+				if v != nil {
+					r = Result{}
+					err = &PanicError{
+						Sym:   sym,
+						Value: v,
+						Stack: debug.Stack(),
+					}
+					logg.ErrorCtxf(ctx, "recovered panic in entry function", "sym", sym, "node", nodeSym, "panic", v)
+				}
+			}()
+			return fn(ctx, nodeSym, input)
+		}
+	}
+}
+
+// Timeout limits the execution time of the wrapped EntryFunc to the given duration.
+//
+// The wrapped EntryFunc receives a context with the deadline set. If it has not returned when the deadline is reached, context.DeadlineExceeded is returned. The wrapped EntryFunc is then left to finish in the background, and its result is discarded.
+func Timeout(d time.Duration) Middleware {
+	return func(sym string, fn EntryFunc) EntryFunc {
+		return func(ctx context.Context, nodeSym string, input []byte) (Result, error) {
+			type result struct {
+				r   Result
+				err error
+			}
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			ch := make(chan result, 1)
+			go func() {
+				var rr result
+				defer func() {
+					v := recover()
+					if v != nil {
+						rr.err = &PanicError{
+							Sym:   sym,
+							Value: v,
+							Stack: debug.Stack(),
+						}
+					}
+					ch <- rr
+				}()
+				rr.r, rr.err = fn(ctx, nodeSym, input)
+			}()
+			select {
+			case rr := <-ch:
+				return rr.r, rr.err
+			case <-ctx.Done():
+				logg.WarnCtxf(ctx, "entry function timed out", "sym", sym, "timeout", d)
+				return Result{}, fmt.Errorf("%s: %w", sym, ctx.Err())
+			}
+		}
+	}
+}
+
+// Retry calls the wrapped EntryFunc again if it returns an error, up to the given number of retries, waiting the given delay between each attempt.
+//
+// Retries stop if the context is done. The result of the last attempt is returned.
+func Retry(retries int, delay time.Duration) Middleware {
+	return func(sym string, fn EntryFunc) EntryFunc {
+		return func(ctx context.Context, nodeSym string, input []byte) (Result, error) {
+			r, err := fn(ctx, nodeSym, input)
+			for i := 0; err != nil && i < retries; i++ {
+				logg.DebugCtxf(ctx, "retrying entry function", "sym", sym, "attempt", i+1, "err", err)
+				select {
+				case <-ctx.Done():
+					return r, err
+				case <-time.After(delay):
+				}
+				r, err = fn(ctx, nodeSym, input)
+			}
+			return r, err
+		}
+	}
+}
+
+// Observe calls the given function after every execution of the wrapped EntryFunc, with the symbol, the execution time and the error returned.
+//
+// It can be used to collect latency and error metrics.
+func Observe(fn func(sym string, d time.Duration, err error)) Middleware {
+	return func(sym string, next EntryFunc) EntryFunc {
+		return func(ctx context.Context, nodeSym string, input []byte) (Result, error) {
+			t := time.Now()
+			r, err := next(ctx, nodeSym, input)
+			fn(sym, time.Since(t), err)
+			return r, err
+		}
+	}
+}
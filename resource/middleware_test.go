@@ -0,0 +1,158 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	var s string
+	tag := func(v string) Middleware {
+		return func(sym string, fn EntryFunc) EntryFunc {
+			return func(ctx context.Context, nodeSym string, input []byte) (Result, error) {
+				s += v
+				r, err := fn(ctx, nodeSym, input)
+				s += v
+				return r, err
+			}
+		}
+	}
+	ctx := context.Background()
+	rs := NewMenuResource()
+	rs.AddLocalFunc("foo", func(ctx context.Context, nodeSym string, input []byte) (Result, error) {
+		s += fmt.Sprintf("[%s]", input)
+		return Result{Content: "42"}, nil
+	})
+	rs.Use(tag("a"), tag("b"))
+	rs.Use(tag("c"))
+
+	fn, err := rs.FuncFor(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := fn(ctx, "root", []byte("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Content != "42" {
+		t.Fatalf("expected '42', got '%s'", r.Content)
+	}
+	if s != "abc[x]cba" {
+		t.Fatalf("expected 'abc[x]cba', got '%s'", s)
+	}
+
+	_, err = rs.FuncFor(ctx, "bar")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestMiddlewareRecover(t *testing.T) {
+	ctx := context.Background()
+	rs := NewMenuResource()
+	rs.AddLocalFunc("foo", func(ctx context.Context, nodeSym string, input []byte) (Result, error) {
+		panic("xyzzy")
+	})
+	rs.Use(Recover())
+	fn, err := rs.FuncFor(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fn(ctx, "root", nil)
+	var e *PanicError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected PanicError, got %v", err)
+	}
+	if e.Sym != "foo" {
+		t.Fatalf("expected sym 'foo', got '%s'", e.Sym)
+	}
+	if e.Value != "xyzzy" {
+		t.Fatalf("expected panic value 'xyzzy', got '%v'", e.Value)
+	}
+}
+
+func TestMiddlewareTimeout(t *testing.T) {
+	ctx := context.Background()
+	rs := NewMenuResource()
+	rs.AddLocalFunc("foo", func(ctx context.Context, nodeSym string, input []byte) (Result, error) {
+		<-ctx.Done()
+		return Result{}, ctx.Err()
+	})
+	rs.AddLocalFunc("bar", func(ctx context.Context, nodeSym string, input []byte) (Result, error) {
+		return Result{Content: "42"}, nil
+	})
+	rs.Use(ForSymbols(Timeout(time.Millisecond), "foo", "bar"))
+
+	fn, err := rs.FuncFor(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fn(ctx, "root", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	fn, err = rs.FuncFor(ctx, "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := fn(ctx, "root", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Content != "42" {
+		t.Fatalf("expected '42', got '%s'", r.Content)
+	}
+}
+
+func TestMiddlewareRetryObserve(t *testing.T) {
+	var c int
+	var obs []string
+	ctx := context.Background()
+	rs := NewMenuResource()
+	rs.AddLocalFunc("foo", func(ctx context.Context, nodeSym string, input []byte) (Result, error) {
+		c += 1
+		if c < 3 {
+			return Result{}, fmt.Errorf("fail %d", c)
+		}
+		return Result{Content: "42"}, nil
+	})
+	rs.AddLocalFunc("bar", func(ctx context.Context, nodeSym string, input []byte) (Result, error) {
+		return Result{}, errors.New("fail")
+	})
+	rs.Use(Observe(func(sym string, d time.Duration, err error) {
+		obs = append(obs, fmt.Sprintf("%s:%v", sym, err))
+	}))
+	rs.Use(ForSymbols(Retry(2, 0), "foo"))
+
+	fn, err := rs.FuncFor(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := fn(ctx, "root", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Content != "42" {
+		t.Fatalf("expected '42', got '%s'", r.Content)
+	}
+	if c != 3 {
+		t.Fatalf("expected 3 calls, got %d", c)
+	}
+
+	fn, err = rs.FuncFor(ctx, "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fn(ctx, "root", nil)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if len(obs) != 2 || obs[0] != "foo:<nil>" || obs[1] != "bar:fail" {
+		t.Fatalf("unexpected observations: %v", obs)
+	}
+}
@@ -3,6 +3,8 @@ package resource
 import (
 	"context"
 	"fmt"
+
+	"git.defalsify.org/vise.git/lang"
 )
 
 // Result contains the results of an external code operation.
@@ -36,6 +38,9 @@ type TemplateFunc func(ctx context.Context, nodeSym string) (string, error)
 // FuncForFunc is a function that returns an EntryFunc associated with a LOAD instruction symbol.
 type FuncForFunc func(ctx context.Context, loadSym string) (EntryFunc, error)
 
+// SourceMapFunc is the function signature for retrieving the serialized source map of the bytecode for a given symbol.
+type SourceMapFunc func(ctx context.Context, nodeSym string) ([]byte, error)
+
 // Resource implementation are responsible for retrieving values and templates for symbols, and can render templates from value dictionaries.
 //
 // All methods must fail if the symbol cannot be resolved.
@@ -52,6 +57,28 @@ type Resource interface {
 	Close(ctx context.Context) error
 }
 
+// SourceMapper is implemented by Resource implementations that can retrieve source maps for bytecode.
+//
+// Source maps are optional, and are only used to annotate errors and debug output.
+type SourceMapper interface {
+	// GetSourceMap retrieves the serialized source map of the bytecode associated with the given symbol.
+	GetSourceMap(ctx context.Context, nodeSym string) ([]byte, error)
+}
+
+// MenuTranslator is implemented by Resource implementations that can tell whether a menu item has been translated.
+//
+// Unlike GetMenu, it does not fall back to the default language.
+type MenuTranslator interface {
+	// HasMenuTranslation returns true if the menu symbol has a translation for the given language.
+	HasMenuTranslation(ctx context.Context, menuSym string, ln lang.Language) (bool, error)
+}
+
+// Unpinner is implemented by Resource implementations that keep state for each session, which should be released when the session ends.
+type Unpinner interface {
+	// Unpin releases the state kept for the session.
+	Unpin(ctx context.Context, sessionId string) error
+}
+
 // MenuResource contains the base definition for building Resource implementations.
 type MenuResource struct {
 	sinkValues   []string
@@ -59,7 +86,9 @@ type MenuResource struct {
 	templateFunc TemplateFunc
 	menuFunc     MenuFunc
 	funcFunc     FuncForFunc
+	srcMapFunc   SourceMapFunc
 	fns          map[string]EntryFunc
+	mws          []Middleware
 }
 
 var (
@@ -107,9 +136,32 @@ func (m *MenuResource) WithMenuGetter(menuGetter MenuFunc) *MenuResource {
 	return m
 }
 
+// WithSourceMapGetter sets the source map symbol resolver method.
+func (m *MenuResource) WithSourceMapGetter(sourceMapGetter SourceMapFunc) *MenuResource {
+	m.srcMapFunc = sourceMapGetter
+	return m
+}
+
+// Use adds middlewares that wrap every EntryFunc returned by FuncFor.
+//
+// Middlewares are applied in the order they are added, the first being the outermost.
+func (m *MenuResource) Use(mws ...Middleware) *MenuResource {
+	m.mws = append(m.mws, mws...)
+	return m
+}
+
 // FuncFor implements Resource interface.
+//
+// The EntryFunc is wrapped in the middlewares added with Use.
 func (m *MenuResource) FuncFor(ctx context.Context, sym string) (EntryFunc, error) {
-	return m.funcFunc(ctx, sym)
+	fn, err := m.funcFunc(ctx, sym)
+	if err != nil || fn == nil {
+		return fn, err
+	}
+	for i := len(m.mws) - 1; i >= 0; i-- {
+		fn = m.mws[i](sym, fn)
+	}
+	return fn, nil
 }
 
 // GetCode implements Resource interface.
@@ -127,6 +179,16 @@ func (m *MenuResource) GetMenu(ctx context.Context, sym string) (string, error)
 	return m.menuFunc(ctx, sym)
 }
 
+// GetSourceMap implements SourceMapper interface.
+//
+// Fails if no source map getter has been set.
+func (m *MenuResource) GetSourceMap(ctx context.Context, sym string) ([]byte, error) {
+	if m.srcMapFunc == nil {
+		return nil, fmt.Errorf("no source map getter for: %s", sym)
+	}
+	return m.srcMapFunc(ctx, sym)
+}
+
 // AddLocalFunc associates a handler function with a external function symbol to be returned by FallbackFunc.
 func (m *MenuResource) AddLocalFunc(sym string, fn EntryFunc) {
 	if m.fns == nil {
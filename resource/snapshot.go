@@ -0,0 +1,362 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"git.defalsify.org/vise.git/db"
+	"git.defalsify.org/vise.git/lang"
+)
+
+var (
+	// ErrNoSnapshot is returned when a SnapshotResource is used before a snapshot has been loaded.
+	ErrNoSnapshot = errors.New("no snapshot loaded")
+)
+
+const (
+	// DefaultPinTTL is the default time after which the pin of an idle session is released.
+	DefaultPinTTL = time.Hour
+)
+
+// SnapshotFunc is the function signature for opening the Resource of a named snapshot.
+type SnapshotFunc func(ctx context.Context, name string) (Resource, error)
+
+// NewDbSnapshotFunc creates a SnapshotFunc that opens a DbResource for the snapshot.
+//
+// For every snapshot a new db.Db is created with newDb, and connected with connStr after the snapshot has been selected. The db.Db must implement db.Snapshotter.
+func NewDbSnapshotFunc(newDb func() db.Db, connStr string) SnapshotFunc {
+	return func(ctx context.Context, name string) (Resource, error) {
+		store := newDb()
+		sn, ok := store.(db.Snapshotter)
+		if !ok {
+			return nil, fmt.Errorf("%T does not implement db.Snapshotter", store)
+		}
+		err := sn.SetSnapshot(name)
+		if err != nil {
+			return nil, err
+		}
+		err = store.Connect(ctx, connStr)
+		if err != nil {
+			return nil, err
+		}
+		return NewDbResource(store), nil
+	}
+}
+
+// snapshot in use by a session.
+type snapshotPin struct {
+	name string
+	t    time.Time
+}
+
+// loaded snapshot.
+type snapshot struct {
+	name string
+	rs   Resource
+	// number of lookups in progress.
+	refs int
+	// set when the snapshot is no longer loaded. It is closed when the last lookup in progress is done.
+	retired bool
+}
+
+// SnapshotResource is a Resource that serves lookups from one of several versions, or snapshots, of the resource data.
+//
+// New snapshots are loaded with Switch, which atomically makes the snapshot current.
+//
+// Every session, identified by the "SessionId" value in the context, is pinned to the snapshot that was current when it first retrieved the bytecode of the root node. The session keeps using that snapshot until it retrieves the bytecode of the root node again. This ensures that a session never sees a mix of nodes from different snapshots.
+//
+// Lookups without a session id in the context always use the current snapshot.
+//
+// Pins of sessions that have been idle for longer than the pin time-to-live are released.
+//
+// Snapshots that are neither current nor pinned are closed on the next Switch or Unpin. Lookups that are in progress at that time complete before the snapshot is closed.
+type SnapshotResource struct {
+	mu      sync.RWMutex
+	fn      SnapshotFunc
+	root    string
+	pinTTL  time.Duration
+	current string
+	rs      map[string]*snapshot
+	pins    map[string]snapshotPin
+}
+
+// NewSnapshotResource creates a new SnapshotResource, using fn to open snapshots.
+//
+// No snapshot is loaded. Switch must be called before use.
+//
+// The pin time-to-live is DefaultPinTTL.
+func NewSnapshotResource(fn SnapshotFunc) *SnapshotResource {
+	return &SnapshotResource{
+		fn:     fn,
+		root:   "root",
+		pinTTL: DefaultPinTTL,
+		rs:     make(map[string]*snapshot),
+		pins:   make(map[string]snapshotPin),
+	}
+}
+
+// WithRoot sets the symbol of the root node, on which sessions are moved to the current snapshot.
+//
+// It must match the engine.Config.Root setting. Default is "root".
+func (sr *SnapshotResource) WithRoot(sym string) *SnapshotResource {
+	sr.root = sym
+	return sr
+}
+
+// WithPinTTL sets the time after which the pin of an idle session is released.
+//
+// It should not be shorter than the session lifetime. If set to 0, pins are only released by Unpin, or when the session returns to the root node.
+func (sr *SnapshotResource) WithPinTTL(d time.Duration) *SnapshotResource {
+	sr.pinTTL = d
+	return sr
+}
+
+// Switch loads the named snapshot, if not already loaded, and makes it the current snapshot.
+func (sr *SnapshotResource) Switch(ctx context.Context, name string) error {
+	sr.mu.RLock()
+	_, ok := sr.rs[name]
+	sr.mu.RUnlock()
+	if !ok {
+		rs, err := sr.fn(ctx, name)
+		if err != nil {
+			return fmt.Errorf("snapshot %s: %w", name, err)
+		}
+		sr.mu.Lock()
+		_, ok = sr.rs[name]
+		if !ok {
+			sr.rs[name] = &snapshot{
+				name: name,
+				rs:   rs,
+			}
+		}
+		sr.mu.Unlock()
+		if ok {
+			rs.Close(ctx)
+		}
+	}
+
+	sr.mu.Lock()
+	old := sr.current
+	sr.current = name
+	sr.mu.Unlock()
+	logg.InfoCtxf(ctx, "switched resource snapshot", "old", old, "new", name)
+	return sr.release(ctx)
+}
+
+// Current returns the name of the current snapshot.
+func (sr *SnapshotResource) Current() string {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+	return sr.current
+}
+
+// Pinned returns the name of the snapshot the session is pinned to.
+//
+// Returns false if the session is not pinned.
+func (sr *SnapshotResource) Pinned(sessionId string) (string, bool) {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+	p, ok := sr.pins[sessionId]
+	return p.name, ok
+}
+
+// Unpin implements Unpinner.
+//
+// It releases the snapshot pinned by the session, and should be called when a session ends. The engine.Manager does this automatically.
+func (sr *SnapshotResource) Unpin(ctx context.Context, sessionId string) error {
+	sr.mu.Lock()
+	delete(sr.pins, sessionId)
+	sr.mu.Unlock()
+	return sr.release(ctx)
+}
+
+// GetCode implements Resource.
+//
+// Retrieving the code of the root node pins the session to the current snapshot.
+func (sr *SnapshotResource) GetCode(ctx context.Context, nodeSym string) ([]byte, error) {
+	s, err := sr.resolve(ctx, nodeSym == sr.root)
+	if err != nil {
+		return nil, err
+	}
+	defer sr.done(ctx, s)
+	return s.rs.GetCode(ctx, nodeSym)
+}
+
+// GetTemplate implements Resource.
+func (sr *SnapshotResource) GetTemplate(ctx context.Context, nodeSym string) (string, error) {
+	s, err := sr.resolve(ctx, false)
+	if err != nil {
+		return "", err
+	}
+	defer sr.done(ctx, s)
+	return s.rs.GetTemplate(ctx, nodeSym)
+}
+
+// GetMenu implements Resource.
+func (sr *SnapshotResource) GetMenu(ctx context.Context, menuSym string) (string, error) {
+	s, err := sr.resolve(ctx, false)
+	if err != nil {
+		return "", err
+	}
+	defer sr.done(ctx, s)
+	return s.rs.GetMenu(ctx, menuSym)
+}
+
+// FuncFor implements Resource.
+func (sr *SnapshotResource) FuncFor(ctx context.Context, loadSym string) (EntryFunc, error) {
+	s, err := sr.resolve(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer sr.done(ctx, s)
+	return s.rs.FuncFor(ctx, loadSym)
+}
+
+// GetSourceMap implements SourceMapper.
+//
+// Fails if the Resource of the snapshot does not implement SourceMapper.
+func (sr *SnapshotResource) GetSourceMap(ctx context.Context, nodeSym string) ([]byte, error) {
+	s, err := sr.resolve(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer sr.done(ctx, s)
+	sm, ok := s.rs.(SourceMapper)
+	if !ok {
+		return nil, fmt.Errorf("no source map getter for: %s", nodeSym)
+	}
+	return sm.GetSourceMap(ctx, nodeSym)
+}
+
+// HasMenuTranslation implements MenuTranslator.
+//
+// Fails if the Resource of the snapshot does not implement MenuTranslator.
+func (sr *SnapshotResource) HasMenuTranslation(ctx context.Context, menuSym string, ln lang.Language) (bool, error) {
+	s, err := sr.resolve(ctx, false)
+	if err != nil {
+		return false, err
+	}
+	defer sr.done(ctx, s)
+	tr, ok := s.rs.(MenuTranslator)
+	if !ok {
+		return false, fmt.Errorf("no menu translation checker for: %s", menuSym)
+	}
+	return tr.HasMenuTranslation(ctx, menuSym, ln)
+}
+
+// Close implements Resource.
+//
+// Closes the Resources of all loaded snapshots, and releases all pins. Snapshots with lookups in progress are closed when the last lookup is done.
+func (sr *SnapshotResource) Close(ctx context.Context) error {
+	var errs []error
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	for k, s := range sr.rs {
+		s.retired = true
+		delete(sr.rs, k)
+		if s.refs > 0 {
+			continue
+		}
+		err := s.rs.Close(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("snapshot %s: %w", k, err))
+		}
+	}
+	sr.current = ""
+	sr.pins = make(map[string]snapshotPin)
+	return errors.Join(errs...)
+}
+
+// get the snapshot for the session in the context.
+//
+// If renew is set, or the snapshot the session is pinned to is no longer loaded, the session is pinned to the current snapshot.
+//
+// The snapshot is kept open until done is called with it.
+func (sr *SnapshotResource) resolve(ctx context.Context, renew bool) (*snapshot, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if sr.current == "" {
+		return nil, ErrNoSnapshot
+	}
+	sessionId, _ := ctx.Value("SessionId").(string)
+	if sessionId == "" {
+		s := sr.rs[sr.current]
+		s.refs += 1
+		return s, nil
+	}
+	p, ok := sr.pins[sessionId]
+	if !ok || renew {
+		if ok && p.name != sr.current {
+			logg.DebugCtxf(ctx, "session moved to current snapshot", "session", sessionId, "old", p.name, "new", sr.current)
+		}
+		p.name = sr.current
+	}
+	s, ok := sr.rs[p.name]
+	if !ok {
+		logg.WarnCtxf(ctx, "pinned snapshot no longer loaded, moving session to current snapshot", "session", sessionId, "old", p.name, "new", sr.current)
+		p.name = sr.current
+		s = sr.rs[p.name]
+	}
+	p.t = time.Now()
+	sr.pins[sessionId] = p
+	s.refs += 1
+	return s, nil
+}
+
+// end a lookup on a snapshot returned by resolve, closing it if it has been retired in the meantime.
+func (sr *SnapshotResource) done(ctx context.Context, s *snapshot) {
+	sr.mu.Lock()
+	s.refs -= 1
+	closing := s.retired && s.refs == 0
+	sr.mu.Unlock()
+	if !closing {
+		return
+	}
+	logg.DebugCtxf(ctx, "closing retired snapshot", "snapshot", s.name)
+	err := s.rs.Close(ctx)
+	if err != nil {
+		logg.ErrorCtxf(ctx, "snapshot close failed", "snapshot", s.name, "err", err)
+	}
+}
+
+// close the snapshots that are neither current nor pinned, and release expired pins.
+//
+// Snapshots with lookups in progress are retired, and closed when the last lookup is done.
+func (sr *SnapshotResource) release(ctx context.Context) error {
+	var errs []error
+	used := make(map[string]bool)
+	unused := make(map[string]Resource)
+
+	sr.mu.Lock()
+	used[sr.current] = true
+	for k, p := range sr.pins {
+		if sr.pinTTL > 0 && time.Since(p.t) > sr.pinTTL {
+			delete(sr.pins, k)
+			continue
+		}
+		used[p.name] = true
+	}
+	for k, s := range sr.rs {
+		if used[k] {
+			continue
+		}
+		delete(sr.rs, k)
+		s.retired = true
+		if s.refs == 0 {
+			unused[k] = s.rs
+		}
+	}
+	sr.mu.Unlock()
+
+	for k, rs := range unused {
+		logg.DebugCtxf(ctx, "closing unused snapshot", "snapshot", k)
+		err := rs.Close(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("snapshot %s: %w", k, err))
+		}
+	}
+	return errors.Join(errs...)
+}
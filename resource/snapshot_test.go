@@ -0,0 +1,333 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"git.defalsify.org/vise.git/db"
+	fsdb "git.defalsify.org/vise.git/db/fs"
+)
+
+type closeResource struct {
+	*MenuResource
+	closed *[]string
+	name   string
+}
+
+func (cr *closeResource) Close(ctx context.Context) error {
+	*cr.closed = append(*cr.closed, cr.name)
+	return nil
+}
+
+func TestSnapshotResource(t *testing.T) {
+	var closed []string
+	ctx := context.Background()
+	sr := NewSnapshotResource(func(ctx context.Context, name string) (Resource, error) {
+		rs := NewMenuResource()
+		rs.WithCodeGetter(func(ctx context.Context, nodeSym string) ([]byte, error) {
+			return []byte(name + ":" + nodeSym), nil
+		})
+		rs.WithTemplateGetter(func(ctx context.Context, nodeSym string) (string, error) {
+			return name, nil
+		})
+		return &closeResource{
+			MenuResource: rs,
+			closed:       &closed,
+			name:         name,
+		}, nil
+	})
+	_, err := sr.GetCode(ctx, "root")
+	if !errors.Is(err, ErrNoSnapshot) {
+		t.Fatalf("expected ErrNoSnapshot, got %v", err)
+	}
+
+	err = sr.Switch(ctx, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctxA := context.WithValue(ctx, "SessionId", "inky")
+	ctxB := context.WithValue(ctx, "SessionId", "pinky")
+	for _, v := range []struct {
+		ctx    context.Context
+		sym    string
+		expect string
+	}{
+		{ctxA, "root", "v1:root"},
+		{ctxA, "foo", "v1:foo"},
+	} {
+		r, err := sr.GetCode(v.ctx, v.sym)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(r) != v.expect {
+			t.Fatalf("expected %s, got %s", v.expect, r)
+		}
+	}
+
+	err = sr.Switch(ctx, "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sr.Current() != "v2" {
+		t.Fatalf("expected current v2, got %s", sr.Current())
+	}
+	for _, v := range []struct {
+		ctx    context.Context
+		sym    string
+		expect string
+	}{
+		{ctxA, "bar", "v1:bar"},
+		{ctxB, "root", "v2:root"},
+		{ctx, "bar", "v2:bar"},
+	} {
+		r, err := sr.GetCode(v.ctx, v.sym)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(r) != v.expect {
+			t.Fatalf("expected %s, got %s", v.expect, r)
+		}
+	}
+	s, err := sr.GetTemplate(ctxA, "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "v1" {
+		t.Fatalf("expected template from v1, got %s", s)
+	}
+	if len(closed) > 0 {
+		t.Fatalf("expected no closed snapshots, got %v", closed)
+	}
+
+	r, err := sr.GetCode(ctxA, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(r) != "v2:root" {
+		t.Fatalf("expected v2:root, got %s", r)
+	}
+	ss, ok := sr.Pinned("inky")
+	if !ok || ss != "v2" {
+		t.Fatalf("expected pin v2, got %s", ss)
+	}
+
+	err = sr.Switch(ctx, "v3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != 1 || closed[0] != "v1" {
+		t.Fatalf("expected v1 closed, got %v", closed)
+	}
+	err = sr.Unpin(ctx, "inky")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != 1 {
+		t.Fatalf("expected v2 still pinned, got %v", closed)
+	}
+	err = sr.Unpin(ctx, "pinky")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != 2 || closed[1] != "v2" {
+		t.Fatalf("expected v2 closed, got %v", closed)
+	}
+	err = sr.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != 3 {
+		t.Fatalf("expected all closed, got %v", closed)
+	}
+}
+
+func TestSnapshotResourceInUse(t *testing.T) {
+	var closed []string
+	ctx := context.Background()
+	started := make(chan struct{})
+	wait := make(chan struct{})
+	sr := NewSnapshotResource(func(ctx context.Context, name string) (Resource, error) {
+		rs := NewMenuResource()
+		rs.WithTemplateGetter(func(ctx context.Context, nodeSym string) (string, error) {
+			if name == "v1" {
+				close(started)
+				<-wait
+			}
+			return name, nil
+		})
+		return &closeResource{
+			MenuResource: rs,
+			closed:       &closed,
+			name:         name,
+		}, nil
+	})
+	err := sr.Switch(ctx, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan string)
+	go func() {
+		s, _ := sr.GetTemplate(ctx, "foo")
+		done <- s
+	}()
+	<-started
+	err = sr.Switch(ctx, "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) > 0 {
+		t.Fatalf("expected snapshot in use not to be closed, got %v", closed)
+	}
+	close(wait)
+	s := <-done
+	if s != "v1" {
+		t.Fatalf("expected template from v1, got %s", s)
+	}
+	if len(closed) != 1 || closed[0] != "v1" {
+		t.Fatalf("expected v1 closed after use, got %v", closed)
+	}
+}
+
+func TestSnapshotResourcePinTTL(t *testing.T) {
+	var closed []string
+	ctx := context.Background()
+	sr := NewSnapshotResource(func(ctx context.Context, name string) (Resource, error) {
+		return &closeResource{
+			MenuResource: NewMenuResource(),
+			closed:       &closed,
+			name:         name,
+		}, nil
+	})
+	if sr.pinTTL != DefaultPinTTL {
+		t.Fatalf("expected default pin ttl %v, got %v", DefaultPinTTL, sr.pinTTL)
+	}
+	sr = sr.WithPinTTL(time.Millisecond)
+	err := sr.Switch(ctx, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = sr.GetMenu(context.WithValue(ctx, "SessionId", "inky"), "foo")
+	_, ok := sr.Pinned("inky")
+	if !ok {
+		t.Fatal("expected session to be pinned")
+	}
+	time.Sleep(time.Millisecond * 10)
+	err = sr.Switch(ctx, "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok = sr.Pinned("inky")
+	if ok {
+		t.Fatal("expected expired pin to be released")
+	}
+	if len(closed) != 1 || closed[0] != "v1" {
+		t.Fatalf("expected v1 closed, got %v", closed)
+	}
+}
+
+func TestSnapshotResourceClose(t *testing.T) {
+	var closed []string
+	ctx := context.Background()
+	sr := NewSnapshotResource(func(ctx context.Context, name string) (Resource, error) {
+		rs := NewMenuResource()
+		rs.WithCodeGetter(func(ctx context.Context, nodeSym string) ([]byte, error) {
+			return []byte(name + ":" + nodeSym), nil
+		})
+		return &closeResource{
+			MenuResource: rs,
+			closed:       &closed,
+			name:         name,
+		}, nil
+	})
+	err := sr.Switch(ctx, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = context.WithValue(ctx, "SessionId", "inky")
+	_, err = sr.GetCode(ctx, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sr.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok := sr.Pinned("inky")
+	if ok {
+		t.Fatal("expected pin to be released on close")
+	}
+	err = sr.Switch(ctx, "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := sr.GetCode(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(r) != "v2:foo" {
+		t.Fatalf("expected 'v2:foo', got '%s'", r)
+	}
+	name, _ := sr.Pinned("inky")
+	if name != "v2" {
+		t.Fatalf("expected pin on v2, got '%s'", name)
+	}
+}
+
+func TestSnapshotResourceDb(t *testing.T) {
+	ctx := context.Background()
+	d, err := ioutil.TempDir("", "vise-resource-snapshot-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"v1", "v2"} {
+		store := fsdb.NewFsDb()
+		err = store.SetSnapshot(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.Connect(ctx, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.SetLock(db.DATATYPE_TEMPLATE, false)
+		store.SetPrefix(db.DATATYPE_TEMPLATE)
+		err = store.Put(ctx, []byte("root"), []byte("hello "+v))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sr := NewSnapshotResource(NewDbSnapshotFunc(func() db.Db {
+		return fsdb.NewFsDb()
+	}, d))
+	err = sr.Switch(ctx, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := sr.GetTemplate(ctx, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "hello v1" {
+		t.Fatalf("expected 'hello v1', got '%s'", s)
+	}
+	err = sr.Switch(ctx, "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = sr.GetTemplate(ctx, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "hello v2" {
+		t.Fatalf("expected 'hello v2', got '%s'", s)
+	}
+	err = sr.Switch(ctx, "v-3")
+	if err == nil {
+		t.Fatal("expected error on invalid snapshot name")
+	}
+}
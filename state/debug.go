@@ -39,6 +39,12 @@ func (fd *flagDebugger) Register(flag uint32, name string) error {
 	return nil
 }
 
+// Name returns the name registered for the flag, if any.
+func (fd *flagDebugger) Name(flag uint32) (string, bool) {
+	v, ok := fd.flagStrings[flag]
+	return v, ok
+}
+
 func (fd *flagDebugger) AsString(flags []byte, length uint32) string {
 	return strings.Join(fd.AsList(flags, length), ",")
 }
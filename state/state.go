@@ -26,7 +26,7 @@ var (
 //
 // Values must be mapped to a level in order to be available for retrieval and count towards size.
 //
-// Symbols are loaded with individual size limitations. The limitations apply if a load symbol is updated. Symbols may be added with a 0-value for limits, called a "sink." If mapped, the sink will consume all net remaining size allowance unused by other symbols. Only one sink may be mapped per level.
+// Symbols are loaded with individual size limitations. The limitations apply if a load symbol is updated. Symbols may be added with a 0-value for limits, called a "sink." If mapped, the sink will consume all net remaining size allowance unused by other symbols. Several sinks may be mapped per level, in which case they share the net remaining size allowance.
 //
 // Symbol keys do not count towards cache size limitations.
 //
@@ -39,12 +39,19 @@ type State struct {
 	Flags    []byte         // Error state
 	Moves    uint32         // Number of times navigation has been performed
 	Language *lang.Language // Language selector for rendering
+	Calls    []Call         // Return points of pending CALL instructions
 	input    []byte         // Last input
 	debug    bool           // Make string representation more human friendly
 	invalid  bool           // True if state is corrupted and should not be persisted.
 	lastMove uint8          // Last menu move direction
 }
 
+// Call holds the return point of a pending CALL instruction.
+type Call struct {
+	Depth int    // Command stack depth of the calling node
+	Code  []byte // Remaining bytecode of the calling node
+}
+
 // number of bytes necessary to represent a bitfield of the given size.
 func toByteSize(BitSize uint32) uint8 {
 	if BitSize == 0 {
@@ -318,6 +325,7 @@ func (st *State) Up() (string, error) {
 	}
 	logg.Tracef("execpath before", "path", st.ExecPath)
 	st.ExecPath = st.ExecPath[:l-1]
+	st.DropCalls(st.Depth())
 	sym := ""
 	if len(st.ExecPath) > 0 {
 		sym = st.ExecPath[len(st.ExecPath)-1]
@@ -334,6 +342,51 @@ func (st *State) Depth() int {
 	return len(st.ExecPath) - 1
 }
 
+// Call records the return point for a node entered with the CALL instruction.
+//
+// The given bytecode will be returned by the matching Return call. The current command stack depth is stored as the depth to return to.
+func (st *State) Call(b []byte) error {
+	if len(st.ExecPath) == 0 {
+		return fmt.Errorf("state root node not yet defined")
+	}
+	if len(st.Calls) >= MaxLevel {
+		return fmt.Errorf("max call levels exceeded (%d)", MaxLevel)
+	}
+	st.Calls = append(st.Calls, Call{
+		Depth: st.Depth(),
+		Code:  b,
+	})
+	logg.Debugf("call", "depth", st.Depth(), "calls", len(st.Calls))
+	return nil
+}
+
+// Return removes the latest return point recorded by Call, and returns it.
+//
+// The command stack is not changed. It is the responsibility of the caller to move up to the returned depth.
+//
+// Fails if no return point has been recorded.
+func (st *State) Return() (Call, error) {
+	l := len(st.Calls)
+	if l == 0 {
+		return Call{}, fmt.Errorf("return called without call")
+	}
+	c := st.Calls[l-1]
+	st.Calls = st.Calls[:l-1]
+	logg.Debugf("return", "depth", c.Depth, "calls", len(st.Calls))
+	return c, nil
+}
+
+// DropCalls discards return points recorded at or above the given command stack depth.
+//
+// It is called by Up with the new depth. It must also be called when execution leaves a node entered with CALL by other means than RET or Up, so that a later RET does not resume in a frame that was abandoned.
+func (st *State) DropCalls(depth int) {
+	l := len(st.Calls)
+	for l > 0 && st.Calls[l-1].Depth >= depth {
+		l -= 1
+	}
+	st.Calls = st.Calls[:l]
+}
+
 // Appendcode adds the given bytecode to the end of the existing code.
 func (st *State) AppendCode(b []byte) error {
 	st.Code = append(st.Code, b...)
@@ -383,6 +436,7 @@ func (st *State) Restart() error {
 	st.SizeIdx = 0
 	st.input = []byte{}
 	st.ExecPath = st.ExecPath[:1]
+	st.Calls = nil
 	st.lastMove = 0
 	return err
 }
@@ -468,6 +468,50 @@ func TestStateReset(t *testing.T) {
 	}
 }
 
+func TestStateCall(t *testing.T) {
+	st := NewState(0)
+	err := st.Call([]byte{0x2a})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	st.Down("foo")
+	err = st.Call([]byte{0x2a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Down("bar")
+	c, err := st.Return()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Depth != 0 {
+		t.Fatalf("expected depth 0, got %d", c.Depth)
+	}
+	if !bytes.Equal(c.Code, []byte{0x2a}) {
+		t.Fatalf("expected code 2a, got %x", c.Code)
+	}
+	_, err = st.Return()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	st.Up()
+
+	err = st.Call([]byte{0x2b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Down("plugh")
+	st.Down("xyzzy")
+	st.Up()
+	if len(st.Calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(st.Calls))
+	}
+	st.Up()
+	if len(st.Calls) != 0 {
+		t.Fatalf("expected no calls, got %d", len(st.Calls))
+	}
+}
+
 func TestStateLanguage(t *testing.T) {
 	st := NewState(0)
 	if st.Language != nil {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strings"
 )
 
 type ParseHandler struct {
@@ -19,9 +20,13 @@ type ParseHandler struct {
 	MSink  func() error
 	MNext  func(string, string) error
 	MPrev  func(string, string) error
+	Call   func(string) error
+	Ret    func() error
+	JmpF   func(uint32, bool, uint32) error
 	cur    string
 	n      int
 	w      io.Writer
+	sm     *SourceMap
 }
 
 func NewParseHandler() *ParseHandler {
@@ -45,6 +50,9 @@ func (ph *ParseHandler) WithDefaultHandlers() *ParseHandler {
 	ph.MSink = ph.msink
 	ph.MNext = ph.mnext
 	ph.MPrev = ph.mprev
+	ph.Call = ph.call
+	ph.Ret = ph.ret
+	ph.JmpF = ph.jmpf
 	return ph
 }
 
@@ -53,6 +61,24 @@ func (ph *ParseHandler) WithWriter(w io.Writer) *ParseHandler {
 	return ph
 }
 
+// WithSourceMap is a chainable function that sets a source map used to annotate each written instruction with its source line.
+func (ph *ParseHandler) WithSourceMap(sm *SourceMap) *ParseHandler {
+	ph.sm = sm
+	return ph
+}
+
+// appends the source location of the instruction at the given offset as a comment.
+func (ph *ParseHandler) annotate(offset int) {
+	if ph.sm == nil {
+		return
+	}
+	l, ok := ph.sm.At(offset)
+	if !ok {
+		return
+	}
+	ph.cur = strings.TrimSuffix(ph.cur, "\n") + " # " + l.Location() + "\n"
+}
+
 // TODO: output op sym
 func (ph *ParseHandler) flush() error {
 	if ph.w != nil {
@@ -148,6 +174,28 @@ func (ph *ParseHandler) mprev(sym string, sel string) error {
 	return nil
 }
 
+func (ph *ParseHandler) call(sym string) error {
+	s := OpcodeString[CALL]
+	ph.cur = fmt.Sprintf("%s %s\n", s, sym)
+	return nil
+}
+
+func (ph *ParseHandler) ret() error {
+	s := OpcodeString[RET]
+	ph.cur = fmt.Sprintf("%s\n", s)
+	return nil
+}
+
+func (ph *ParseHandler) jmpf(flag uint32, inv bool, count uint32) error {
+	s := OpcodeString[JMPF]
+	vv := 0
+	if inv {
+		vv = 1
+	}
+	ph.cur = fmt.Sprintf("%s %v %v %v\n", s, flag, vv, count)
+	return nil
+}
+
 // ToString verifies all instructions in bytecode and returns an assmebly code instruction for it.
 func (ph *ParseHandler) ToString(b []byte) (string, error) {
 	buf := bytes.NewBuffer(nil)
@@ -168,94 +216,16 @@ func (ph *ParseHandler) ToString(b []byte) (string, error) {
 //
 // It fails on any parse error encountered before the bytecode EOF is reached.
 func (ph *ParseHandler) ParseAll(b []byte) (int, error) {
-	var s string
+	var err error
 	running := true
+	l := len(b)
 	for running {
-		op, bb, err := opSplit(b)
-		b = bb
-		if err != nil {
-			return ph.Length(), err
-		}
-		s = OpcodeString[op]
-		if s == "" {
-			return ph.Length(), fmt.Errorf("unknown opcode: %v", op)
-		}
-
-		switch op {
-		case CATCH:
-			r, n, m, bb, err := ParseCatch(b)
-			b = bb
-			if err == nil {
-				err = ph.Catch(r, n, m)
-			}
-		case CROAK:
-			n, m, bb, err := ParseCroak(b)
-			b = bb
-			if err == nil {
-				err = ph.Croak(n, m)
-			}
-		case LOAD:
-			r, n, bb, err := ParseLoad(b)
-			b = bb
-			if err == nil {
-				err = ph.Load(r, n)
-			}
-		case RELOAD:
-			r, bb, err := ParseReload(b)
-			b = bb
-			if err == nil {
-				err = ph.Reload(r)
-			}
-		case MAP:
-			r, bb, err := ParseMap(b)
-			b = bb
-			if err == nil {
-				err = ph.Map(r)
-			}
-		case MOVE:
-			r, bb, err := ParseMove(b)
-			b = bb
-			if err == nil {
-				err = ph.Move(r)
-			}
-		case INCMP:
-			r, v, bb, err := ParseInCmp(b)
-			b = bb
-			if err == nil {
-				err = ph.InCmp(r, v)
-			}
-		case HALT:
-			b, err = ParseHalt(b)
-			if err == nil {
-				err = ph.Halt()
-			}
-		case MSINK:
-			b, err = ParseMSink(b)
-			if err == nil {
-				err = ph.MSink()
-			}
-		case MOUT:
-			r, v, bb, err := ParseMOut(b)
-			b = bb
-			if err == nil {
-				err = ph.MOut(r, v)
-			}
-		case MNEXT:
-			r, v, bb, err := ParseMNext(b)
-			b = bb
-			if err == nil {
-				err = ph.MNext(r, v)
-			}
-		case MPREV:
-			r, v, bb, err := ParseMPrev(b)
-			b = bb
-			if err == nil {
-				err = ph.MPrev(r, v)
-			}
-		}
+		offset := l - len(b)
+		b, err = ph.ParseOne(b)
 		if err != nil {
 			return ph.Length(), err
 		}
+		ph.annotate(offset)
 		ph.flush()
 
 		//rs += "\n"
@@ -265,3 +235,101 @@ func (ph *ParseHandler) ParseAll(b []byte) (int, error) {
 	}
 	return ph.Length(), nil
 }
+
+// ParseOne parses and verifies a single instruction from bytecode, and returns the remaining bytecode.
+//
+// The parsed instruction is passed to the corresponding handler, but is not written to the writer.
+func (ph *ParseHandler) ParseOne(b []byte) ([]byte, error) {
+	var s string
+	var r, v string
+	var n, c uint32
+	var m bool
+	op, bb, err := opSplit(b)
+	b = bb
+	if err != nil {
+		return b, err
+	}
+	s = OpcodeString[op]
+	if s == "" {
+		return b, fmt.Errorf("unknown opcode: %v", op)
+	}
+
+	switch op {
+	case CATCH:
+		r, n, m, b, err = ParseCatch(b)
+		if err == nil {
+			err = ph.Catch(r, n, m)
+		}
+	case CROAK:
+		n, m, b, err = ParseCroak(b)
+		if err == nil {
+			err = ph.Croak(n, m)
+		}
+	case LOAD:
+		r, n, b, err = ParseLoad(b)
+		if err == nil {
+			err = ph.Load(r, n)
+		}
+	case RELOAD:
+		r, b, err = ParseReload(b)
+		if err == nil {
+			err = ph.Reload(r)
+		}
+	case MAP:
+		r, b, err = ParseMap(b)
+		if err == nil {
+			err = ph.Map(r)
+		}
+	case MOVE:
+		r, b, err = ParseMove(b)
+		if err == nil {
+			err = ph.Move(r)
+		}
+	case INCMP:
+		r, v, b, err = ParseInCmp(b)
+		if err == nil {
+			err = ph.InCmp(r, v)
+		}
+	case HALT:
+		b, err = ParseHalt(b)
+		if err == nil {
+			err = ph.Halt()
+		}
+	case MSINK:
+		b, err = ParseMSink(b)
+		if err == nil {
+			err = ph.MSink()
+		}
+	case MOUT:
+		r, v, b, err = ParseMOut(b)
+		if err == nil {
+			err = ph.MOut(r, v)
+		}
+	case MNEXT:
+		r, v, b, err = ParseMNext(b)
+		if err == nil {
+			err = ph.MNext(r, v)
+		}
+	case MPREV:
+		r, v, b, err = ParseMPrev(b)
+		if err == nil {
+			err = ph.MPrev(r, v)
+		}
+	case CALL:
+		r, b, err = ParseCall(b)
+		if err == nil {
+			err = ph.Call(r)
+		}
+	case RET:
+		b, err = ParseRet(b)
+		if err == nil {
+			err = ph.Ret()
+		}
+	case JMPF:
+		n, m, c, b, err = ParseJmpf(b)
+		if err == nil {
+			err = ph.JmpF(n, m, c)
+		}
+	}
+	return b, err
+}
@@ -134,6 +134,36 @@ func TestToString(t *testing.T) {
 	if r != expect {
 		t.Fatalf("expected:\n\t%v\ngot:\n\t%v", expect, r)
 	}
+
+	b = NewLine(nil, CALL, []string{"pin"}, nil, nil)
+	r, err = ph.ToString(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "CALL pin\n"
+	if r != expect {
+		t.Fatalf("expected:\n\t%v\ngot:\n\t%v", expect, r)
+	}
+
+	b = NewLine(nil, RET, nil, nil, nil)
+	r, err = ph.ToString(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "RET\n"
+	if r != expect {
+		t.Fatalf("expected:\n\t%v\ngot:\n\t%v", expect, r)
+	}
+
+	b = NewLine(nil, JMPF, nil, []byte{0x0d}, []uint8{1, 0x01, 0x02})
+	r, err = ph.ToString(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "JMPF 13 1 2\n"
+	if r != expect {
+		t.Fatalf("expected:\n\t%v\ngot:\n\t%v", expect, r)
+	}
 }
 
 func TestToStringMultiple(t *testing.T) {
@@ -173,6 +173,10 @@ func applyTarget(target []byte, st *state.State, ca cache.Memory, ctx context.Co
 		return location, idx, nil
 	default:
 		sym = string(target)
+		if sym == "_catch" {
+			// errors escape all pending subroutines
+			st.DropCalls(0)
+		}
 		err := st.Down(sym)
 		if err != nil {
 			return sym, idx, err
@@ -19,7 +19,10 @@ const (
 	MOUT   = 10
 	MNEXT  = 11
 	MPREV  = 12
-	_MAX   = 12
+	CALL   = 13
+	RET    = 14
+	JMPF   = 15
+	_MAX   = 15
 )
 
 var (
@@ -37,6 +40,9 @@ var (
 		MOUT:   "MOUT",
 		MNEXT:  "MNEXT",
 		MPREV:  "MPREV",
+		CALL:   "CALL",
+		RET:    "RET",
+		JMPF:   "JMPF",
 	}
 
 	OpcodeIndex = map[string]Opcode{
@@ -53,5 +59,8 @@ var (
 		"MOUT":   MOUT,
 		"MNEXT":  MNEXT,
 		"MPREV":  MPREV,
+		"CALL":   CALL,
+		"RET":    RET,
+		"JMPF":   JMPF,
 	}
 )
@@ -1,9 +1,12 @@
 package vm
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"runtime/debug"
+	"text/template"
 
 	"git.defalsify.org/vise.git/cache"
 	"git.defalsify.org/vise.git/render"
@@ -11,7 +14,9 @@ import (
 	"git.defalsify.org/vise.git/state"
 )
 
-// ExternalCodeError indicates an error that occurred when resolving an external code symbol (LOAD, RELOAD).
+// ExternalCodeError indicates an error that occurred when resolving an external code symbol (LOAD, RELOAD), or when rendering the output of a node.
+//
+// A panic in external code or rendering is wrapped as a resource.PanicError.
 type ExternalCodeError struct {
 	sym  string
 	code int
@@ -37,6 +42,11 @@ func (e ExternalCodeError) Error() string {
 	return fmt.Sprintf("error %v:%v", e.sym, e.code)
 }
 
+// Unwrap returns the error returned by the external code.
+func (e ExternalCodeError) Unwrap() error {
+	return e.err
+}
+
 // Vm holds sub-components mutated by the vm execution.
 // TODO: Renderer should be passed to avoid proxy methods not strictly related to vm operation
 type Vm struct {
@@ -48,6 +58,8 @@ type Vm struct {
 	pg            *render.Page      // Render outputs with menues to size constraints
 	menuSeparator string            // Passed to Menu.WithSeparator if not empty
 	last          string            // Last failed LOAD/RELOAD attempt
+	cur           []byte            // Bytecode starting at the instruction being executed
+	curSym        string            // Node of the instruction being executed
 }
 
 // NewVm creates a new Vm.
@@ -72,6 +84,12 @@ func (vmi *Vm) String() string {
 	return fmt.Sprintf("vm (%p) error load: %s", vmi, vmi.last)
 }
 
+// WithTemplateFuncs is a chainable function that adds functions to use in templates, in addition to the built-in functions of render.FuncMap.
+func (vmi *Vm) WithTemplateFuncs(fns template.FuncMap) *Vm {
+	vmi.pg = vmi.pg.WithFuncs(fns)
+	return vmi
+}
+
 // WithMenuSeparator is a chainable function that sets the separator string to use
 // in the menu renderer.
 func (vmi *Vm) WithMenuSeparator(sep string) *Vm {
@@ -116,10 +134,24 @@ func Rewind(sym string, st *state.State, ca cache.Memory) (string, error) {
 // Each step may update the state.
 //
 // On error, the remaining instructions will be returned. State will not be rolled back.
+//
+// If the resource implements resource.SourceMapper, and a source map is available for the node of
+// the failing instruction, the error will be returned as a SourceError.
 func (vm *Vm) Run(ctx context.Context, b []byte) ([]byte, error) {
+	b, err := vm.run(ctx, b)
+	if err != nil {
+		err = vm.sourceError(ctx, err)
+	}
+	return b, err
+}
+
+// execute instructions until yield or error.
+func (vm *Vm) run(ctx context.Context, b []byte) ([]byte, error) {
 	logg.Tracef("new vm run")
 	running := true
 	vm.last = ""
+	vm.cur = nil
+	vm.curSym = ""
 	for running {
 		r := vm.st.MatchFlag(state.FLAG_TERMINATE, true)
 		if r {
@@ -144,6 +176,8 @@ func (vm *Vm) Run(ctx context.Context, b []byte) ([]byte, error) {
 		}
 
 		_ = vm.st.SetFlag(state.FLAG_DIRTY)
+		vm.cur = b
+		vm.curSym, _ = vm.st.Where()
 		op, bb, err := opSplit(b)
 		if err != nil {
 			return b, err
@@ -174,6 +208,12 @@ func (vm *Vm) Run(ctx context.Context, b []byte) ([]byte, error) {
 			b, err = vm.runMNext(ctx, b)
 		case MPREV:
 			b, err = vm.runMPrev(ctx, b)
+		case CALL:
+			b, err = vm.runCall(ctx, b)
+		case RET:
+			b, err = vm.runRet(ctx, b)
+		case JMPF:
+			b, err = vm.runJmpf(ctx, b)
 		case HALT:
 			b, err = vm.runHalt(ctx, b)
 			return b, err
@@ -213,6 +253,39 @@ func (vm *Vm) runErrCheck(ctx context.Context, b []byte, err error) ([]byte, err
 	return b, nil
 }
 
+// annotates the error with the source line of the failing instruction, if a source map is available for its node.
+//
+// The instruction can only be resolved if the bytecode being executed is a remainder of the bytecode of the node.
+func (vm *Vm) sourceError(ctx context.Context, err error) error {
+	smr, ok := vm.rs.(resource.SourceMapper)
+	if !ok || vm.curSym == "" {
+		return err
+	}
+	v, serr := smr.GetSourceMap(ctx, vm.curSym)
+	if serr != nil {
+		logg.TraceCtxf(ctx, "no source map", "sym", vm.curSym, "err", serr)
+		return err
+	}
+	sm, serr := ParseSourceMap(v)
+	if serr != nil {
+		logg.WarnCtxf(ctx, "invalid source map", "sym", vm.curSym, "err", serr)
+		return err
+	}
+	code, serr := vm.rs.GetCode(ctx, vm.curSym)
+	if serr != nil || !bytes.HasSuffix(code, vm.cur) {
+		return err
+	}
+	l, ok := sm.At(len(code) - len(vm.cur))
+	if !ok {
+		return err
+	}
+	return SourceError{
+		Node:   vm.curSym,
+		Source: l,
+		Err:    err,
+	}
+}
+
 // determines whether a state of empty bytecode should result in termination.
 //
 // If there is remaining bytecode, this method is a noop.
@@ -293,6 +366,7 @@ func (vm *Vm) runCroak(ctx context.Context, b []byte) ([]byte, error) {
 	r := vm.st.MatchFlag(sig, mode)
 	if r {
 		logg.InfoCtxf(ctx, "croak! purging and moving to top", "signal", sig)
+		vm.st.DropCalls(0)
 		vm.Reset()
 		vm.ca.Reset()
 		b = []byte{}
@@ -300,6 +374,31 @@ func (vm *Vm) runCroak(ctx context.Context, b []byte) ([]byte, error) {
 	return b, nil
 }
 
+// executes the JMPF opcode
+func (vm *Vm) runJmpf(ctx context.Context, b []byte) ([]byte, error) {
+	sig, mode, count, b, err := ParseJmpf(b)
+	if err != nil {
+		return b, err
+	}
+	r := vm.st.MatchFlag(sig, mode)
+	if !r {
+		return b, nil
+	}
+	logg.DebugCtxf(ctx, "jump!", "flag", sig, "mode", mode, "count", count)
+	ph := NewParseHandler().WithDefaultHandlers()
+	var i uint32
+	for i = 0; i < count; i++ {
+		if len(b) == 0 {
+			return b, fmt.Errorf("jump of %d instructions beyond end of code", count)
+		}
+		b, err = ph.ParseOne(b)
+		if err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
+
 // executes the LOAD opcode
 func (vm *Vm) runLoad(ctx context.Context, b []byte) ([]byte, error) {
 	sym, sz, b, err := ParseLoad(b)
@@ -366,6 +465,61 @@ func (vm *Vm) runMove(ctx context.Context, b []byte) ([]byte, error) {
 	return b, nil
 }
 
+// executes the CALL opcode
+func (vm *Vm) runCall(ctx context.Context, b []byte) ([]byte, error) {
+	sym, b, err := ParseCall(b)
+	if err != nil {
+		return b, err
+	}
+	err = ValidSym([]byte(sym))
+	if err != nil {
+		return b, err
+	}
+	err = vm.st.Call(b)
+	if err != nil {
+		return b, err
+	}
+	sym, _, err = applyTarget([]byte(sym), vm.st, vm.ca, ctx)
+	if err != nil {
+		vm.st.Return()
+		return b, err
+	}
+	code, err := vm.rs.GetCode(ctx, sym)
+	if err != nil {
+		vm.st.Return()
+		return b, err
+	}
+	logg.DebugCtxf(ctx, "loaded call code", "sym", sym, "code", code)
+	vm.Reset()
+	return code, nil
+}
+
+// executes the RET opcode
+func (vm *Vm) runRet(ctx context.Context, b []byte) ([]byte, error) {
+	b, err := ParseRet(b)
+	if err != nil {
+		return b, err
+	}
+	c, err := vm.st.Return()
+	if err != nil {
+		return b, err
+	}
+	for vm.st.Depth() > c.Depth {
+		_, err = vm.st.Up()
+		if err != nil {
+			return b, err
+		}
+		err = vm.ca.Pop()
+		if err != nil {
+			return b, err
+		}
+	}
+	sym, _ := vm.st.Where()
+	logg.DebugCtxf(ctx, "return from call", "sym", sym, "code", c.Code)
+	vm.Reset()
+	return c.Code, nil
+}
+
 // executes the INCMP opcode
 // TODO: document state transition table and simplify flow
 func (vm *Vm) runInCmp(ctx context.Context, b []byte) ([]byte, error) {
@@ -489,16 +643,48 @@ func (vm *Vm) runMPrev(ctx context.Context, b []byte) ([]byte, error) {
 }
 
 // Render wraps output rendering, and handles error when attempting to browse beyond the rendered page count.
+//
+// A panic during rendering is handled like a failed LOAD, and the _catch node is rendered instead.
 func (vm *Vm) Render(ctx context.Context) (string, error) {
+	var r string
+	err := vm.renderWith(ctx, func(sym string, idx uint16) error {
+		var err error
+		r, err = vm.pg.Render(ctx, sym, idx)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return r, nil
+}
+
+// RenderOutput is the same as Render, but returns the output as structured data.
+//
+// Returns nil if there is no output to render.
+func (vm *Vm) RenderOutput(ctx context.Context) (*render.Output, error) {
+	var o *render.Output
+	err := vm.renderWith(ctx, func(sym string, idx uint16) error {
+		var err error
+		o, err = vm.pg.RenderOutput(ctx, sym, idx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// render the current node with the given render function, handling browse errors and panics.
+func (vm *Vm) renderWith(ctx context.Context, fn func(string, uint16) error) error {
 	changed := vm.st.ResetFlag(state.FLAG_DIRTY)
 	if !changed {
-		return "", nil
+		return nil
 	}
 	sym, idx := vm.st.Where()
 	if sym == "" {
-		return "", nil
+		return nil
 	}
-	r, err := vm.pg.Render(ctx, sym, idx)
+	err := vm.render(ctx, sym, idx, fn)
 	var ok bool
 	_, ok = err.(*render.BrowseError)
 	if ok {
@@ -506,12 +692,19 @@ func (vm *Vm) Render(ctx context.Context) (string, error) {
 		b := NewLine(nil, MOVE, []string{"_catch"}, nil, nil)
 		vm.Run(ctx, b)
 		sym, idx := vm.st.Where()
-		r, err = vm.pg.Render(ctx, sym, idx)
-	}
-	if err != nil {
-		return "", err
+		err = vm.render(ctx, sym, idx, fn)
+	} else if errors.As(err, new(*resource.PanicError)) && sym != "_catch" {
+		_ = vm.st.SetFlag(state.FLAG_LOADFAIL)
+		vm.pg = vm.pg.WithError(NewExternalCodeError(sym, err))
+		b := NewLine(nil, MOVE, []string{"_catch"}, nil, nil)
+		_, err = vm.Run(ctx, b)
+		if err != nil {
+			return err
+		}
+		sym, idx := vm.st.Where()
+		err = vm.render(ctx, sym, idx, fn)
 	}
-	return r, nil
+	return err
 }
 
 // retrieve and cache data for key
@@ -526,7 +719,7 @@ func (vm *Vm) refresh(key string, rs resource.Resource, ctx context.Context) (st
 		return "", fmt.Errorf("no retrieve function for external symbol %v", key)
 	}
 	input, _ := vm.st.GetInput()
-	r, err := fn(ctx, key, input)
+	r, err := vm.call(ctx, key, fn, input)
 	if err != nil {
 		logg.Errorf("external function load fail", "key", key, "error", err)
 		_ = vm.st.SetFlag(state.FLAG_LOADFAIL)
@@ -552,3 +745,37 @@ func (vm *Vm) refresh(key string, rs resource.Resource, ctx context.Context) (st
 
 	return r.Content, err
 }
+
+// execute the external code, recovering a panic as a resource.PanicError.
+func (vm *Vm) call(ctx context.Context, key string, fn resource.EntryFunc, input []byte) (r resource.Result, err error) {
+	defer func() {
+		v := recover()
+		if v != nil {
+			r = resource.Result{}
+			err = vm.recovered(ctx, key, v)
+		}
+	}()
+	return fn(ctx, key, input)
+}
+
+// render the page with the render function, recovering a panic as a resource.PanicError.
+func (vm *Vm) render(ctx context.Context, sym string, idx uint16, fn func(string, uint16) error) (err error) {
+	defer func() {
+		v := recover()
+		if v != nil {
+			err = vm.recovered(ctx, sym, v)
+		}
+	}()
+	return fn(sym, idx)
+}
+
+// log the recovered panic value with stack trace, and return it as a resource.PanicError.
+func (vm *Vm) recovered(ctx context.Context, sym string, v any) error {
+	e := &resource.PanicError{
+		Sym:   sym,
+		Value: v,
+		Stack: debug.Stack(),
+	}
+	logg.ErrorCtxf(ctx, "recovered panic", "sym", sym, "panic", v, "stack", string(e.Stack))
+	return e
+}
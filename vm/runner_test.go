@@ -3,6 +3,7 @@ package vm
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -50,6 +51,7 @@ func newTestResource(st *state.State) testResource {
 	rs.AddLocalFunc("setFlagOne", setFlag)
 	rs.AddLocalFunc("set_lang", set_lang)
 	rs.AddLocalFunc("aiee", uhOh)
+	rs.AddLocalFunc("ouch", ouch)
 
 	var b []byte
 	b = NewLine(nil, HALT, nil, nil, nil)
@@ -102,6 +104,10 @@ func uhOh(ctx context.Context, sym string, input []byte) (resource.Result, error
 	return resource.Result{}, fmt.Errorf("uh-oh spaghetti'ohs")
 }
 
+func ouch(ctx context.Context, sym string, input []byte) (resource.Result, error) {
+	panic("ouch")
+}
+
 func setFlag(ctx context.Context, sym string, input []byte) (resource.Result, error) {
 	s := fmt.Sprintf("ping")
 	r := resource.Result{
@@ -148,6 +154,8 @@ func (r testResource) FuncFor(ctx context.Context, sym string) (resource.EntryFu
 		return set_lang, nil
 	case "aiee":
 		return uhOh, nil
+	case "ouch":
+		return ouch, nil
 	}
 	return nil, fmt.Errorf("invalid function: '%s'", sym)
 }
@@ -756,6 +764,95 @@ func TestLoadError(t *testing.T) {
 	}
 }
 
+func TestLoadPanic(t *testing.T) {
+	st := state.NewState(0)
+	st.UseDebug()
+	rs := newTestResource(st)
+	rs.Lock()
+	ca := cache.NewCache()
+	vm := NewVm(st, &rs, ca, nil)
+
+	st.Down("root")
+	st.SetInput([]byte{})
+	b := NewLine(nil, LOAD, []string{"ouch"}, []byte{0x01, 0x10}, nil)
+	b = NewLine(b, HALT, nil, nil, nil)
+
+	var err error
+	ctx := context.Background()
+	b, err = vm.Run(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.MatchFlag(state.FLAG_LOADFAIL, true) {
+		t.Fatal("expected loadfail flag")
+	}
+	sym, _ := st.Where()
+	if sym != "_catch" {
+		t.Fatalf("expected _catch, got %s", sym)
+	}
+
+	r, err := vm.Render(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `error ouch:0
+0:repent`
+	if r != expect {
+		t.Fatalf("expected: \n\t%s\ngot:\n\t%s", expect, r)
+	}
+}
+
+type panicTemplateResource struct {
+	testResource
+}
+
+func (r *panicTemplateResource) GetTemplate(ctx context.Context, sym string) (string, error) {
+	if sym == "foo" {
+		panic("ouch")
+	}
+	return r.testResource.GetTemplate(ctx, sym)
+}
+
+func TestRenderPanic(t *testing.T) {
+	st := state.NewState(0)
+	st.UseDebug()
+	rs := &panicTemplateResource{
+		testResource: newTestResource(st),
+	}
+	rs.AddBytecode(ctx, "foo", NewLine(nil, HALT, nil, nil, nil))
+	rs.Lock()
+	ca := cache.NewCache()
+	vm := NewVm(st, rs, ca, nil)
+
+	st.Down("root")
+	b := NewLine(nil, MOVE, []string{"foo"}, nil, nil)
+	b = NewLine(b, HALT, nil, nil, nil)
+
+	var err error
+	ctx := context.Background()
+	_, err = vm.Run(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := vm.Render(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.MatchFlag(state.FLAG_LOADFAIL, true) {
+		t.Fatal("expected loadfail flag")
+	}
+	sym, _ := st.Where()
+	if sym != "_catch" {
+		t.Fatalf("expected _catch, got %s", sym)
+	}
+	expect := `error foo:0
+0:repent`
+	if r != expect {
+		t.Fatalf("expected: \n\t%s\ngot:\n\t%s", expect, r)
+	}
+}
+
 func TestMatchFlag(t *testing.T) {
 	var err error
 	ctx := context.Background()
@@ -813,6 +910,58 @@ func TestMatchFlag(t *testing.T) {
 	}
 }
 
+func TestJmpf(t *testing.T) {
+	var err error
+	ctx := context.Background()
+
+	st := state.NewState(1)
+	rs := newTestResource(st)
+	rs.Lock()
+	ca := cache.NewCache()
+	vm := NewVm(st, &rs, ca, nil)
+
+	st.Down("root")
+	st.SetInput([]byte{})
+	st.SetFlag(state.FLAG_USERSTART)
+	b := NewLine(nil, JMPF, nil, []byte{state.FLAG_USERSTART}, []uint8{0, 0x01, 0x02})
+	b = NewLine(b, MOUT, []string{"one", "1"}, nil, nil)
+	b = NewLine(b, MOUT, []string{"two", "2"}, nil, nil)
+	b = NewLine(b, JMPF, nil, []byte{state.FLAG_USERSTART}, []uint8{1, 0x01, 0x01})
+	b = NewLine(b, MOUT, []string{"three", "3"}, nil, nil)
+	b = NewLine(b, HALT, nil, nil, nil)
+	_, err = vm.Run(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := vm.Render(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "root\n1:one\n2:two"
+	if r != expect {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s", expect, r)
+	}
+
+	st.Restart()
+	st.SetInput([]byte{})
+	b = NewLine(nil, JMPF, nil, []byte{state.FLAG_USERSTART}, []uint8{1, 0x01, 0x02})
+	b = NewLine(b, HALT, nil, nil, nil)
+	_, err = vm.Run(ctx, b)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+
+	st.Restart()
+	st.SetInput([]byte{})
+	b = NewLine(nil, JMPF, nil, []byte{state.FLAG_USERSTART}, []uint8{1, 0x01, 0x01})
+	b = NewLine(b, MOUT, []string{"one", "1"}, nil, nil)
+	b = b[:len(b)-2]
+	_, err = vm.runJmpf(ctx, b[2:])
+	if err == nil {
+		t.Fatalf("expected error on truncated instruction")
+	}
+}
+
 func TestBatchRun(t *testing.T) {
 	var err error
 	ctx := context.Background()
@@ -874,3 +1023,180 @@ func TestErrorOut(t *testing.T) {
 		t.Fatalf("expected error")
 	}
 }
+
+func TestCallRet(t *testing.T) {
+	var err error
+	ctx := context.Background()
+	st := state.NewState(0)
+	ca := cache.NewCache()
+	rs := newTestResource(st)
+	rs.AddTemplate(ctx, "pin", "enter pin")
+	b := NewLine(nil, MOUT, []string{"cancel", "0"}, nil, nil)
+	b = NewLine(b, HALT, nil, nil, nil)
+	b = NewLine(b, LOAD, []string{"echo"}, []byte{0x0}, nil)
+	b = NewLine(b, RET, nil, nil, nil)
+	rs.AddBytecode(ctx, "pin", b)
+	rs.Lock()
+	vm := NewVm(st, rs, ca, nil)
+
+	st.Down("root")
+	st.SetInput([]byte{})
+	b = NewLine(nil, LOAD, []string{"two"}, []byte{0x0a}, nil)
+	b = NewLine(b, CALL, []string{"pin"}, nil, nil)
+	b = NewLine(b, MAP, []string{"two"}, nil, nil)
+	b = NewLine(b, HALT, nil, nil, nil)
+	b, err = vm.Run(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sym, _ := st.Where()
+	if sym != "pin" {
+		t.Fatalf("expected location 'pin', got '%s'", sym)
+	}
+	r, err := vm.Render(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "enter pin\n0:cancel"
+	if r != expect {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s", expect, r)
+	}
+
+	st.SetInput([]byte("1234"))
+	b, err = vm.Run(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sym, _ = st.Where()
+	if sym != "root" {
+		t.Fatalf("expected location 'root', got '%s'", sym)
+	}
+	if len(st.Calls) > 0 {
+		t.Fatalf("expected no pending calls, got %v", st.Calls)
+	}
+	_, err = ca.Get("echo")
+	if err == nil {
+		t.Fatalf("expected callee cache frame to be freed")
+	}
+	_, err = ca.Get("two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = vm.Render(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "root"
+	if r != expect {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s", expect, r)
+	}
+}
+
+func TestCallFail(t *testing.T) {
+	ctx := context.Background()
+	st := state.NewState(0)
+	ca := cache.NewCache()
+	rs := newTestResource(st)
+	rs.Lock()
+	vm := NewVm(st, rs, ca, nil)
+
+	st.Down("root")
+	b := NewLine(nil, CALL, []string{"nonexistent"}, nil, nil)
+	_, err := vm.Run(ctx, b)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if len(st.Calls) > 0 {
+		t.Fatalf("expected no pending calls, got %v", st.Calls)
+	}
+}
+
+func TestCallCatchRet(t *testing.T) {
+	var err error
+	ctx := context.Background()
+	st := state.NewState(0)
+	ca := cache.NewCache()
+	rs := newTestResource(st)
+	rs.AddTemplate(ctx, "pin", "enter pin")
+	b := NewLine(nil, LOAD, []string{"aiee"}, []byte{0x0}, nil)
+	b = NewLine(b, HALT, nil, nil, nil)
+	rs.AddBytecode(ctx, "pin", b)
+	rs.Lock()
+	vm := NewVm(st, rs, ca, nil)
+
+	st.Down("root")
+	st.SetInput([]byte{})
+	b = NewLine(nil, CALL, []string{"pin"}, nil, nil)
+	b = NewLine(b, MOUT, []string{"back", "0"}, nil, nil)
+	b = NewLine(b, HALT, nil, nil, nil)
+	b, err = vm.Run(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sym, _ := st.Where()
+	if sym != "_catch" {
+		t.Fatalf("expected location '_catch', got '%s'", sym)
+	}
+	if len(st.Calls) > 0 {
+		t.Fatalf("expected no pending calls, got %v", st.Calls)
+	}
+
+	st.ResetFlag(state.FLAG_LOADFAIL)
+	b = NewLine(nil, RET, nil, nil, nil)
+	_, err = vm.Run(ctx, b)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	sym, _ = st.Where()
+	if sym != "_catch" {
+		t.Fatalf("expected location '_catch', got '%s'", sym)
+	}
+}
+
+func TestRetWithoutCall(t *testing.T) {
+	ctx := context.Background()
+	st := state.NewState(0)
+	ca := cache.NewCache()
+	rs := newTestResource(st)
+	rs.Lock()
+	vm := NewVm(st, rs, ca, nil)
+
+	st.Down("root")
+	b := NewLine(nil, RET, nil, nil, nil)
+	_, err := vm.Run(ctx, b)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestRunSourceError(t *testing.T) {
+	st := state.NewState(0)
+	rs := newTestResource(st)
+	b := NewLine(nil, MOUT, []string{"foo", "0"}, nil, nil)
+	offset := len(b)
+	b = NewLine(b, MOVE, []string{"nowhere"}, nil, nil)
+	rs.AddBytecode(ctx, "foo", b)
+	sm := NewSourceMap()
+	sm.Add(0, "foo.vis", 1, "MOUT foo 0")
+	sm.Add(offset, "foo.vis", 3, "MOVE nowhere")
+	rs.AddSourceMap(ctx, "foo", sm.Bytes())
+	rs.Lock()
+	ca := cache.NewCache()
+	vm := NewVm(st, &rs, ca, nil)
+
+	st.Down("foo")
+	_, err := vm.Run(ctx, b)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	var serr SourceError
+	if !errors.As(err, &serr) {
+		t.Fatalf("expected source error, got %v", err)
+	}
+	if serr.Node != "foo" || serr.Source.Line != 3 {
+		t.Fatalf("expected error in foo.vis:3, got %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "foo.vis:3 MOVE nowhere: ") {
+		t.Fatalf("unexpected error string: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package vm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SourceLine associates an instruction in the bytecode of a node with the assembly source line it was generated from.
+type SourceLine struct {
+	// Offset is the position of the first byte of the instruction in the bytecode.
+	Offset int
+	// File is the name of the assembly source file.
+	File string
+	// Line is the 1-indexed line number in File.
+	Line int
+	// Code is the assembly code of the line.
+	Code string
+}
+
+// Location returns the file and line of the source line, e.g. "root.vis:7".
+func (l SourceLine) Location() string {
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+// String implements the String interface.
+func (l SourceLine) String() string {
+	if l.Code == "" {
+		return l.Location()
+	}
+	return l.Location() + " " + l.Code
+}
+
+// SourceMap maps the instructions in the bytecode of a node to the assembly source lines they were generated from.
+//
+// It is serialized as text, with one instruction per line:
+//
+//	<offset>\t<file>:<line>\t<code>
+type SourceMap struct {
+	lines []SourceLine
+}
+
+// NewSourceMap creates a new, empty SourceMap.
+func NewSourceMap() *SourceMap {
+	return &SourceMap{}
+}
+
+// ParseSourceMap creates a SourceMap from its serialized form.
+func ParseSourceMap(b []byte) (*SourceMap, error) {
+	sm := NewSourceMap()
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	i := 0
+	for sc.Scan() {
+		i += 1
+		s := sc.Text()
+		if s == "" {
+			continue
+		}
+		fields := strings.SplitN(s, "\t", 3)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("source map line %d: missing location", i)
+		}
+		offset, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("source map line %d: invalid offset: %s", i, fields[0])
+		}
+		j := strings.LastIndex(fields[1], ":")
+		if j < 0 {
+			return nil, fmt.Errorf("source map line %d: invalid location: %s", i, fields[1])
+		}
+		line, err := strconv.Atoi(fields[1][j+1:])
+		if err != nil {
+			return nil, fmt.Errorf("source map line %d: invalid location: %s", i, fields[1])
+		}
+		var code string
+		if len(fields) > 2 {
+			code = fields[2]
+		}
+		sm.Add(offset, fields[1][:j], line, code)
+	}
+	err := sc.Err()
+	if err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
+
+// Add associates the instruction at the given bytecode offset with a source line.
+func (sm *SourceMap) Add(offset int, file string, line int, code string) {
+	l := SourceLine{
+		Offset: offset,
+		File:   file,
+		Line:   line,
+		Code:   code,
+	}
+	i := sort.Search(len(sm.lines), func(i int) bool {
+		return sm.lines[i].Offset >= offset
+	})
+	if i < len(sm.lines) && sm.lines[i].Offset == offset {
+		sm.lines[i] = l
+		return
+	}
+	sm.lines = append(sm.lines, SourceLine{})
+	copy(sm.lines[i+1:], sm.lines[i:])
+	sm.lines[i] = l
+}
+
+// At returns the source line of the instruction starting at the given bytecode offset.
+func (sm *SourceMap) At(offset int) (SourceLine, bool) {
+	i := sort.Search(len(sm.lines), func(i int) bool {
+		return sm.lines[i].Offset >= offset
+	})
+	if i == len(sm.lines) || sm.lines[i].Offset != offset {
+		return SourceLine{}, false
+	}
+	return sm.lines[i], true
+}
+
+// Lines returns all source lines in the map, ordered by bytecode offset.
+func (sm *SourceMap) Lines() []SourceLine {
+	return sm.lines
+}
+
+// Bytes returns the serialized form of the SourceMap.
+func (sm *SourceMap) Bytes() []byte {
+	var b bytes.Buffer
+	for _, l := range sm.lines {
+		fmt.Fprintf(&b, "%d\t%s\t%s\n", l.Offset, l.Location(), l.Code)
+	}
+	return b.Bytes()
+}
+
+// SourceError is returned by Vm.Run when execution fails, and the assembly source line of the failing instruction is known.
+type SourceError struct {
+	// Node is the symbol of the node the failing instruction belongs to.
+	Node string
+	// Source is the source line of the failing instruction.
+	Source SourceLine
+	// Err is the error itself.
+	Err error
+}
+
+// Error implements the Error interface.
+func (e SourceError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Source, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e SourceError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,63 @@
+package vm
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSourceMap(t *testing.T) {
+	sm := NewSourceMap()
+	sm.Add(13, "root.vis", 2, "INCMP foo 0")
+	sm.Add(0, "root.vis", 1, "MOUT foo 0")
+	sm.Add(42, "lib/menu.vis", 7, "HALT")
+
+	l, ok := sm.At(13)
+	if !ok {
+		t.Fatalf("expected source line")
+	}
+	if l.String() != "root.vis:2 INCMP foo 0" {
+		t.Fatalf("unexpected source line: %s", l)
+	}
+	_, ok = sm.At(14)
+	if ok {
+		t.Fatalf("expected no source line")
+	}
+
+	b := sm.Bytes()
+	expect := "0\troot.vis:1\tMOUT foo 0\n13\troot.vis:2\tINCMP foo 0\n42\tlib/menu.vis:7\tHALT\n"
+	if string(b) != expect {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s", expect, b)
+	}
+	smr, err := ParseSourceMap(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(smr.Bytes(), b) {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s", b, smr.Bytes())
+	}
+
+	_, err = ParseSourceMap([]byte("foo\troot.vis:1\tHALT\n"))
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	_, err = ParseSourceMap([]byte("0\troot.vis\tHALT\n"))
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestSourceMapAnnotate(t *testing.T) {
+	b := NewLine(nil, MOUT, []string{"foo", "0"}, nil, nil)
+	sm := NewSourceMap()
+	sm.Add(len(b), "root.vis", 3, "HALT")
+	b = NewLine(b, HALT, nil, nil, nil)
+	ph := NewParseHandler().WithDefaultHandlers().WithSourceMap(sm)
+	r, err := ph.ToString(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "MOUT foo 0\nHALT # root.vis:3\n"
+	if r != expect {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s", expect, r)
+	}
+}
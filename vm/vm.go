@@ -55,6 +55,16 @@ func ParseMove(b []byte) (string, []byte, error) {
 	return parseSym(b)
 }
 
+// ParseCall parses and extracts the expected argument portion of a CALL instruction
+func ParseCall(b []byte) (string, []byte, error) {
+	return parseSym(b)
+}
+
+// ParseRet parses and extracts the expected argument portion of a RET instruction
+func ParseRet(b []byte) ([]byte, error) {
+	return parseNoArg(b)
+}
+
 // ParseHalt parses and extracts the expected argument portion of a HALT instruction
 func ParseHalt(b []byte) ([]byte, error) {
 	return parseNoArg(b)
@@ -70,6 +80,11 @@ func ParseCroak(b []byte) (uint32, bool, []byte, error) {
 	return parseSig(b)
 }
 
+// ParseJmpf parses and extracts the expected argument portion of a JMPF instruction
+func ParseJmpf(b []byte) (uint32, bool, uint32, []byte, error) {
+	return parseSigCount(b)
+}
+
 // ParseInCmp parses and extracts the expected argument portion of a INCMP instruction
 func ParseInCmp(b []byte) (string, string, []byte, error) {
 	return parseTwoSym(b)
@@ -177,6 +192,22 @@ func parseSig(b []byte) (uint32, bool, []byte, error) {
 	return sig, matchmode, b, nil
 }
 
+// parse and extract one single byte of integer, and one length-prefixed integer value
+func parseSigCount(b []byte) (uint32, bool, uint32, []byte, error) {
+	sig, matchmode, b, err := parseSig(b)
+	if err != nil {
+		return 0, false, 0, b, err
+	}
+	if len(b) == 0 {
+		return 0, false, 0, b, fmt.Errorf("instruction too short")
+	}
+	count, b, err := intSplit(b)
+	if err != nil {
+		return 0, false, 0, b, err
+	}
+	return sig, matchmode, count, b, nil
+}
+
 // split bytecode into head and b using length-prefixed integer
 func intSplit(b []byte) (uint32, []byte, error) {
 	l := uint8(b[0])